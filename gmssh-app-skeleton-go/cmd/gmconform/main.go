@@ -0,0 +1,128 @@
+// Command gmconform checks an app socket server against the gconform wire fixtures
+//
+//	gmconform -s app.sock                  # English messages
+//	gmconform -s app.sock -lang zh-CN -v   # Chinese messages, list passing fixtures too
+//	gmconform -s app.sock -run '^framing/'
+//	gmconform -list
+//
+// The server must serve the skeleton API (ping, hello) of gmssh-app-skeleton-back-py,
+// started with the language given by -lang. Exits with status 1 when a fixture fails
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gconform"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes gmconform with the given arguments and returns the exit status
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gmconform", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gmconform -s <socket> [flags]")
+		flags.PrintDefaults()
+	}
+	socket := flags.String("s", os.Getenv("GMRPC_SOCKET"), "socket path, or host:port with -network tcp (default $GMRPC_SOCKET)")
+	network := flags.String("network", "unix", "transport: unix or tcp")
+	lang := flags.String("lang", gconform.DefaultLanguage, "language the server was started with: en or zh-CN")
+	pattern := flags.String("run", "", "only run fixtures whose name matches this regular expression")
+	dir := flags.String("fixtures", "", "directory of fixture .json files (default the built-in fixtures)")
+	timeout := flags.Duration("timeout", gconform.DefaultTimeout, "timeout of each fixture")
+	verbose := flags.Bool("v", false, "list passing fixtures too")
+	list := flags.Bool("list", false, "list the fixtures and exit")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 || *socket == "" && !*list {
+		flags.Usage()
+		return 2
+	}
+
+	fixtures, err := loadFixtures(*dir, *pattern)
+	if err != nil {
+		fmt.Fprintf(stderr, "gmconform: %v\n", err)
+		return 2
+	}
+	if *list {
+		for _, fixture := range fixtures {
+			fmt.Fprintf(stdout, "%-24s %s\n", fixture.Name, fixture.Doc)
+		}
+		return 0
+	}
+
+	report := gconform.Run(ctx, *socket, fixtures,
+		gconform.WithNetworkOption(*network),
+		gconform.WithLanguageOption(*lang),
+		gconform.WithTimeoutOption(*timeout),
+	)
+	out := report.String()
+	if !*verbose {
+		// Keep failures and the summary only
+		var kept []string
+		for _, line := range strings.SplitAfter(out, "\n") {
+			if !strings.HasPrefix(line, "--- PASS") {
+				kept = append(kept, line)
+			}
+		}
+		out = strings.Join(kept, "")
+	}
+	fmt.Fprint(stdout, out)
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
+
+// loadFixtures loads the fixtures of dir, or the built-in ones, keeping those matching pattern
+func loadFixtures(dir, pattern string) ([]*gconform.Fixture, error) {
+	var (
+		fixtures []*gconform.Fixture
+		err      error
+	)
+	if dir == "" {
+		fixtures, err = gconform.Fixtures()
+	} else {
+		fixtures, err = gconform.LoadFixtures(os.DirFS(dir))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -run: %w", err)
+		}
+		var kept []*gconform.Fixture
+		for _, fixture := range fixtures {
+			if re.MatchString(fixture.Name) {
+				kept = append(kept, fixture)
+			}
+		}
+		fixtures = kept
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no fixtures to run")
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+func TestRun(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	// Unknown methods conform, the bare ping does not translate its message
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-s", client.SocketPath, "-v", "-run", "not-found"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s%s", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "--- PASS: errors/not-found") {
+		t.Fatalf("unexpected output %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run(context.Background(), []string{"-s", client.SocketPath, "-run", "^framing/ping$"}, &stdout, &stderr); code != 1 {
+		t.Fatalf("exit %d: %s", code, stdout.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "--- FAIL: framing/ping") || !strings.Contains(out, "FAIL 1 of 1 fixtures") {
+		t.Fatalf("unexpected output %s", out)
+	}
+}
+
+func TestFixturesFlag(t *testing.T) {
+	dir := t.TempDir()
+	fixture := `[{"name":"custom/ping","doc":"Custom ping","steps":[{"send":["Content-Length: 40\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"ping\"}"],"expect":[{"id":1,"result":{"code":200,"data":"pong"}}]}]}]`
+	if err := os.WriteFile(filepath.Join(dir, "custom.json"), []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-fixtures", dir, "-list"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if got := stdout.String(); !strings.HasPrefix(got, "custom/ping") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("unexpected list %q", got)
+	}
+
+	if code := run(context.Background(), []string{"-list", "-run", "^nothing$"}, &stdout, &stderr); code != 2 {
+		t.Fatalf("empty selection exit %d", code)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// goTemplate renders the method name constants, the server registration glue and the typed client
+var goTemplate = template.Must(template.New("go").Parse(`// Code generated by gmgen -type {{.Name}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .ImportLines}}
+	{{.}}
+{{- end}}
+)
+
+// RPC method names of {{.Name}}
+const (
+{{- range .Methods}}
+	{{.Const $}} = "{{.RPC}}"
+{{- end}}
+)
+
+// Register{{.Name}} registers every {{.Name}} method of impl on s, typically a *simplejrpc.Server
+// Methods needing route middlewares can be registered again by hand under the constants above
+func Register{{.Name}}(s gsock.IRpcHandler, impl {{.Name}}) {
+{{- range .Methods}}
+	s.RegisterHandle({{.Const $}}, func(req *gsock.Request) (any, error) {
+{{- if .Params}}
+		var params {{.Params}}
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+{{- end}}
+{{- if .Result}}
+		return impl.{{.Name}}(req.Context(){{if .Params}}, params{{end}})
+{{- else}}
+		return nil, impl.{{.Name}}(req.Context(){{if .Params}}, params{{end}})
+{{- end}}
+	})
+{{- end}}
+}
+
+// {{.Name}}Client calls {{.Name}} methods through a gsock client
+type {{.Name}}Client struct {
+	client gsock.IRpcClient
+	opts   []gsock.CallOptFunc
+}
+
+var _ {{.Name}} = (*{{.Name}}Client)(nil)
+
+// New{{.Name}}Client creates a {{.Name}} client; opts apply to every call
+func New{{.Name}}Client(client gsock.IRpcClient, opts ...gsock.CallOptFunc) *{{.Name}}Client {
+	return &{{.Name}}Client{client: client, opts: opts}
+}
+{{range .Methods}}
+{{- range .Doc}}
+// {{.}}
+{{- else}}
+// {{.Name}} calls {{.RPC}}
+{{- end}}
+func (c *{{$.Name}}Client) {{.Name}}(ctx context.Context{{if .Params}}, params {{.Params}}{{end}}) ({{if .Result}}{{.Result}}, {{end}}error) {
+{{- if .Result}}
+	return gsock.Call[{{.Result}}](ctx, c.client, {{.Const $}}, {{if .Params}}params{{else}}nil{{end}}, c.opts...)
+{{- else}}
+	_, err := gsock.Call[any](ctx, c.client, {{.Const $}}, {{if .Params}}params{{else}}nil{{end}}, c.opts...)
+	return err
+{{- end}}
+}
+{{end}}`))
+
+// ImportLines returns the import specs of the generated Go file
+func (a *api) ImportLines() []string {
+	imports := map[string]string{
+		"context": "context",
+		"gsock":   "github.com/DemonZack/simplejrpc-go/net/gsock",
+	}
+	for name, path := range a.Imports {
+		imports[name] = path
+	}
+
+	var std, other []string
+	for name, path := range imports {
+		line := fmt.Sprintf("%q", path)
+		if name != baseName(path) {
+			line = name + " " + line
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, line)
+		} else {
+			std = append(std, line)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	if len(other) == 0 {
+		return std
+	}
+	// Standard library first, as goimports groups them
+	return append(append(std, ""), other...)
+}
+
+// generateGo renders the Go file for the API
+func generateGo(a *api) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := goTemplate.Execute(&buf, a); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
@@ -0,0 +1,118 @@
+// Command gmgen generates RPC glue from a Go interface describing an app's API
+//
+// For an interface
+//
+//	// FileAPI manages files
+//	//gmgen:prefix file
+//	type FileAPI interface {
+//	    // List lists a directory
+//	    List(ctx context.Context, params ListParams) ([]Entry, error)
+//	    //gmgen:method file.rm
+//	    Delete(ctx context.Context, params DeleteParams) error
+//	}
+//
+// it writes, next to the interface:
+//
+//   - file_api.gen.go: method name constants, RegisterFileAPI, which registers an
+//     implementation on a simplejrpc.Server or any gsock.IRpcHandler, and
+//     FileAPIClient, a typed client built on gsock.Call
+//   - with -ts web/file_api: file_api.d.ts declaring the params and result types and a
+//     fileAPI object, and file_api.js implementing it with request<T>(method, params)
+//     from gmssh-front-sdk, or with a global request function such as window.$gm.request,
+//     which gm-app-sdk installs, when -request is set
+//
+// Methods take a context.Context and at most one params value, and return an error,
+// optionally preceded by a result. RPC method names are the prefix and the method name
+// with a lower-case first letter ("file.list"), unless set with //gmgen:method.
+//
+// Typical use is a go:generate directive in the package declaring the interface:
+//
+//	//go:generate go run github.com/DemonZack/simplejrpc-go/cmd/gmgen -type FileAPI -ts ../web/src/api/file_api
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run executes gmgen with the given arguments and returns the exit status
+func run(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gmgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gmgen -type <Interface> [flags]")
+		flags.PrintDefaults()
+	}
+	name := flags.String("type", "", "interface describing the RPC API (required)")
+	dir := flags.String("dir", ".", "directory of the package declaring the interface")
+	prefix := flags.String("prefix", "", "RPC method prefix, overrides //gmgen:prefix")
+	out := flags.String("o", "", "generated Go file (default <dir>/<type_in_snake_case>.gen.go)")
+	ts := flags.String("ts", "", "path of the TypeScript module to generate, without extension (default none)")
+	sdk := flags.String("sdk", "gmssh-front-sdk", "module exporting request<T>(method, params)")
+	request := flags.String("request", "", "global request<T>(method, params) to call instead of importing it from -sdk, e.g. window.$gm.request (gm-app-sdk)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := generate(*dir, *name, *prefix, *out, *ts, *sdk, *request); err != nil {
+		fmt.Fprintf(stderr, "gmgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// generate writes the Go file and, if ts is set, the TypeScript module
+func generate(dir, name, prefix, out, ts, sdk, request string) error {
+	a, err := parseAPI(dir, name, prefix)
+	if err != nil {
+		return err
+	}
+
+	src, err := generateGo(a)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		out = filepath.Join(dir, snakeCase(name)+".gen.go")
+	}
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		return err
+	}
+
+	if ts == "" {
+		return nil
+	}
+	dts, js := generateTS(a, sdk, request)
+	ts = strings.TrimSuffix(strings.TrimSuffix(ts, ".ts"), ".d")
+	if err := os.MkdirAll(filepath.Dir(ts), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ts+".d.ts", dts, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(ts+".js", js, 0o644)
+}
+
+var (
+	snakeWord    = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	snakeAcronym = regexp.MustCompile(`([A-Z]+)([A-Z][a-z])`)
+)
+
+// snakeCase converts a Go name to snake case: FileAPI -> file_api, HTTPServer -> http_server
+func snakeCase(name string) string {
+	name = snakeAcronym.ReplaceAllString(name, "${1}_${2}")
+	return strings.ToLower(snakeWord.ReplaceAllString(name, "${1}_${2}"))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGolden regenerates the example package and compares the result with the committed files
+func TestGolden(t *testing.T) {
+	const example = "../../example/gmgen"
+	out := t.TempDir()
+
+	var stderr bytes.Buffer
+	args := []string{"-dir", example, "-type", "FileAPI", "-o", filepath.Join(out, "file_api.gen.go"), "-ts", filepath.Join(out, "web", "file_api")}
+	if code := run(args, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+
+	for _, file := range []string{"file_api.gen.go", "web/file_api.d.ts", "web/file_api.js"} {
+		want, err := os.ReadFile(filepath.Join(example, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is stale, run go generate in example/gmgen:\n%s", file, got)
+		}
+	}
+}
+
+func TestGlobalRequest(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "file_api")
+	var stderr bytes.Buffer
+	args := []string{"-dir", "../../example/gmgen", "-type", "FileAPI", "-o", out + ".gen.go", "-ts", out, "-request", "window.$gm.request"}
+	if code := run(args, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	js, _ := os.ReadFile(out + ".js")
+	if strings.Contains(string(js), "import") || !strings.Contains(string(js), `usage: () => window.$gm.request("file.usage", null),`) {
+		t.Fatalf("unexpected wrappers:\n%s", js)
+	}
+}
+
+func TestInvalidSignatures(t *testing.T) {
+	cases := map[string]string{
+		"func(params int) error":                            "want (ctx context.Context",
+		"func(ctx context.Context, a, b int) error":         "want (ctx context.Context",
+		"func(ctx context.Context) int":                     "want ([result R, ]error)",
+		"func(ctx context.Context, opts ...string) error":   "variadic",
+		"func(ctx context.Context, p unknown.Params) error": "unknown package unknown",
+	}
+	for signature, want := range cases {
+		dir := t.TempDir()
+		src := "package api\n\nimport \"context\"\n\ntype API interface {\n\tCall" + strings.TrimPrefix(signature, "func") + "\n}\n"
+		if err := os.WriteFile(filepath.Join(dir, "api.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stderr bytes.Buffer
+		if code := run([]string{"-dir", dir, "-type", "API"}, &stderr); code != 1 || !strings.Contains(stderr.String(), want) {
+			t.Errorf("%s: exit %d, %q does not mention %q", signature, code, stderr.String(), want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	for in, want := range map[string]string{"FileAPI": "file_api", "HTTPServer": "http_server", "Disk": "disk"} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%s) = %s, want %s", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{"List": "list", "HTTPPing": "httpPing", "ID": "id", "API": "api"} {
+		if got := lowerFirst(in); got != want {
+			t.Errorf("lowerFirst(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
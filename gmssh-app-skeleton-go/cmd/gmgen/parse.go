@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// directivePrefix sets the RPC method prefix of an interface: //gmgen:prefix file
+	directivePrefix = "gmgen:prefix"
+
+	// directiveMethod overrides the RPC method name of an interface method: //gmgen:method file.ls
+	directiveMethod = "gmgen:method"
+)
+
+// api is a parsed RPC interface
+type api struct {
+	Package string            // Package of the interface
+	Name    string            // Interface name
+	Doc     []string          // Interface doc comment lines, directives removed
+	Methods []*method         // Methods in declaration order
+	Imports map[string]string // Imports used by method signatures, path by name
+	types   map[string]*ast.TypeSpec
+	fset    *token.FileSet
+}
+
+// method is one RPC method of the interface
+type method struct {
+	Name   string   // Go method name
+	RPC    string   // RPC method name
+	Doc    []string // Doc comment lines, directives removed
+	Params string   // Params type, empty when the method takes none
+	Result string   // Result type, empty when the method only returns an error
+	params ast.Expr
+	result ast.Expr
+}
+
+// Const returns the name of the generated method name constant
+func (m *method) Const(a *api) string {
+	return a.Name + m.Name
+}
+
+// parseAPI finds the interface name in the Go package in dir
+func parseAPI(dir, name, prefix string) (*api, error) {
+	fset := token.NewFileSet()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &api{Name: name, Imports: make(map[string]string), types: make(map[string]*ast.TypeSpec), fset: fset}
+	var (
+		iface     *ast.InterfaceType
+		ifaceDecl *ast.GenDecl
+		ifaceFile *ast.File
+	)
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") || strings.HasSuffix(file, ".gen.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, file), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if a.Package == "" {
+			a.Package = f.Name.Name
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				a.types[ts.Name.Name] = ts
+				if ts.Name.Name != name {
+					continue
+				}
+				it, ok := ts.Type.(*ast.InterfaceType)
+				if !ok {
+					return nil, fmt.Errorf("%s: %s is not an interface", fset.Position(ts.Pos()), name)
+				}
+				iface, ifaceDecl, ifaceFile = it, gen, f
+			}
+		}
+	}
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found in %s", name, dir)
+	}
+
+	doc := a.types[name].Doc
+	if doc == nil {
+		doc = ifaceDecl.Doc
+	}
+	var directives map[string]string
+	a.Doc, directives = splitDoc(doc)
+	if prefix == "" {
+		prefix = directives[directivePrefix]
+	}
+
+	imports := fileImports(ifaceFile)
+	for _, field := range iface.Methods.List {
+		fn, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m, err := a.parseMethod(field.Names[0].Name, fn, imports)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s.%s: %w", fset.Position(field.Pos()), name, field.Names[0].Name, err)
+		}
+		m.Doc, directives = splitDoc(field.Doc)
+		m.RPC = directives[directiveMethod]
+		if m.RPC == "" {
+			m.RPC = lowerFirst(m.Name)
+			if prefix != "" {
+				m.RPC = prefix + "." + m.RPC
+			}
+		}
+		a.Methods = append(a.Methods, m)
+	}
+	return a, nil
+}
+
+// parseMethod checks a method signature: (ctx context.Context[, params P]) ([R, ]error)
+func (a *api) parseMethod(name string, fn *ast.FuncType, imports map[string]string) (*method, error) {
+	m := &method{Name: name}
+
+	var params []ast.Expr
+	for _, field := range fn.Params.List {
+		for range max(len(field.Names), 1) {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) == 0 || len(params) > 2 || a.expr(params[0]) != "context.Context" || imports["context"] != "context" {
+		return nil, fmt.Errorf("want (ctx context.Context[, params P]) parameters")
+	}
+	if len(params) == 2 {
+		if _, ok := params[1].(*ast.Ellipsis); ok {
+			return nil, fmt.Errorf("variadic params are not supported")
+		}
+		m.params = params[1]
+	}
+
+	var results []ast.Expr
+	if fn.Results != nil {
+		for _, field := range fn.Results.List {
+			for range max(len(field.Names), 1) {
+				results = append(results, field.Type)
+			}
+		}
+	}
+	if len(results) == 0 || len(results) > 2 || a.expr(results[len(results)-1]) != "error" {
+		return nil, fmt.Errorf("want ([result R, ]error) results")
+	}
+	if len(results) == 2 {
+		m.result = results[0]
+	}
+
+	for _, expr := range []ast.Expr{m.params, m.result} {
+		if expr == nil {
+			continue
+		}
+		var missing string
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok {
+					if path, ok := imports[pkg.Name]; ok {
+						a.Imports[pkg.Name] = path
+					} else {
+						missing = pkg.Name
+					}
+				}
+				return false
+			}
+			return true
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("unknown package %s", missing)
+		}
+	}
+	m.Params, m.Result = a.expr(m.params), a.expr(m.result)
+	return m, nil
+}
+
+// expr formats a type expression as Go source
+func (a *api) expr(expr ast.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, a.fset, expr); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// fileImports maps the package names of a file's imports to their paths
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := baseName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+// splitDoc separates //gmgen: directives from the text of a doc comment
+func splitDoc(doc *ast.CommentGroup) ([]string, map[string]string) {
+	directives := make(map[string]string)
+	if doc == nil {
+		return nil, directives
+	}
+	for _, c := range doc.List {
+		if text, ok := strings.CutPrefix(c.Text, "//gmgen:"); ok {
+			key, value, _ := strings.Cut(text, " ")
+			directives["gmgen:"+key] = strings.TrimSpace(value)
+		}
+	}
+	// Text drops directive comments
+	text := strings.TrimRight(doc.Text(), "\n")
+	if text == "" {
+		return nil, directives
+	}
+	return strings.Split(text, "\n"), directives
+}
+
+// lowerFirst lower-cases the leading upper-case run of a Go name: List -> list, HTTPPing -> httpPing
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// baseName returns the last element of an import path, the package name by convention
+func baseName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// tsModule renders the TypeScript declarations and JavaScript wrappers of an API
+type tsModule struct {
+	api      *api
+	declared map[string]bool // Local types already emitted or being emitted
+	decls    []string        // Emitted type declarations in dependency order
+}
+
+// generateTS renders the .d.ts declarations and the .js wrappers of the API
+// The wrappers call request<T>(method, params) imported from sdk, or the global request
+// expression if it is set
+func generateTS(a *api, sdk, request string) (dts, js []byte) {
+	m := &tsModule{api: a, declared: make(map[string]bool)}
+	call := request
+	if call == "" {
+		call = "request"
+	}
+
+	var sig, impl strings.Builder
+	object := lowerFirst(a.Name)
+	writeDoc(&sig, "", a.Doc)
+	fmt.Fprintf(&sig, "export declare const %s: {\n", object)
+	fmt.Fprintf(&impl, "export const %s = {\n", object)
+	for _, method := range a.Methods {
+		params, arg, result := "", "null", "void"
+		if method.params != nil {
+			params, arg = "params: "+m.tsType(method.params), "params"
+		}
+		if method.result != nil {
+			result = m.tsType(method.result)
+		}
+		doc := append(append([]string(nil), method.Doc...), "@remarks Calls "+method.RPC)
+		writeDoc(&sig, "  ", doc)
+		fmt.Fprintf(&sig, "  %s(%s): Promise<%s>;\n", method.propertyName(), params, result)
+
+		fmt.Fprintf(&impl, "  %s: (%s) => %s(%q, %s),\n", method.propertyName(), strings.TrimSuffix(arg, "null"), call, method.RPC, arg)
+	}
+	sig.WriteString("};\n")
+	impl.WriteString("};\n")
+
+	header := fmt.Sprintf("// Code generated by gmgen -type %s; DO NOT EDIT.\n\n", a.Name)
+	var d strings.Builder
+	d.WriteString(header)
+	for _, decl := range m.decls {
+		d.WriteString(decl)
+		d.WriteString("\n")
+	}
+	d.WriteString(sig.String())
+
+	var j strings.Builder
+	j.WriteString(header)
+	if request == "" {
+		fmt.Fprintf(&j, "import { request } from %q;\n\n", sdk)
+	}
+	j.WriteString(impl.String())
+	return []byte(d.String()), []byte(j.String())
+}
+
+// propertyName returns the name of the method on the generated object
+func (m *method) propertyName() string {
+	return lowerFirst(m.Name)
+}
+
+// tsType maps a Go type expression to TypeScript, declaring the local types it uses
+func (m *tsModule) tsType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if ts, ok := basicTypes[t.Name]; ok {
+			return ts
+		}
+		if spec, ok := m.api.types[t.Name]; ok {
+			m.declare(spec)
+			return t.Name
+		}
+		return "unknown"
+	case *ast.StarExpr:
+		return m.tsType(t.X) + " | null"
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") {
+			// encoding/json sends byte slices as base64 strings
+			return "string"
+		}
+		elem := m.tsType(t.Elt)
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case *ast.MapType:
+		return fmt.Sprintf("Record<string, %s>", m.tsType(t.Value))
+	case *ast.SelectorExpr:
+		switch m.api.expr(t) {
+		case "time.Time":
+			return "string"
+		case "time.Duration":
+			return "number"
+		}
+		return "unknown"
+	case *ast.StructType:
+		return m.structBody(t, "")
+	}
+	return "unknown"
+}
+
+// declare emits the declaration of a local type once
+func (m *tsModule) declare(spec *ast.TypeSpec) {
+	name := spec.Name.Name
+	if m.declared[name] {
+		return
+	}
+	m.declared[name] = true
+
+	var b strings.Builder
+	doc, _ := splitDoc(spec.Doc)
+	writeDoc(&b, "", doc)
+	if st, ok := spec.Type.(*ast.StructType); ok && spec.TypeParams == nil {
+		var extends []string
+		body := m.structBody(st, "", &extends)
+		fmt.Fprintf(&b, "export interface %s", name)
+		if len(extends) > 0 {
+			fmt.Fprintf(&b, " extends %s", strings.Join(extends, ", "))
+		}
+		fmt.Fprintf(&b, " %s\n", body)
+	} else if spec.TypeParams == nil {
+		fmt.Fprintf(&b, "export type %s = %s;\n", name, m.tsType(spec.Type))
+	} else {
+		fmt.Fprintf(&b, "export type %s = unknown;\n", name)
+	}
+	m.decls = append(m.decls, b.String())
+}
+
+// structBody renders the fields of a struct as a TypeScript object type
+// Embedded local structs are added to extends when given, as encoding/json flattens them
+func (m *tsModule) structBody(st *ast.StructType, indent string, extends ...*[]string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, field := range st.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			if raw, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tag = reflect.StructTag(raw).Get("json")
+			}
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		optional := strings.Contains(","+opts+",", ",omitempty,") || strings.Contains(","+opts+",", ",omitzero,")
+
+		if len(field.Names) == 0 {
+			typeName := strings.TrimPrefix(m.api.expr(field.Type), "*")
+			typeName = typeName[strings.LastIndex(typeName, ".")+1:]
+			if !ast.IsExported(typeName) {
+				continue
+			}
+			if _, local := m.api.types[typeName]; local && name == "" && len(extends) > 0 && !strings.Contains(m.api.expr(field.Type), ".") {
+				*extends[0] = append(*extends[0], m.tsType(ast.NewIdent(typeName)))
+				continue
+			}
+			if name == "" {
+				name = typeName
+			}
+			m.writeField(&b, indent, field, name, optional, m.tsType(field.Type))
+			continue
+		}
+
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			fieldName := name
+			if fieldName == "" {
+				fieldName = ident.Name
+			}
+			m.writeField(&b, indent, field, fieldName, optional, m.tsType(field.Type))
+		}
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// writeField writes one field of an object type
+func (m *tsModule) writeField(b *strings.Builder, indent string, field *ast.Field, name string, optional bool, typ string) {
+	doc, _ := splitDoc(field.Doc)
+	if len(doc) == 0 && field.Comment != nil {
+		doc, _ = splitDoc(field.Comment)
+	}
+	writeDoc(b, indent+"  ", doc)
+	if !isIdentifier(name) {
+		name = strconv.Quote(name)
+	}
+	if optional {
+		name += "?"
+	}
+	if st, ok := field.Type.(*ast.StructType); ok {
+		typ = m.structBody(st, indent+"  ")
+	}
+	fmt.Fprintf(b, "%s  %s: %s;\n", indent, name, typ)
+}
+
+// writeDoc writes lines as a JSDoc comment
+func writeDoc(b *strings.Builder, indent string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if len(lines) == 1 {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, lines[0])
+		return
+	}
+	fmt.Fprintf(b, "%s/**\n", indent)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s * %s\n", indent, strings.TrimRight(line, " "))
+	}
+	fmt.Fprintf(b, "%s */\n", indent)
+}
+
+// isIdentifier reports whether name can be used unquoted as a property name
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if r != '_' && r != '$' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && (i == 0 || !(r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// basicTypes maps predeclared Go types to TypeScript
+var basicTypes = map[string]string{
+	"string": "string", "bool": "boolean", "any": "unknown", "error": "string",
+	"int": "number", "int8": "number", "int16": "number", "int32": "number", "int64": "number",
+	"uint": "number", "uint8": "number", "uint16": "number", "uint32": "number", "uint64": "number",
+	"float32": "number", "float64": "number", "byte": "number", "rune": "number", "uintptr": "number",
+}
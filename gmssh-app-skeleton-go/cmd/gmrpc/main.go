@@ -0,0 +1,194 @@
+// Command gmrpc calls gsock apps from a shell
+//
+//	gmrpc -s app.sock call file.list '{"path":"/"}'
+//	gmrpc -s app.sock methods
+//	gmrpc -s app.sock subscribe events.subscribe '{"topic":"disk.*"}'
+//	gmrpc -s app.sock            # interactive REPL
+//
+// Responses are printed as indented JSON, or as received with -raw. A call whose
+// response code is not 200 exits with status 1
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `Usage: gmrpc -s <socket> [flags] [command]
+
+Commands:
+  call <method> [params]       Call a method and print the response
+  notify <method> [params]     Send a notification
+  methods                      List the methods served (rpc.methods)
+  subscribe <method> [params]  Call a method, then print notifications until interrupted
+  repl                         Interactive session (default)
+
+Params are a JSON value, e.g. '{"path":"/"}'
+
+Flags:
+`
+
+// errFailedResponse reports a response whose code is not 200; the response itself was printed
+var errFailedResponse = errors.New("request failed")
+
+// errMethodsNotListed reports an app answering rpc.methods with 404
+var errMethodsNotListed = errors.New("the app does not list its methods (rpc.methods is off, see gsock.WithJsonRpcSimpleServiceHandlerMethods)")
+
+// metaFlag collects repeated -meta key=value flags
+type metaFlag map[string]any
+
+func (m metaFlag) String() string {
+	return fmt.Sprint(map[string]any(m))
+}
+
+func (m metaFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[key] = val
+	return nil
+}
+
+// config holds the command line flags
+type config struct {
+	socket   string        // Socket path, or host:port for tcp
+	network  string        // unix or tcp
+	framing  string        // vscode (Content-Length headers) or plain (concatenated JSON)
+	compress bool          // Negotiate payload compression
+	msgpack  bool          // Negotiate MessagePack payloads
+	raw      bool          // Print responses as received
+	timeout  time.Duration // Dial and per-call timeout
+	history  string        // REPL history file (empty = none)
+	meta     metaFlag      // Sent as request meta
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes gmrpc with the given arguments and returns the exit status
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := &config{meta: make(metaFlag)}
+	flags := flag.NewFlagSet("gmrpc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&cfg.socket, "s", os.Getenv("GMRPC_SOCKET"), "socket path, or host:port with -network tcp (default $GMRPC_SOCKET)")
+	flags.StringVar(&cfg.network, "network", "unix", "transport: unix or tcp")
+	flags.StringVar(&cfg.framing, "framing", "vscode", "message framing: vscode (Content-Length headers) or plain")
+	flags.BoolVar(&cfg.compress, "compress", false, "negotiate zstd/gzip payload compression (vscode framing only)")
+	flags.BoolVar(&cfg.msgpack, "msgpack", false, "negotiate MessagePack payloads (vscode framing only)")
+	flags.BoolVar(&cfg.raw, "raw", false, "print responses as received instead of indented")
+	flags.DurationVar(&cfg.timeout, "timeout", 30*time.Second, "dial and call timeout")
+	flags.StringVar(&cfg.history, "history", defaultHistory(), "REPL history file, empty to disable")
+	flags.Var(cfg.meta, "meta", "request meta as key=value, repeatable")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if cfg.socket == "" {
+		fmt.Fprintln(stderr, "gmrpc: no socket, use -s")
+		flags.Usage()
+		return 2
+	}
+
+	command, rest := "repl", flags.Args()
+	if len(rest) > 0 {
+		command, rest = rest[0], rest[1:]
+	}
+
+	s, err := dial(ctx, cfg, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "gmrpc: %v\n", err)
+		return 1
+	}
+	defer s.close()
+
+	switch command {
+	case "call", "notify", "subscribe":
+		if len(rest) < 1 || len(rest) > 2 {
+			fmt.Fprintf(stderr, "gmrpc: usage: %s <method> [params]\n", command)
+			return 2
+		}
+		params := ""
+		if len(rest) == 2 {
+			params = rest[1]
+		}
+		switch command {
+		case "call":
+			err = s.call(ctx, rest[0], params)
+		case "notify":
+			err = s.notify(ctx, rest[0], params)
+		default:
+			err = s.subscribe(ctx, rest[0], params, stderr)
+		}
+	case "methods":
+		err = s.methods(ctx)
+	case "repl":
+		err = s.repl(ctx, stdin)
+	default:
+		fmt.Fprintf(stderr, "gmrpc: unknown command %q\n", command)
+		flags.Usage()
+		return 2
+	}
+
+	switch {
+	case errors.Is(err, errFailedResponse):
+		return 1
+	case err != nil:
+		fmt.Fprintf(stderr, "gmrpc: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// defaultHistory returns ~/.gmrpc_history, or no history if the home directory is unknown
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gmrpc_history")
+}
+
+// parseParams validates params given on the command line; empty params are sent as null
+func parseParams(params string) (json.RawMessage, error) {
+	params = strings.TrimSpace(params)
+	if params == "" {
+		return nil, nil
+	}
+	if !json.Valid([]byte(params)) {
+		return nil, fmt.Errorf("params are not valid JSON: %s", params)
+	}
+	return json.RawMessage(params), nil
+}
+
+// responseCode returns the code of a response envelope, 200 for other JSON values
+func responseCode(result json.RawMessage) int {
+	var envelope struct {
+		Code *int `json:"code"`
+	}
+	if json.Unmarshal(result, &envelope) != nil || envelope.Code == nil {
+		return http.StatusOK
+	}
+	return *envelope.Code
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writers and readers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestSocket serves a few methods on a temporary socket
+func newTestSocket(t *testing.T, opts ...gsock.JsonRpcSimpleServiceHandlerOptionFunc) string {
+	handler := gsock.NewJsonRpcSimpleServiceHandler(opts...)
+	handler.RegisterHandle("ping", handler.Ping)
+	handler.RegisterHandle("file.list", func(req *gsock.Request) (any, error) {
+		var params struct{ Path string }
+		if err := json.Unmarshal(*req.RawRequest().Params, &params); err != nil {
+			return nil, err
+		}
+		if params.Path != "/" {
+			return nil, gerror.CodeFileNotExistsError
+		}
+		return []string{"/etc", "/var"}, nil
+	})
+	handler.RegisterHandle("whoami", func(req *gsock.Request) (any, error) {
+		return req.MetaString("user"), nil
+	})
+	handler.RegisterHandle("events.subscribe", func(req *gsock.Request) (any, error) {
+		conn := req.Conn()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			conn.Notify(context.Background(), "events.notify", map[string]any{"topic": "disk.full"})
+		}()
+		return true, nil
+	})
+
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	t.Cleanup(cleanup)
+	return client.SocketPath
+}
+
+func TestCall(t *testing.T) {
+	socket := newTestSocket(t)
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-s", socket, "-raw", "call", "file.list", `{"path":"/"}`}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"data":["/etc","/var"]`) {
+		t.Fatalf("unexpected output %s", stdout.String())
+	}
+
+	// Error responses are printed and exit with status 1
+	stdout.Reset()
+	code = run(context.Background(), []string{"-s", socket, "call", "file.list", `{"path":"/nope"}`}, nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stdout.String(), `"code": 400`) {
+		t.Fatalf("exit %d, output %s", code, stdout.String())
+	}
+
+	stdout.Reset()
+	code = run(context.Background(), []string{"-s", socket, "-meta", "user=alice", "-raw", "call", "whoami"}, nil, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), `"data":"alice"`) {
+		t.Fatalf("exit %d, output %s", code, stdout.String())
+	}
+
+	if code := run(context.Background(), []string{"-s", socket, "call", "file.list", "{bad"}, nil, &stdout, &stderr); code != 1 {
+		t.Fatalf("invalid params exit %d", code)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	socket := newTestSocket(t, gsock.WithJsonRpcSimpleServiceHandlerMethods(nil))
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-s", socket, "methods"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if got := stdout.String(); got != "events.subscribe\nfile.list\nping\nwhoami\n" {
+		t.Fatalf("unexpected methods %q", got)
+	}
+
+	// Apps that don't list their methods get a hint instead of a bare 404
+	stdout.Reset()
+	stderr.Reset()
+	if code := run(context.Background(), []string{"-s", newTestSocket(t), "methods"}, nil, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "does not list its methods") {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+}
+
+func TestREPL(t *testing.T) {
+	socket := newTestSocket(t)
+	historyFile := filepath.Join(t.TempDir(), "history")
+
+	input := strings.Join([]string{"ping", ".raw", `file.list {"path":"/"}`, "!1", ".history", ".bogus", ".quit"}, "\n")
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-s", socket, "-history", historyFile}, strings.NewReader(input), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		`"data": "pong"`,               // Pretty output first
+		`"data":["/etc","/var"]`,       // Raw after .raw
+		`"data":"pong"`,                // !1 runs ping again
+		`   3  file.list {"path":"/"}`, // History listing
+		"error: unknown command .bogus",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil || string(data) != "ping\n.raw\nfile.list {\"path\":\"/\"}\nping\n.bogus\n" {
+		t.Fatalf("history file %q, %v", data, err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	socket := newTestSocket(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout := &syncBuffer{}
+	go func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(stdout.String(), "<- events.notify") && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+
+	var stderr bytes.Buffer
+	code := run(ctx, []string{"-s", socket, "-raw", "subscribe", "events.subscribe", `{"topic":"disk.*"}`}, nil, stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if want := `<- events.notify {"topic":"disk.full"}`; !strings.Contains(stdout.String(), want) {
+		t.Fatalf("output lacks %q:\n%s", want, stdout.String())
+	}
+}
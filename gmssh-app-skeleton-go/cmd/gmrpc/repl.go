@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `  <method> [params]          call a method, e.g. file.list {"path":"/"}
+  .notify <method> [params]  send a notification
+  .methods                   list the methods served
+  .history                   show the history
+  !N, !!                     run history entry N, or the last one
+  .raw, .pretty              switch the output format
+  .help                      show this help
+  .quit                      leave (or Ctrl-D)
+`
+
+// history keeps the lines entered in the REPL, mirrored to a file
+type history struct {
+	lines []string
+	file  *os.File // Appended to; nil when history is not persisted
+}
+
+// loadHistory reads the history file and opens it for appending
+func loadHistory(path string) *history {
+	h := &history{}
+	if path == "" {
+		return h
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				h.lines = append(h.lines, line)
+			}
+		}
+	}
+	h.file, _ = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	return h
+}
+
+// add records a line
+func (h *history) add(line string) {
+	h.lines = append(h.lines, line)
+	if h.file != nil {
+		fmt.Fprintln(h.file, line)
+	}
+}
+
+// expand resolves !N and !! references
+func (h *history) expand(line string) (string, error) {
+	if !strings.HasPrefix(line, "!") {
+		return line, nil
+	}
+	if line == "!!" {
+		if len(h.lines) == 0 {
+			return "", errors.New("history is empty")
+		}
+		return h.lines[len(h.lines)-1], nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(h.lines) {
+		return "", fmt.Errorf("no history entry %s", line[1:])
+	}
+	return h.lines[n-1], nil
+}
+
+// close closes the history file
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
+
+// repl reads commands from in until EOF or .quit
+// Failed calls are reported and the session goes on
+func (s *session) repl(ctx context.Context, in io.Reader) error {
+	hist := loadHistory(s.cfg.history)
+	defer hist.close()
+
+	s.printf("connected to %s, .help for help\n", s.cfg.socket)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for {
+		s.printf("gmrpc> ")
+		if !scanner.Scan() {
+			s.printf("\n")
+			return scanner.Err()
+		}
+
+		line, err := hist.expand(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			s.printf("error: %v\n", err)
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if line == ".quit" || line == ".exit" {
+			return nil
+		}
+		if line != ".history" {
+			hist.add(line)
+		}
+
+		if err := s.exec(ctx, line, hist); err != nil && !errors.Is(err, errFailedResponse) {
+			s.printf("error: %v\n", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// exec runs one REPL line
+func (s *session) exec(ctx context.Context, line string, hist *history) error {
+	command, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch command {
+	case ".help":
+		s.printf("%s", replHelp)
+	case ".methods":
+		return s.methods(ctx)
+	case ".history":
+		for i, entry := range hist.lines {
+			s.printf("%4d  %s\n", i+1, entry)
+		}
+	case ".raw", ".pretty":
+		s.mu.Lock()
+		s.raw = command == ".raw"
+		s.mu.Unlock()
+	case ".notify":
+		method, params, _ := strings.Cut(args, " ")
+		if method == "" {
+			return errors.New("usage: .notify <method> [params]")
+		}
+		return s.notify(ctx, method, params)
+	default:
+		if strings.HasPrefix(command, ".") {
+			return fmt.Errorf("unknown command %s, .help for help", command)
+		}
+		return s.call(ctx, command, args)
+	}
+	return nil
+}
+
+// printf writes REPL output
+func (s *session) printf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.out, format, args...)
+}
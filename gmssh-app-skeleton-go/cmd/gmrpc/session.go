@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// session is one connection to an app
+type session struct {
+	cfg    *config
+	mu     sync.Mutex // Serializes output of responses and notifications
+	out    io.Writer
+	raw    bool                              // Print responses as received; toggled in the REPL
+	client *gsock.JsonRpcSimpleClientHandler // Connection to the app
+}
+
+// dial connects to the app with the configured transport, framing, compression and payload format
+func dial(ctx context.Context, cfg *config, out io.Writer) (*session, error) {
+	s := &session{cfg: cfg, out: out, raw: cfg.raw}
+	opts := []gsock.JsonRpcSimpleClientOptFunc{gsock.WithJsonRpcSimpleClientFallback(s.notification)}
+	if cfg.compress {
+		if cfg.framing != "vscode" {
+			return nil, fmt.Errorf("compression requires vscode framing")
+		}
+		opts = append(opts, gsock.WithJsonRpcSimpleClientCompression(gsock.NewCompression(gsock.DefaultCompressThreshold)))
+	}
+	if cfg.msgpack {
+		if cfg.framing != "vscode" {
+			return nil, fmt.Errorf("msgpack requires vscode framing")
+		}
+		opts = append(opts, gsock.WithJsonRpcSimpleClientFormats(gsock.FormatMsgpack))
+	}
+	adapter := gsock.NewJsonRpcSimpleClient(opts...)
+
+	var codec jsonrpc2.ObjectCodec
+	switch cfg.framing {
+	case "vscode":
+	case "plain":
+		codec = jsonrpc2.PlainObjectCodec{}
+	default:
+		return nil, fmt.Errorf("unknown framing %q", cfg.framing)
+	}
+
+	dialer := net.Dialer{Timeout: cfg.timeout}
+	conn, err := dialer.DialContext(ctx, cfg.network, cfg.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if codec == nil {
+		s.client = adapter.NewConn(ctx, conn).(*gsock.JsonRpcSimpleClientHandler)
+		return s, nil
+	}
+	s.client = gsock.NewJsonRpcSimpleClientHandler(jsonrpc2.NewConn(
+		ctx,
+		jsonrpc2.NewBufferedStream(conn, codec),
+		jsonrpc2.AsyncHandler(jsonrpc2.HandlerWithError(adapter.Handle)),
+	))
+	return s, nil
+}
+
+// close closes the connection
+func (s *session) close() {
+	s.client.Close()
+}
+
+// callOpts returns the call options carrying the configured meta
+func (s *session) callOpts() []jsonrpc2.CallOption {
+	if len(s.cfg.meta) == 0 {
+		return nil
+	}
+	return []jsonrpc2.CallOption{jsonrpc2.Meta(map[string]any(s.cfg.meta))}
+}
+
+// call calls a method and prints the response
+func (s *session) call(ctx context.Context, method, params string) error {
+	p, err := parseParams(params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.timeout)
+	defer cancel()
+	var result json.RawMessage
+	if err := s.client.Request(ctx, method, p, &result, s.callOpts()...); err != nil {
+		return err
+	}
+
+	s.print("", result)
+	if responseCode(result) != http.StatusOK {
+		return errFailedResponse
+	}
+	return nil
+}
+
+// notify sends a notification
+func (s *session) notify(ctx context.Context, method, params string) error {
+	p, err := parseParams(params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.timeout)
+	defer cancel()
+	return s.client.Notify(ctx, method, p, s.callOpts()...)
+}
+
+// methods prints the methods the app serves
+func (s *session) methods(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.timeout)
+	defer cancel()
+	methods, err := gsock.Call[[]string](ctx, s.client, gsock.MethodMethods, nil, gsock.WithCallRPCOption(s.callOpts()...))
+	var exception gerror.Exception
+	if errors.As(err, &exception) && exception.Code() == http.StatusNotFound {
+		return errMethodsNotListed
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, method := range methods {
+		fmt.Fprintln(s.out, method)
+	}
+	return nil
+}
+
+// subscribe calls a method, then prints notifications until ctx ends or the app disconnects
+func (s *session) subscribe(ctx context.Context, method, params string, status io.Writer) error {
+	if err := s.call(ctx, method, params); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(status, "waiting for notifications, press Ctrl-C to stop")
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-s.client.DisconnectNotify():
+		return fmt.Errorf("connection closed by the app")
+	}
+}
+
+// notification prints a call or notification sent by the app
+func (s *session) notification(req *gsock.Request) (any, error) {
+	var params json.RawMessage
+	if p := req.RawRequest().Params; p != nil {
+		params = *p
+	}
+	s.print("<- "+req.Method()+" ", params)
+	return nil, nil
+}
+
+// print writes a JSON value, indented unless raw output is selected
+func (s *session) print(prefix string, value json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(value) == 0 {
+		value = json.RawMessage("null")
+	}
+	if !s.raw {
+		var indented bytes.Buffer
+		if json.Indent(&indented, value, "", "  ") == nil {
+			value = indented.Bytes()
+		}
+	}
+	fmt.Fprintf(s.out, "%s%s\n", prefix, value)
+}
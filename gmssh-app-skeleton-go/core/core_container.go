@@ -111,6 +111,18 @@ func InitContainer(opts ...config.WithConfigOptionFunc) IContainer {
 		panic(err)
 	}
 
+	// Initialize global container
+	Container = NewContainer(
+		WithContainerLoggerOption(logger),
+		WithContainerConfigOption(cfg),
+		WithContainerValidOption(NewDefaultStructWalker()),
+	)
+	return Container
+}
+
+// NewDefaultStructWalker creates the validator used by InitContainer,
+// reading rules from the "validate" tag
+func NewDefaultStructWalker() *gvalid.StructWalker {
 	// Initialize validation components
 	visitor := gvalid.NewValidatorVisitor()
 
@@ -120,15 +132,7 @@ func InitContainer(opts ...config.WithConfigOptionFunc) IContainer {
 	visitor.RegisterValidator("range", &gvalid.RangeValidator{})
 
 	// Create struct walker with "validate" tag
-	walker := gvalid.NewStructWalker(visitor, "validate")
-
-	// Initialize global container
-	Container = NewContainer(
-		WithContainerLoggerOption(logger),
-		WithContainerConfigOption(cfg),
-		WithContainerValidOption(walker),
-	)
-	return Container
+	return gvalid.NewStructWalker(visitor, "validate")
 }
 
 // GetValueStringFormConfigWithOutErr safely gets a string config value (returns empty string on error)
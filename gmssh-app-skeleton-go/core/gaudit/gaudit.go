@@ -0,0 +1,39 @@
+package gaudit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrChainBroken is returned (wrapped) by the verifier when an entry does not
+// match its hash or does not link to the previous entry
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Entry is a single line of the append-only audit log
+// Every entry carries the hash of its predecessor, so removing, reordering or
+// editing any line invalidates the rest of the chain
+type Entry struct {
+	Seq      uint64          `json:"seq"`             // Monotonic sequence number, continues across rotated files
+	Time     time.Time       `json:"time"`            // UTC time the operation finished
+	Who      string          `json:"who"`             // Caller identity taken from the request meta
+	Method   string          `json:"method"`          // RPC method name
+	Args     json.RawMessage `json:"args,omitempty"`  // Redacted, canonicalized request params
+	Code     int             `json:"code"`            // Result code returned to the caller, the exception code for failures
+	Error    string          `json:"error,omitempty"` // Error message when the handler failed
+	PrevHash string          `json:"prevHash"`        // Hash of the previous entry (empty for the first one)
+	Hash     string          `json:"hash"`            // SHA-256 of this entry with Hash left empty
+}
+
+// computeHash returns the hex encoded SHA-256 of the entry with its Hash field cleared
+func computeHash(entry Entry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,274 @@
+package gaudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size in bytes after which the active file is rotated
+const DefaultMaxSize int64 = 10 << 20 // 10MB
+
+// maxLineSize bounds a single JSONL line when reading files back
+const maxLineSize = 4 << 20
+
+// LoggerOptFunc defines functions for configuring an audit Logger
+type LoggerOptFunc func(*Logger)
+
+// WithMaxSizeOption sets the rotation threshold in bytes (<= 0 disables rotation)
+func WithMaxSizeOption(size int64) LoggerOptFunc {
+	return func(l *Logger) {
+		l.maxSize = size
+	}
+}
+
+// WithRedactKeysOption replaces the list of argument names that are masked before writing
+func WithRedactKeysOption(keys ...string) LoggerOptFunc {
+	return func(l *Logger) {
+		l.redactKeys = redactKeySet(keys)
+	}
+}
+
+// Logger is an append-only, hash chained JSONL audit log
+// It is safe for concurrent use
+type Logger struct {
+	mu         sync.Mutex
+	path       string              // Active file path (e.g. "logs/audit.jsonl")
+	file       *os.File            // Active file handle
+	size       int64               // Current size of the active file
+	maxSize    int64               // Rotation threshold
+	seq        uint64              // Sequence of the last written entry
+	lastHash   string              // Hash of the last written entry
+	redactKeys map[string]struct{} // Lower-cased argument names to mask
+}
+
+// New opens (or creates) the audit log at path
+// If the log already contains entries, the chain continues from the last one,
+// including entries found in previously rotated files
+func New(path string, opts ...LoggerOptFunc) (*Logger, error) {
+	l := &Logger{
+		path:       path,
+		maxSize:    DefaultMaxSize,
+		redactKeys: redactKeySet(DefaultRedactKeys),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create audit directory failed: %w", err)
+	}
+
+	files, err := l.Files()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := readLastEntry(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq = last.Seq
+			l.lastHash = last.Hash
+			break
+		}
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record builds an entry from the given values and appends it to the log
+// params are the raw JSON params of the request; sensitive keys are redacted
+func (l *Logger) Record(who, method string, params []byte, code int, cause error) (*Entry, error) {
+	args, err := canonicalArgs(params, l.redactKeys)
+	if err != nil {
+		// Keep the operation on record even if the params are not valid JSON
+		args, _ = json.Marshal(RedactedValue)
+	}
+
+	entry := &Entry{
+		Time:   time.Now().UTC(),
+		Who:    who,
+		Method: method,
+		Args:   args,
+		Code:   code,
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+	if err := l.Append(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Append links the entry to the chain, fills Seq, PrevHash and Hash, and writes it
+func (l *Logger) Append(entry *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log %s is closed", l.path)
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	entry.Seq = l.seq + 1
+	entry.PrevHash = l.lastHash
+	hash, err := computeHash(*entry)
+	if err != nil {
+		return fmt.Errorf("hash audit entry failed: %w", err)
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode audit entry failed: %w", err)
+	}
+	line = append(line, '\n')
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit entry failed: %w", err)
+	}
+
+	l.seq = entry.Seq
+	l.lastHash = entry.Hash
+	return nil
+}
+
+// Files returns all files of the log in chain order: rotated files first, active file last
+func (l *Logger) Files() ([]string, error) {
+	ext := filepath.Ext(l.path)
+	pattern := strings.TrimSuffix(l.path, ext) + ".*" + ext
+	rotated, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rotated)
+
+	if _, err := os.Stat(l.path); err == nil {
+		rotated = append(rotated, l.path)
+	}
+	return rotated, nil
+}
+
+// Verify checks the complete chain of this log, including rotated files
+// Returns the number of verified entries
+func (l *Logger) Verify() (int, error) {
+	return l.VerifyAgainst(Checkpoint{})
+}
+
+// VerifyAgainst checks the complete chain of this log and that it still reaches head,
+// see the VerifyAgainst function
+// Returns the number of verified entries
+func (l *Logger) VerifyAgainst(head Checkpoint) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files, err := l.Files()
+	if err != nil {
+		return 0, err
+	}
+	return VerifyAgainst(head, files...)
+}
+
+// Checkpoint returns the position of the last written entry
+// Store it outside the log and pass it to VerifyAgainst later to detect removed entries
+func (l *Logger) Checkpoint() Checkpoint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Checkpoint{Seq: l.seq, Hash: l.lastHash}
+}
+
+// Close flushes and closes the active file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// open opens the active file in append mode
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log failed: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat audit log failed: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate moves the active file aside and starts a new one
+// Rotated files are named after the last sequence they contain, e.g. "audit.000000000042.jsonl",
+// so a lexical sort restores the chain order
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("close audit log failed: %w", err)
+	}
+	l.file = nil
+
+	ext := filepath.Ext(l.path)
+	target := fmt.Sprintf("%s.%012d%s", strings.TrimSuffix(l.path, ext), l.seq, ext)
+	if err := os.Rename(l.path, target); err != nil {
+		return fmt.Errorf("rotate audit log failed: %w", err)
+	}
+	return l.open()
+}
+
+// readLastEntry returns the last entry of a file, or nil if it has none
+func readLastEntry(path string) (*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var last *Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrChainBroken, path, err)
+		}
+		last = &entry
+	}
+	return last, scanner.Err()
+}
@@ -0,0 +1,84 @@
+package gaudit
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// DefaultWhoMetaKey is the request meta key holding the caller identity
+const DefaultWhoMetaKey = "user"
+
+// MiddlewareOptFunc defines functions for configuring the audit middleware
+type MiddlewareOptFunc func(*Middleware)
+
+// WithWhoOption sets how the caller identity is extracted from a request
+func WithWhoOption(who func(req *gsock.Request) string) MiddlewareOptFunc {
+	return func(m *Middleware) {
+		m.who = who
+	}
+}
+
+// Middleware records every call of the routes it is attached to
+// Attach it only to mutating routes:
+//
+//	audit := gaudit.NewMiddleware(auditLog)
+//	ds.RegisterHandle("user.create", hand.CreateUser, audit)
+type Middleware struct {
+	logger *Logger                         // Destination audit log
+	who    func(req *gsock.Request) string // Caller identity extractor
+}
+
+// NewMiddleware creates an audit middleware writing to logger
+func NewMiddleware(logger *Logger, opts ...MiddlewareOptFunc) *Middleware {
+	m := &Middleware{
+		logger: logger,
+		who: func(req *gsock.Request) string {
+			return req.MetaString(DefaultWhoMetaKey)
+		},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// ProcessRequest implements gsock.RPCMiddleware; auditing happens in WrapHandler
+func (m *Middleware) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware; auditing happens in WrapHandler
+func (m *Middleware) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper
+// The entry is written after the handler returns, so it carries the result code
+func (m *Middleware) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return func(req *gsock.Request) (any, error) {
+		body, err := next(req)
+
+		var params []byte
+		if raw := req.RawRequest(); raw != nil && raw.Params != nil {
+			params = *raw.Params
+		}
+
+		if _, auditErr := m.logger.Record(m.who(req), api, params, resultCode(body, err), err); auditErr != nil {
+			zap.L().Error("write audit entry failed", zap.String("method", api), zap.Error(auditErr))
+		}
+		return body, err
+	}
+}
+
+// resultCode returns the code the caller receives for a handler result: the code of a
+// response returned by the handler, or of the exception carried by the response built from
+// an error (e.g. gerror.CodeServerBusy), or 200
+func resultCode(body any, err error) int {
+	response, ok := body.(*gsock.Response)
+	if !ok || err != nil {
+		response = gsock.NewResponse().WithResult(body, err)
+	}
+	if exception := response.Exception(); exception != nil {
+		return exception.Code()
+	}
+	return response.Code
+}
@@ -0,0 +1,76 @@
+package gaudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// RedactedValue replaces the value of every sensitive argument
+const RedactedValue = "***"
+
+// DefaultRedactKeys lists argument names that are never written in clear text
+var DefaultRedactKeys = []string{"password", "passwd", "pwd", "token", "secret", "privateKey", "private_key"}
+
+// Redact masks the values of sensitive keys anywhere in a JSON document and re-encodes it with sorted keys
+// DefaultRedactKeys is used when no keys are given; an empty document yields nil
+func Redact(data []byte, keys ...string) (json.RawMessage, error) {
+	if len(keys) == 0 {
+		keys = DefaultRedactKeys
+	}
+	return canonicalArgs(data, redactKeySet(keys))
+}
+
+// canonicalArgs redacts sensitive keys and re-encodes params with sorted keys
+// Numbers are kept verbatim so that the stored form is stable across verification
+func canonicalArgs(params []byte, keys map[string]struct{}) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(params)) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(redact(value, keys))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// redact walks a decoded JSON value and masks fields whose name is in keys
+// Key matching is case-insensitive
+func redact(value any, keys map[string]struct{}) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if _, ok := keys[strings.ToLower(k)]; ok {
+				v[k] = RedactedValue
+				continue
+			}
+			v[k] = redact(item, keys)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redact(item, keys)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactKeySet normalizes key names for lookup
+func redactKeySet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[strings.ToLower(key)] = struct{}{}
+	}
+	return set
+}
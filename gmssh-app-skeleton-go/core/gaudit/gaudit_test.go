@@ -0,0 +1,194 @@
+package gaudit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func newAuditRequest(t *testing.T, method string, params, meta any) *gsock.Request {
+	req := &jsonrpc2.Request{Method: method}
+	if err := req.SetParams(params); err != nil {
+		t.Fatalf("set params failed: %v", err)
+	}
+	if err := req.SetMeta(meta); err != nil {
+		t.Fatalf("set meta failed: %v", err)
+	}
+	return gsock.MakeRequest(gsock.WithRequestReqOption(req))
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := New(path)
+	if err != nil {
+		t.Fatalf("open audit log failed: %v", err)
+	}
+	defer logger.Close()
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("user.create", func(req *gsock.Request) (any, error) {
+		return "ok", nil
+	}, NewMiddleware(logger))
+	handler.RegisterHandle("user.delete", func(req *gsock.Request) (any, error) {
+		return nil, gerror.CodeServerBusy
+	}, NewMiddleware(logger))
+
+	req := newAuditRequest(t, "user.create",
+		map[string]any{"name": "zack", "password": "hunter2"},
+		map[string]any{"user": "admin"},
+	)
+	if _, err := handler.Handle(req); err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log failed: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Fatalf("password was not redacted: %s", data)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("decode entry failed: %v", err)
+	}
+	if entry.Who != "admin" || entry.Method != "user.create" || entry.Code != 200 || entry.Seq != 1 {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+
+	// Failures are recorded with the code the caller decodes, not a generic 400
+	handler.Handle(newAuditRequest(t, "user.delete", map[string]any{"name": "zack"}, map[string]any{"user": "admin"}))
+	lines := strings.Split(strings.TrimSpace(readFile(t, path)), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry); err != nil {
+		t.Fatalf("decode entry failed: %v", err)
+	}
+	if entry.Method != "user.delete" || entry.Code != gerror.CodeServerBusy.Code() {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestAuditChainRotationAndTamper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := New(path, WithMaxSizeOption(400))
+	if err != nil {
+		t.Fatalf("open audit log failed: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := logger.Record("admin", "file.delete", []byte(`{"path":"/tmp/x"}`), 200, nil); err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+	}
+	logger.Close()
+
+	// Reopening continues the chain from the last rotated state
+	logger, err = New(path, WithMaxSizeOption(400))
+	if err != nil {
+		t.Fatalf("reopen audit log failed: %v", err)
+	}
+	if _, err := logger.Record("admin", "file.delete", nil, 400, errors.New("denied")); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	defer logger.Close()
+
+	files, err := logger.Files()
+	if err != nil || len(files) < 2 {
+		t.Fatalf("expected rotated files, got %v (%v)", files, err)
+	}
+	count, err := logger.Verify()
+	if err != nil || count != 11 {
+		t.Fatalf("verify failed: count=%d err=%v", count, err)
+	}
+
+	// Edit a single byte in the oldest file
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read audit log failed: %v", err)
+	}
+	tampered := strings.Replace(string(data), "/tmp/x", "/tmp/y", 1)
+	if err := os.WriteFile(files[0], []byte(tampered), 0600); err != nil {
+		t.Fatalf("write audit log failed: %v", err)
+	}
+	if _, err := logger.Verify(); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected tampering to be detected, got %v", err)
+	}
+
+	// Dropping a rotated file breaks the link between the remaining ones
+	if err := os.WriteFile(files[0], data, 0600); err != nil {
+		t.Fatalf("restore audit log failed: %v", err)
+	}
+	if _, err := Verify(append([]string{files[0]}, files[2:]...)...); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected missing file to be detected, got %v", err)
+	}
+
+	// A chain missing its head only verifies from the checkpoint of the archived files
+	if _, err := Verify(files[1:]...); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected missing head to be detected, got %v", err)
+	}
+	checkpoint, err := VerifyCheckpoint(files[0])
+	if err != nil {
+		t.Fatalf("verify archived file failed: %v", err)
+	}
+	if count, err := VerifyFrom(checkpoint, files[1:]...); err != nil || count != 11-int(checkpoint.Seq) {
+		t.Fatalf("verify from checkpoint failed: count=%d err=%v", count, err)
+	}
+	if _, err := VerifyFrom(checkpoint, files[2:]...); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected gap after checkpoint to be detected, got %v", err)
+	}
+}
+
+func TestAuditTailDeletionAgainstCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := New(path)
+	if err != nil {
+		t.Fatalf("open audit log failed: %v", err)
+	}
+	defer logger.Close()
+	for i := 0; i < 3; i++ {
+		logger.Record("admin", "file.delete", []byte(`{"path":"/tmp/x"}`), 200, nil)
+	}
+	head := logger.Checkpoint()
+	if head.Seq != 3 {
+		t.Fatalf("unexpected checkpoint %+v", head)
+	}
+	logger.Record("admin", "file.delete", nil, 200, nil)
+	if count, err := logger.VerifyAgainst(head); err != nil || count != 4 {
+		t.Fatalf("verify against checkpoint failed: count=%d err=%v", count, err)
+	}
+
+	// Dropping the newest entries leaves a valid chain that no longer reaches the checkpoint
+	lines := strings.SplitAfter(readFile(t, path), "\n")
+	if err := os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0600); err != nil {
+		t.Fatalf("write audit log failed: %v", err)
+	}
+	if _, err := logger.Verify(); err != nil {
+		t.Fatalf("truncated chain should verify on its own: %v", err)
+	}
+	if _, err := logger.VerifyAgainst(head); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected tail deletion to be detected, got %v", err)
+	}
+
+	// A chain rewritten from the checkpoint on does not match it either
+	os.WriteFile(path, []byte(strings.Join(lines, "")), 0600)
+	forged := Checkpoint{Seq: head.Seq, Hash: strings.Repeat("0", len(head.Hash))}
+	if _, err := logger.VerifyAgainst(forged); !errors.Is(err, ErrChainBroken) {
+		t.Fatalf("expected checkpoint mismatch, got %v", err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s failed: %v", path, err)
+	}
+	return string(data)
+}
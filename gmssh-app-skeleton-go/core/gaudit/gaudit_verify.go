@@ -0,0 +1,130 @@
+package gaudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Checkpoint is the position of the last entry of an already verified part of the chain
+// The zero Checkpoint is the genesis: the chain starts at seq 1 with an empty previous hash
+type Checkpoint struct {
+	Seq  uint64 `json:"seq"`  // Sequence of the last verified entry
+	Hash string `json:"hash"` // Hash of the last verified entry
+}
+
+// Verify checks the hash chain across files given in chain order, starting from the genesis
+// The first entry of each file must link to the last entry of the previous file,
+// so truncating, reordering or dropping a rotated file is detected as well.
+// A log whose oldest files were archived is checked with VerifyFrom instead.
+// Entries removed from the end of the chain leave a valid chain behind; use VerifyAgainst
+// with a checkpoint stored outside the log to detect that.
+// Returns the number of verified entries, or an error wrapping ErrChainBroken
+func Verify(paths ...string) (int, error) {
+	count, _, err := verify(Checkpoint{}, Checkpoint{}, paths)
+	return count, err
+}
+
+// VerifyAgainst checks the hash chain across files from the genesis, like Verify, and also
+// that it still contains the entry of head, a checkpoint taken earlier with Logger.Checkpoint
+// and stored where the log's writer cannot change it (another host, a remote syslog, ...).
+// Entries appended after head are accepted; a chain ending before head, e.g. because its
+// last entries or files were deleted, or rewritten from there on, is broken:
+//
+//	head := logger.Checkpoint() // shipped off the host every few minutes
+//	...
+//	count, err := gaudit.VerifyAgainst(head, files...)
+func VerifyAgainst(head Checkpoint, paths ...string) (int, error) {
+	count, _, err := verify(Checkpoint{}, head, paths)
+	return count, err
+}
+
+// VerifyFrom checks the hash chain across files continuing the chain at checkpoint
+// The checkpoint must come from a trusted source, typically VerifyCheckpoint run over
+// the archived files before they were moved away:
+//
+//	checkpoint, err := gaudit.VerifyCheckpoint(archived...)
+//	...
+//	count, err := gaudit.VerifyFrom(checkpoint, remaining...)
+func VerifyFrom(checkpoint Checkpoint, paths ...string) (int, error) {
+	count, _, err := verify(checkpoint, Checkpoint{}, paths)
+	return count, err
+}
+
+// VerifyCheckpoint checks the hash chain across files from the genesis, like Verify,
+// and returns the checkpoint of its last entry
+func VerifyCheckpoint(paths ...string) (Checkpoint, error) {
+	_, checkpoint, err := verify(Checkpoint{}, Checkpoint{}, paths)
+	return checkpoint, err
+}
+
+// verify checks the entries of paths against the chain ending at checkpoint and, unless head
+// is zero, that the chain reaches the entry of head
+// Returns the number of verified entries and the checkpoint of the last one
+func verify(checkpoint, head Checkpoint, paths []string) (int, Checkpoint, error) {
+	count := 0
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return count, checkpoint, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var entry Entry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				file.Close()
+				return count, checkpoint, fmt.Errorf("%w at %s:%d: %v", ErrChainBroken, path, line, err)
+			}
+			reason := checkEntry(entry, checkpoint)
+			if reason == "" && head.Seq != 0 && entry.Seq == head.Seq && entry.Hash != head.Hash {
+				reason = "entry does not match the checkpoint"
+			}
+			if reason != "" {
+				file.Close()
+				return count, checkpoint, fmt.Errorf("%w at %s:%d: %s", ErrChainBroken, path, line, reason)
+			}
+
+			checkpoint = Checkpoint{Seq: entry.Seq, Hash: entry.Hash}
+			count++
+		}
+
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return count, checkpoint, err
+		}
+	}
+	if checkpoint.Seq < head.Seq {
+		return count, checkpoint, fmt.Errorf("%w: chain ends at seq %d before checkpoint seq %d", ErrChainBroken, checkpoint.Seq, head.Seq)
+	}
+	return count, checkpoint, nil
+}
+
+// checkEntry validates a single entry against its predecessor
+// The first entry is checked against the genesis or the checkpoint the run starts from,
+// so a chain missing its head is rejected
+func checkEntry(entry Entry, prev Checkpoint) string {
+	hash, err := computeHash(entry)
+	if err != nil {
+		return err.Error()
+	}
+	if hash != entry.Hash {
+		return "entry hash mismatch"
+	}
+	if entry.Seq != prev.Seq+1 {
+		return fmt.Sprintf("sequence gap: expected %d, got %d", prev.Seq+1, entry.Seq)
+	}
+	if entry.PrevHash != prev.Hash {
+		return "previous hash mismatch"
+	}
+	return ""
+}
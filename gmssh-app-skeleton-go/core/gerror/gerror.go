@@ -70,6 +70,7 @@ var (
 	CodeAddShortcutExistsError    = localCode{code: 200217, message: "shortcuts exists", detail: nil, i18n: ""}              // 快捷方式已存在。
 	CodeAddShortcutError          = localCode{code: 200218, message: "Add shortcuts failed", detail: nil, i18n: ""}          // 创建快捷方式失败。
 	CodeResponseReadError         = localCode{code: 200219, message: "Read response failed", detail: nil, i18n: ""}          // 创建快捷方式失败。
+	CodeFileReadError             = localCode{code: 200220, message: "File read failed", detail: nil, i18n: ""}              // 文件读取失败。
 
 	CodeUserHomeError            = localCode{code: 200100, message: "Failed to retrieve the user's home directory", detail: nil, i18n: ""} // 获取用户主目录失败， 注意：用户相关的错误从100开始
 	CodeBusinessValidationFailed = localCode{code: 200300, message: "Business Validation Failed", detail: nil, i18n: ""}                   // 业务验证失败。
@@ -0,0 +1,67 @@
+package glog
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levels holds the level of every logger created by NewLogger
+// Each logger keeps its configured level until SetLevel changes them all at runtime
+var levels = &levelRegistry{current: zapcore.InfoLevel}
+
+// levelRegistry tracks the atomic levels of created loggers
+type levelRegistry struct {
+	mu      sync.Mutex
+	levels  []zap.AtomicLevel
+	current zapcore.Level // Last level set, or the level of the latest logger
+}
+
+// register creates the atomic level of a new logger
+func (r *levelRegistry) register(level zapcore.Level) zap.AtomicLevel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	atomic := zap.NewAtomicLevelAt(level)
+	r.levels = append(r.levels, atomic)
+	r.current = level
+	return atomic
+}
+
+// set changes the level of every registered logger
+func (r *levelRegistry) set(level zapcore.Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, atomic := range r.levels {
+		atomic.SetLevel(level)
+	}
+	r.current = level
+}
+
+// get returns the last level set
+func (r *levelRegistry) get() zapcore.Level {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Level returns the level last applied through SetLevel, or the configured level of the
+// most recently created logger when SetLevel has not been called (e.g. "info")
+func Level() string {
+	return levels.get().String()
+}
+
+// SetLevel changes the level of every logger created by NewLogger at runtime
+// Parameters:
+//   - level: One of "debug", "info", "warn", "error", "dpanic", "panic" or "fatal"
+//
+// Returns:
+//   - error: If the level is unknown; the current levels are kept
+func SetLevel(level string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	levels.set(l)
+	return nil
+}
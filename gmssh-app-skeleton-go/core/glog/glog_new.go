@@ -35,10 +35,12 @@ func NewLogger(config *LogConfig) (*zap.Logger, error) {
 	fullPath := filepath.Join(config.Path, filename)
 
 	// Parse and set log level from config (defaults to InfoLevel if invalid)
+	// Each logger keeps its own level, adjustable at runtime through SetLevel
 	var level zapcore.Level
 	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
 		level = zapcore.InfoLevel // Default level if parsing fails
 	}
+	atomicLevel := levels.register(level)
 
 	// Configure log rotation using lumberjack:
 	// - MaxSize: 10MB per log file
@@ -80,11 +82,11 @@ func NewLogger(config *LogConfig) (*zap.Logger, error) {
 	// Create the core logger with:
 	// - Console encoder with our configuration
 	// - Configured output destination(s)
-	// - Specified log level
+	// - Shared runtime adjustable log level
 	core := zapcore.NewCore(
 		zapcore.NewConsoleEncoder(encoderConfig),
 		ws,
-		level,
+		atomicLevel,
 	)
 
 	// Create the final logger with caller information enabled
@@ -95,3 +95,33 @@ func TestGLoggerErrorWithStack(t *testing.T) {
 
 	t.Log("GLogger堆栈测试完成，请检查日志文件中是否包含堆栈信息")
 }
+
+func TestLoggerLevels(t *testing.T) {
+	newLogger := func(level string) *zap.Logger {
+		config, err := LoadConfig(map[string]any{"path": t.TempDir(), "file": "app.log", "level": level})
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger, err := NewLogger(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return logger
+	}
+	defer SetLevel(Level())
+
+	debug := newLogger("debug")
+	errs := newLogger("error")
+
+	// A new logger does not change the level of earlier ones
+	if !debug.Core().Enabled(zap.DebugLevel) || errs.Core().Enabled(zap.WarnLevel) {
+		t.Fatal("loggers do not keep their configured levels")
+	}
+
+	if err := SetLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	if debug.Core().Enabled(zap.InfoLevel) || !errs.Core().Enabled(zap.WarnLevel) || Level() != "warn" {
+		t.Fatal("SetLevel did not update every logger")
+	}
+}
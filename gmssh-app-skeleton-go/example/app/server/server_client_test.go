@@ -1,26 +1,22 @@
 package server
 
 import (
-	"context"
-	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
 )
 
 func TestJRpcServerClient(t *testing.T) {
-	socketPath := "../zack.sock"
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	hand := &CustomHandler{}
+	service.RegisterHandle("hello", hand.Hello, []gsock.RPCMiddleware{hand}...)
 
-	simpleClient := gsock.NewRpcSimpleClient(socketPath)
+	client, cleanup := gsocktest.NewPipeServer(service)
+	defer cleanup()
 
-	var result any
-	err := simpleClient.Request(
-		context.TODO(), "hello", nil, &result,
-	)
-	if err != nil {
-		t.Fatalf("send sockets failed err : %#v", err)
-		return
-	}
-
-	fmt.Printf("[*] request successfully res:%#v \n", result)
+	result := client.Call(t, "hello", nil)
+	gsocktest.AssertCode(t, result, http.StatusOK)
+	gsocktest.AssertData(t, result, "Hello World")
 }
@@ -0,0 +1,83 @@
+// Command conform serves the API of the Python skeleton (gmssh-app-skeleton-back-py) with
+// this module, as the Go reference for the gconform wire fixtures
+//
+//	go run ./example/conform -s /tmp/app.sock -lang zh-CN &
+//	go run ./cmd/gmconform -s /tmp/app.sock -lang zh-CN
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+
+	rpc "github.com/DemonZack/simplejrpc-go"
+	"github.com/DemonZack/simplejrpc-go/core/gi18n"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// HelloForm mirrors ExampleForm of the Python skeleton
+type HelloForm struct {
+	Name string `json:"name"`
+}
+
+// Hello greets params.name, which is required
+func Hello(req *gsock.Request) (any, error) {
+	var form HelloForm
+	if params := req.RawRequest().Params; params != nil {
+		if err := json.Unmarshal(*params, &form); err != nil {
+			return nil, err
+		}
+	}
+	if form.Name == "" {
+		return nil, errors.New(gi18n.T("REQUIRE_VALIDATION_TM"))
+	}
+	return "hello " + form.Name, nil
+}
+
+// Ping is the health check
+func Ping(req *gsock.Request) (any, error) {
+	return "pong", nil
+}
+
+// StatusMiddleware translates the message of successful responses, as jsonify(msg=T("STATUS_OK")) does
+type StatusMiddleware struct{}
+
+func (m *StatusMiddleware) ProcessRequest(req *gsock.Request) {}
+
+func (m *StatusMiddleware) ProcessResponse(resp any) (any, error) {
+	if r, ok := resp.(*gsock.Response); ok && r.Code == http.StatusOK {
+		r.Message = gi18n.T("STATUS_OK")
+	}
+	return resp, nil
+}
+
+// serviceOptions loads the translations of lang from dir and returns the service configuration
+func serviceOptions(dir, lang string) []gsock.JsonRpcSimpleServiceOptionFunc {
+	gi18n.Instance().SetPath(dir)
+	gi18n.Instance().SetLanguage(lang)
+
+	return []gsock.JsonRpcSimpleServiceOptionFunc{
+		gsock.WithJsonRpcSimpleServiceHandler(gsock.NewJsonRpcSimpleServiceHandler()),
+		gsock.WithJsonRpcSimpleServiceMiddlewares(&StatusMiddleware{}),
+	}
+}
+
+// register registers the skeleton API
+func register(s gsock.IRpcHandler) {
+	s.RegisterHandle("hello", Hello)
+	s.RegisterHandle("ping", Ping)
+}
+
+func main() {
+	socket := flag.String("s", "app.sock", "socket path")
+	dir := flag.String("i18n", "i18n", "directory of en.ini and zh-CN.ini")
+	lang := flag.String("lang", gi18n.English.String(), "language of messages: en or zh-CN")
+	flag.Parse()
+
+	server := rpc.NewDefaultServer(serviceOptions(*dir, *lang)...)
+	register(server)
+	if err := server.StartServer(*socket); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gconform"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+func TestConformance(t *testing.T) {
+	fixtures, err := gconform.Fixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The translator is global, so the languages run one after the other
+	for _, lang := range []string{"en", "zh-CN"} {
+		t.Run(lang, func(t *testing.T) {
+			service := gsock.NewJsonRpcSimpleService(serviceOptions("i18n", lang)...)
+			register(service)
+			client, cleanup := gsocktest.NewSocketServer(t, service)
+			defer cleanup()
+
+			report := gconform.Run(context.Background(), client.SocketPath, fixtures, gconform.WithLanguageOption(lang))
+			if !report.Passed() {
+				t.Fatalf("conformance failed:\n%s", report)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Code generated by gmgen -type FileAPI; DO NOT EDIT.
+
+package gmgen
+
+import (
+	"context"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// RPC method names of FileAPI
+const (
+	FileAPIList   = "file.list"
+	FileAPIStat   = "file.stat"
+	FileAPIDelete = "file.rm"
+	FileAPIUsage  = "file.usage"
+)
+
+// RegisterFileAPI registers every FileAPI method of impl on s, typically a *simplejrpc.Server
+// Methods needing route middlewares can be registered again by hand under the constants above
+func RegisterFileAPI(s gsock.IRpcHandler, impl FileAPI) {
+	s.RegisterHandle(FileAPIList, func(req *gsock.Request) (any, error) {
+		var params ListParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return impl.List(req.Context(), params)
+	})
+	s.RegisterHandle(FileAPIStat, func(req *gsock.Request) (any, error) {
+		var params PathParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return impl.Stat(req.Context(), params)
+	})
+	s.RegisterHandle(FileAPIDelete, func(req *gsock.Request) (any, error) {
+		var params PathParams
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return nil, impl.Delete(req.Context(), params)
+	})
+	s.RegisterHandle(FileAPIUsage, func(req *gsock.Request) (any, error) {
+		return impl.Usage(req.Context())
+	})
+}
+
+// FileAPIClient calls FileAPI methods through a gsock client
+type FileAPIClient struct {
+	client gsock.IRpcClient
+	opts   []gsock.CallOptFunc
+}
+
+var _ FileAPI = (*FileAPIClient)(nil)
+
+// NewFileAPIClient creates a FileAPI client; opts apply to every call
+func NewFileAPIClient(client gsock.IRpcClient, opts ...gsock.CallOptFunc) *FileAPIClient {
+	return &FileAPIClient{client: client, opts: opts}
+}
+
+// List lists the entries of a directory
+func (c *FileAPIClient) List(ctx context.Context, params ListParams) ([]Entry, error) {
+	return gsock.Call[[]Entry](ctx, c.client, FileAPIList, params, c.opts...)
+}
+
+// Stat describes a single file
+func (c *FileAPIClient) Stat(ctx context.Context, params PathParams) (*Entry, error) {
+	return gsock.Call[*Entry](ctx, c.client, FileAPIStat, params, c.opts...)
+}
+
+// Delete removes a file
+func (c *FileAPIClient) Delete(ctx context.Context, params PathParams) error {
+	_, err := gsock.Call[any](ctx, c.client, FileAPIDelete, params, c.opts...)
+	return err
+}
+
+// Usage reports the disk usage of every mount
+func (c *FileAPIClient) Usage(ctx context.Context) (map[string]Usage, error) {
+	return gsock.Call[map[string]Usage](ctx, c.client, FileAPIUsage, nil, c.opts...)
+}
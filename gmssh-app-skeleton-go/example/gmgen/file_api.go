@@ -0,0 +1,60 @@
+// Package gmgen shows the code gmgen generates for an app's RPC API
+package gmgen
+
+import (
+	"context"
+	"time"
+)
+
+//go:generate go run github.com/DemonZack/simplejrpc-go/cmd/gmgen -type FileAPI -ts web/file_api
+
+// FileAPI manages the files of the app
+//
+//gmgen:prefix file
+type FileAPI interface {
+	// List lists the entries of a directory
+	List(ctx context.Context, params ListParams) ([]Entry, error)
+
+	// Stat describes a single file
+	Stat(ctx context.Context, params PathParams) (*Entry, error)
+
+	// Delete removes a file
+	//
+	//gmgen:method file.rm
+	Delete(ctx context.Context, params PathParams) error
+
+	// Usage reports the disk usage of every mount
+	Usage(ctx context.Context) (map[string]Usage, error)
+}
+
+// PathParams names a file
+type PathParams struct {
+	Path string `json:"path"` // Absolute path
+}
+
+// ListParams selects the entries of a directory
+type ListParams struct {
+	PathParams
+	Hidden bool `json:"hidden,omitempty"` // Include dot files
+	Limit  int  `json:"limit,omitempty"`
+}
+
+// Entry is a directory entry
+type Entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Mode    Mode      `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	Tags    []string  `json:"tags,omitempty"`
+	Link    *Entry    `json:"link,omitempty"` // Target of a symbolic link
+	secret  string
+}
+
+// Mode is the file type
+type Mode string
+
+// Usage is the disk usage of a mount
+type Usage struct {
+	Used  uint64 `json:"used"`
+	Total uint64 `json:"total"`
+}
@@ -0,0 +1,73 @@
+package gmgen
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+// memoryFiles implements FileAPI over a map
+type memoryFiles map[string]Entry
+
+func (m memoryFiles) List(ctx context.Context, params ListParams) ([]Entry, error) {
+	var entries []Entry
+	for name, entry := range m {
+		if path.Dir(name) == params.Path {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m memoryFiles) Stat(ctx context.Context, params PathParams) (*Entry, error) {
+	entry, ok := m[params.Path]
+	if !ok {
+		return nil, gerror.CodeFileNotExistsError
+	}
+	return &entry, nil
+}
+
+func (m memoryFiles) Delete(ctx context.Context, params PathParams) error {
+	delete(m, params.Path)
+	return nil
+}
+
+func (m memoryFiles) Usage(ctx context.Context) (map[string]Usage, error) {
+	return map[string]Usage{"/": {Used: 1, Total: 2}}, nil
+}
+
+func TestGeneratedServerAndClient(t *testing.T) {
+	files := memoryFiles{"/etc/hosts": {Name: "hosts", Size: 12, Mode: "file", ModTime: time.Unix(0, 0).UTC()}}
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	RegisterFileAPI(service, files)
+
+	conn, cleanup := gsocktest.NewPipeServer(service)
+	defer cleanup()
+	client := NewFileAPIClient(conn)
+	ctx := context.Background()
+
+	entries, err := client.List(ctx, ListParams{PathParams: PathParams{Path: "/etc"}})
+	if err != nil || len(entries) != 1 || entries[0].Name != "hosts" || !entries[0].ModTime.Equal(time.Unix(0, 0)) {
+		t.Fatalf("List = %+v, %v", entries, err)
+	}
+	var exception gerror.Exception
+	if _, err := client.Stat(ctx, PathParams{Path: "/nope"}); !errors.As(err, &exception) || exception.Code() != gerror.CodeFileNotExistsError.Code() {
+		t.Fatalf("Stat of a missing file: %v", err)
+	}
+	if err := client.Delete(ctx, PathParams{Path: "/etc/hosts"}); err != nil || len(files) != 0 {
+		t.Fatalf("Delete: %v, %d files left", err, len(files))
+	}
+	if usage, err := client.Usage(ctx); err != nil || usage["/"].Total != 2 {
+		t.Fatalf("Usage = %v, %v", usage, err)
+	}
+
+	// Params are required where the interface takes them
+	resp := conn.Call(t, FileAPIStat, nil)
+	gsocktest.AssertCode(t, resp, 400)
+}
@@ -0,0 +1,53 @@
+// Code generated by gmgen -type FileAPI; DO NOT EDIT.
+
+export interface PathParams {
+  /** Absolute path */
+  path: string;
+}
+
+export interface ListParams extends PathParams {
+  /** Include dot files */
+  hidden?: boolean;
+  limit?: number;
+}
+
+export type Mode = string;
+
+export interface Entry {
+  name: string;
+  size: number;
+  mode: Mode;
+  modTime: string;
+  tags?: string[];
+  /** Target of a symbolic link */
+  link?: Entry | null;
+}
+
+export interface Usage {
+  used: number;
+  total: number;
+}
+
+/** FileAPI manages the files of the app */
+export declare const fileAPI: {
+  /**
+   * List lists the entries of a directory
+   * @remarks Calls file.list
+   */
+  list(params: ListParams): Promise<Entry[]>;
+  /**
+   * Stat describes a single file
+   * @remarks Calls file.stat
+   */
+  stat(params: PathParams): Promise<Entry | null>;
+  /**
+   * Delete removes a file
+   * @remarks Calls file.rm
+   */
+  delete(params: PathParams): Promise<void>;
+  /**
+   * Usage reports the disk usage of every mount
+   * @remarks Calls file.usage
+   */
+  usage(): Promise<Record<string, Usage>>;
+};
@@ -0,0 +1,10 @@
+// Code generated by gmgen -type FileAPI; DO NOT EDIT.
+
+import { request } from "gmssh-front-sdk";
+
+export const fileAPI = {
+  list: (params) => request("file.list", params),
+  stat: (params) => request("file.stat", params),
+  delete: (params) => request("file.rm", params),
+  usage: () => request("file.usage", null),
+};
@@ -3,6 +3,7 @@ module github.com/DemonZack/simplejrpc-go
 go 1.23.4
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/sourcegraph/jsonrpc2 v0.2.1
 	go.uber.org/zap v1.27.0
 	gopkg.in/ini.v1 v1.67.0
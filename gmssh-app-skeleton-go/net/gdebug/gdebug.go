@@ -0,0 +1,82 @@
+// Package gdebug serves opt-in runtime diagnostics as debug.* RPC methods, for apps
+// that can only be reached through their socket: goroutine dumps, memory and GC
+// statistics, CPU and heap profiles and the log level
+//
+//	gdebug.NewService().Register(ds)
+//
+// Every method first asks the service's gsock.Authorizer; by default only peers running as
+// the app's user or as root may call them (gsock.AppPeers). Profiles are returned as pprof data, which
+// encoding/json sends as base64:
+//
+//	gmrpc -s app.sock -raw call debug.profile.cpu '{"seconds":10}' | jq -r .data.profile | base64 -d > cpu.pprof
+//	go tool pprof cpu.pprof
+package gdebug
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	MethodGoroutines = "debug.goroutines"   // Dumps the stacks of all goroutines
+	MethodMemStats   = "debug.memstats"     // Returns runtime.MemStats
+	MethodGCStats    = "debug.gcstats"      // Returns GC statistics
+	MethodCPUProfile = "debug.profile.cpu"  // Captures a CPU profile for N seconds
+	MethodHeap       = "debug.profile.heap" // Captures a heap profile
+	MethodLogLevel   = "debug.log.level"    // Returns or changes the log level
+
+	// DefaultCPUDuration is the length of CPU profiles requested without seconds
+	DefaultCPUDuration = 30 * time.Second
+
+	// DefaultMaxDuration bounds the length of CPU profiles
+	DefaultMaxDuration = 60 * time.Second
+)
+
+// ServiceOptFunc defines functions for configuring a diagnostics Service
+type ServiceOptFunc func(*Service)
+
+// WithAuthorizeOption sets the check run before every debug method
+// The default, gsock.AppPeers, admits the app's own user and root
+func WithAuthorizeOption(authorize gsock.Authorizer) ServiceOptFunc {
+	return func(s *Service) {
+		s.authorize = authorize
+	}
+}
+
+// WithMaxDurationOption bounds the duration of CPU profiles
+func WithMaxDurationOption(d time.Duration) ServiceOptFunc {
+	return func(s *Service) {
+		s.maxDuration = d
+	}
+}
+
+// Service implements the debug.* methods
+type Service struct {
+	authorize   gsock.Authorizer // Access check run before every method
+	maxDuration time.Duration    // Upper bound of CPU profile durations
+	cpu         sync.Mutex       // Held while a CPU profile is captured
+}
+
+// NewService creates a diagnostics service
+func NewService(opts ...ServiceOptFunc) *Service {
+	s := &Service{
+		authorize:   gsock.AppPeers(),
+		maxDuration: DefaultMaxDuration,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register binds the debug.* methods on the given handler registry
+func (s *Service) Register(handler gsock.IRpcHandler) {
+	handler.RegisterHandle(MethodGoroutines, gsock.Guard(s.authorize, s.Goroutines))
+	handler.RegisterHandle(MethodMemStats, gsock.Guard(s.authorize, s.MemStats))
+	handler.RegisterHandle(MethodGCStats, gsock.Guard(s.authorize, s.GCStats))
+	handler.RegisterHandle(MethodCPUProfile, gsock.Guard(s.authorize, s.CPUProfile))
+	handler.RegisterHandle(MethodHeap, gsock.Guard(s.authorize, s.HeapProfile))
+	handler.RegisterHandle(MethodLogLevel, gsock.Guard(s.authorize, s.LogLevel))
+}
@@ -0,0 +1,190 @@
+package gdebug
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/core/glog"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// gcPauseHistory is the number of recent GC pauses returned by debug.gcstats
+const gcPauseHistory = 16
+
+// GoroutinesParams are the optional params of debug.goroutines
+type GoroutinesParams struct {
+	Debug int `json:"debug"` // 1 groups identical stacks, 2 (default) prints every goroutine as a panic would
+}
+
+// GoroutinesResult is the result of debug.goroutines
+type GoroutinesResult struct {
+	Count int    `json:"count"` // Number of goroutines
+	Dump  string `json:"dump"`  // Stack dump
+}
+
+// GCStats is the result of debug.gcstats
+type GCStats struct {
+	NumGC       int64           `json:"numGC"`       // Completed GC cycles
+	LastGC      time.Time       `json:"lastGC"`      // End of the last cycle
+	PauseTotal  time.Duration   `json:"pauseTotal"`  // Total pause time, in nanoseconds
+	Pauses      []time.Duration `json:"pauses"`      // Most recent pauses first, in nanoseconds
+	MemoryLimit int64           `json:"memoryLimit"` // Soft memory limit in bytes (GOMEMLIMIT), 0 when unlimited
+}
+
+// CPUProfileParams are the optional params of debug.profile.cpu
+type CPUProfileParams struct {
+	Seconds float64 `json:"seconds"` // Capture duration, DefaultCPUDuration when zero
+}
+
+// HeapProfileParams are the optional params of debug.profile.heap
+type HeapProfileParams struct {
+	GC bool `json:"gc"` // Run a garbage collection first, so the profile reflects live objects only
+}
+
+// Profile is the result of the profile methods
+type Profile struct {
+	Format   string        `json:"format"`   // Always "pprof"
+	Duration time.Duration `json:"duration"` // Capture duration in nanoseconds, zero for snapshots
+	Profile  []byte        `json:"profile"`  // Gzipped pprof data, base64 encoded in JSON
+}
+
+// LogLevelParams are the optional params of debug.log.level
+type LogLevelParams struct {
+	Level string `json:"level"` // New level ("debug", "info", "warn", "error"); empty only reads it
+}
+
+// LogLevelResult is the result of debug.log.level
+type LogLevelResult struct {
+	Level string `json:"level"` // Current level
+}
+
+// Goroutines dumps the stacks of all goroutines
+func (s *Service) Goroutines(req *gsock.Request) (any, error) {
+	params := GoroutinesParams{Debug: 2}
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	if params.Debug != 1 && params.Debug != 2 {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "debug must be 1 or 2")
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, params.Debug); err != nil {
+		return nil, err
+	}
+	return &GoroutinesResult{Count: runtime.NumGoroutine(), Dump: buf.String()}, nil
+}
+
+// MemStats returns runtime.MemStats
+func (s *Service) MemStats(req *gsock.Request) (any, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return &stats, nil
+}
+
+// GCStats returns garbage collector statistics
+func (s *Service) GCStats(req *gsock.Request) (any, error) {
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
+
+	// A negative limit reads it without change; the unlimited math.MaxInt64 does not fit a JS number
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = 0
+	}
+
+	pauses := stats.Pause
+	if len(pauses) > gcPauseHistory {
+		pauses = pauses[:gcPauseHistory]
+	}
+	return &GCStats{
+		NumGC:       stats.NumGC,
+		LastGC:      stats.LastGC,
+		PauseTotal:  stats.PauseTotal,
+		Pauses:      pauses,
+		MemoryLimit: limit,
+	}, nil
+}
+
+// CPUProfile captures a CPU profile for the requested number of seconds
+// Only one profile runs at a time; a concurrent request gets CodeServerBusy.
+// The capture ends early when the caller disconnects
+func (s *Service) CPUProfile(req *gsock.Request) (any, error) {
+	var params CPUProfileParams
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	duration := DefaultCPUDuration
+	if params.Seconds < 0 {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "seconds must not be negative")
+	}
+	if params.Seconds > 0 {
+		duration = time.Duration(params.Seconds * float64(time.Second))
+	}
+	if duration > s.maxDuration {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "seconds exceeds the limit of "+s.maxDuration.String())
+	}
+
+	if !s.cpu.TryLock() {
+		return nil, gerror.WithMessage(gerror.CodeServerBusy, "a CPU profile is already being captured")
+	}
+	defer s.cpu.Unlock()
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		// Profiling was started outside this service, e.g. by net/http/pprof
+		return nil, gerror.WithMessageErr(gerror.CodeServerBusy, err, "")
+	}
+	var disconnected <-chan struct{} // nil, never ready, outside a connection
+	if session := req.Session(); session != nil {
+		disconnected = session.Done()
+	}
+	start := time.Now()
+	timer := time.NewTimer(duration)
+	select {
+	case <-timer.C:
+	case <-req.Context().Done():
+		timer.Stop()
+	case <-disconnected:
+		timer.Stop()
+	}
+	pprof.StopCPUProfile()
+
+	return &Profile{Format: "pprof", Duration: time.Since(start), Profile: buf.Bytes()}, nil
+}
+
+// HeapProfile captures a heap profile
+func (s *Service) HeapProfile(req *gsock.Request) (any, error) {
+	var params HeapProfileParams
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	if params.GC {
+		runtime.GC()
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	return &Profile{Format: "pprof", Profile: buf.Bytes()}, nil
+}
+
+// LogLevel returns the log level of loggers created by glog, changing it first when a level is given
+func (s *Service) LogLevel(req *gsock.Request) (any, error) {
+	var params LogLevelParams
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	if params.Level != "" {
+		if err := glog.SetLevel(params.Level); err != nil {
+			return nil, gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+		}
+	}
+	return &LogLevelResult{Level: glog.Level()}, nil
+}
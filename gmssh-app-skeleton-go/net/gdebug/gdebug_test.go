@@ -0,0 +1,144 @@
+package gdebug
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/core/glog"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+// newSocketServer serves a debug service on a Unix socket
+func newSocketServer(t *testing.T, opts ...ServiceOptFunc) *gsocktest.Client {
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	NewService(opts...).Register(service)
+	client, cleanup := gsocktest.NewSocketServer(t, service)
+	t.Cleanup(cleanup)
+	return client
+}
+
+// decode re-decodes response data into out
+func decode(t *testing.T, resp *gsock.Response, out any) {
+	t.Helper()
+	gsocktest.AssertCode(t, resp, http.StatusOK)
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	client := newSocketServer(t)
+
+	var goroutines GoroutinesResult
+	decode(t, client.Call(t, MethodGoroutines, nil), &goroutines)
+	if goroutines.Count == 0 || !strings.Contains(goroutines.Dump, "goroutine ") {
+		t.Fatalf("unexpected goroutine dump %+v", goroutines)
+	}
+
+	var mem struct{ HeapAlloc, NumGC uint64 }
+	decode(t, client.Call(t, MethodMemStats, nil), &mem)
+	if mem.HeapAlloc == 0 {
+		t.Fatalf("unexpected memstats %+v", mem)
+	}
+
+	var heap, cpu Profile
+	decode(t, client.Call(t, MethodHeap, HeapProfileParams{GC: true}), &heap)
+	decode(t, client.Call(t, MethodCPUProfile, CPUProfileParams{Seconds: 0.05}), &cpu)
+	for _, p := range []Profile{heap, cpu} {
+		// pprof data is gzipped protobuf
+		if p.Format != "pprof" || !bytes.HasPrefix(p.Profile, []byte{0x1f, 0x8b}) {
+			t.Fatalf("unexpected profile %q %x", p.Format, p.Profile[:min(len(p.Profile), 4)])
+		}
+	}
+	if cpu.Duration < 50*time.Millisecond {
+		t.Fatalf("CPU profile lasted %v", cpu.Duration)
+	}
+
+	var gc GCStats
+	decode(t, client.Call(t, MethodGCStats, nil), &gc)
+	if gc.NumGC == 0 || len(gc.Pauses) == 0 || len(gc.Pauses) > gcPauseHistory {
+		t.Fatalf("unexpected GC stats %+v", gc)
+	}
+
+	resp := client.Call(t, MethodCPUProfile, CPUProfileParams{Seconds: 3600})
+	gsocktest.AssertCode(t, resp, http.StatusBadRequest)
+}
+
+func TestCPUProfileBusy(t *testing.T) {
+	debug := NewService()
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	debug.Register(service)
+	client, cleanup := gsocktest.NewSocketServer(t, service)
+	defer cleanup()
+
+	// A capture in progress holds the lock; further captures are refused
+	debug.cpu.Lock()
+	exc := client.Call(t, MethodCPUProfile, CPUProfileParams{Seconds: 0.01}).Exception()
+	debug.cpu.Unlock()
+	if exc == nil || exc.Code() != gerror.CodeServerBusy.Code() {
+		t.Fatalf("concurrent CPU profile not refused: %v", exc)
+	}
+	gsocktest.AssertCode(t, client.Call(t, MethodCPUProfile, CPUProfileParams{Seconds: 0.01}), http.StatusOK)
+}
+
+func TestLogLevel(t *testing.T) {
+	client := newSocketServer(t)
+	defer glog.SetLevel(glog.Level())
+
+	var level LogLevelResult
+	decode(t, client.Call(t, MethodLogLevel, LogLevelParams{Level: "debug"}), &level)
+	if level.Level != "debug" || glog.Level() != "debug" {
+		t.Fatalf("level %q, glog %q", level.Level, glog.Level())
+	}
+	decode(t, client.Call(t, MethodLogLevel, nil), &level)
+	if level.Level != "debug" {
+		t.Fatalf("level %q", level.Level)
+	}
+
+	resp := client.Call(t, MethodLogLevel, LogLevelParams{Level: "loud"})
+	gsocktest.AssertCode(t, resp, http.StatusBadRequest)
+	if glog.Level() != "debug" {
+		t.Fatalf("invalid level changed glog to %q", glog.Level())
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	// Pipes carry no peer credentials, so the default authorizer denies them
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	NewService().Register(service)
+	pipe, cleanup := gsocktest.NewPipeServer(service)
+	defer cleanup()
+	exc := pipe.Call(t, MethodMemStats, nil).Exception()
+	if exc == nil || exc.Code() != gerror.CodeNotAuthorized.Code() {
+		t.Fatalf("pipe peer not denied: %v", exc)
+	}
+
+	// A socket peer running as another user is denied
+	client := newSocketServer(t, WithAuthorizeOption(gsock.PeerUID(1<<31)))
+	exc = client.Call(t, MethodGoroutines, nil).Exception()
+	if exc == nil || exc.Code() != gerror.CodeNotAuthorized.Code() {
+		t.Fatalf("foreign peer not denied: %v", exc)
+	}
+
+	// Custom authorizers see the request
+	client = newSocketServer(t, WithAuthorizeOption(func(req *gsock.Request) error {
+		if req.MetaString("token") != "s3cret" {
+			return gerror.CodeNotAuthorized
+		}
+		return nil
+	}))
+	exc = client.Call(t, MethodMemStats, nil).Exception()
+	if exc == nil || exc.Code() != gerror.CodeNotAuthorized.Code() {
+		t.Fatalf("request without token not denied: %v", exc)
+	}
+}
@@ -0,0 +1,325 @@
+package gevent
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	// MethodSubscribe is the RPC method clients call to subscribe to a topic pattern
+	MethodSubscribe = "events.subscribe"
+
+	// MethodUnsubscribe is the RPC method clients call to drop a topic pattern
+	MethodUnsubscribe = "events.unsubscribe"
+
+	// DefaultNotifyMethod is the notification method events are delivered with
+	DefaultNotifyMethod = "events.notify"
+
+	// DefaultBufferSize is the number of undelivered events kept per connection
+	DefaultBufferSize = 64
+)
+
+// DropPolicy decides which event is discarded when a connection's buffer is full
+type DropPolicy int
+
+const (
+	DropOldest DropPolicy = iota // Discard the oldest queued event to make room (default)
+	DropNewest                   // Discard the event being published
+)
+
+// HubOptFunc defines functions for configuring a Hub
+type HubOptFunc func(*Hub)
+
+// WithHubBufferOption sets the per-connection event buffer size
+func WithHubBufferOption(size int) HubOptFunc {
+	return func(h *Hub) {
+		h.buffer = size
+	}
+}
+
+// WithHubDropPolicyOption sets what happens when a connection's buffer is full
+func WithHubDropPolicyOption(policy DropPolicy) HubOptFunc {
+	return func(h *Hub) {
+		h.policy = policy
+	}
+}
+
+// WithHubNotifyMethodOption sets the notification method used to deliver events
+func WithHubNotifyMethodOption(method string) HubOptFunc {
+	return func(h *Hub) {
+		h.method = method
+	}
+}
+
+// topicParams are the params of events.subscribe and events.unsubscribe
+type topicParams struct {
+	Topic string `json:"topic"` // Topic pattern, e.g. "disk.*"
+}
+
+// subscriber is a connection with at least one subscription
+type subscriber struct {
+	mu       sync.Mutex           // Protects patterns
+	conn     *jsonrpc2.Conn       // Connection events are delivered on
+	patterns map[string]struct{}  // Subscribed topic patterns
+	queue    chan *gsock.Response // Pending events
+	done     chan struct{}        // Closed when the subscriber is removed
+	dropped  uint64               // Events discarded by the drop policy
+}
+
+// Hub routes published events to connections subscribed to matching topics
+// Events are delivered as JSON-RPC notifications carrying the standard response envelope,
+// with Meta.Endpoint set to the topic:
+//
+//	hub := gevent.NewHub()
+//	hub.Register(ds)
+//	...
+//	hub.Publish("disk.alert", alert)
+//
+// Subscriptions are removed automatically when their connection goes away, and a connection
+// whose last pattern is unsubscribed is forgotten along with its delivery goroutine
+type Hub struct {
+	mu          sync.RWMutex                   // Protects subscribers
+	subscribers map[*jsonrpc2.Conn]*subscriber // Subscribers by connection
+	buffer      int                            // Per-connection buffer size
+	policy      DropPolicy                     // Buffer overflow policy
+	method      string                         // Notification method
+}
+
+// NewHub creates an event hub
+func NewHub(opts ...HubOptFunc) *Hub {
+	h := &Hub{
+		subscribers: make(map[*jsonrpc2.Conn]*subscriber),
+		buffer:      DefaultBufferSize,
+		method:      DefaultNotifyMethod,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.buffer <= 0 {
+		h.buffer = DefaultBufferSize
+	}
+	return h
+}
+
+// Register binds events.subscribe and events.unsubscribe on the given handler registry
+func (h *Hub) Register(handler gsock.IRpcHandler) {
+	handler.RegisterHandle(MethodSubscribe, h.Subscribe)
+	handler.RegisterHandle(MethodUnsubscribe, h.Unsubscribe)
+}
+
+// Subscribe handles events.subscribe: {"topic": "disk.*"}
+// Returns the patterns the connection is subscribed to
+func (h *Hub) Subscribe(req *gsock.Request) (any, error) {
+	pattern, err := parseTopic(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Conn() == nil {
+		return nil, gerror.WithMessage(gerror.CodeNotSupported, "subscriptions require a persistent connection")
+	}
+
+	// The hub lock keeps a concurrent Unsubscribe from removing the subscriber meanwhile
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := h.subscriber(req.Conn())
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.patterns[pattern] = struct{}{}
+	return sub.topics(), nil
+}
+
+// Unsubscribe handles events.unsubscribe: {"topic": "disk.*"}
+// Returns the patterns the connection is still subscribed to
+func (h *Hub) Unsubscribe(req *gsock.Request) (any, error) {
+	pattern, err := parseTopic(req)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub, ok := h.subscribers[req.Conn()]
+	if !ok {
+		return []string{}, nil
+	}
+
+	sub.mu.Lock()
+	delete(sub.patterns, pattern)
+	topics := sub.topics()
+	sub.mu.Unlock()
+	if len(topics) == 0 {
+		h.removeLocked(sub)
+	}
+	return topics, nil
+}
+
+// Publish queues an event for every connection subscribed to a matching pattern
+// It never blocks; full buffers are handled by the drop policy
+// Returns the number of connections the event was queued for
+func (h *Hub) Publish(topic string, payload any) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, sub := range h.subscribers {
+		if !sub.matches(topic) {
+			continue
+		}
+		event := gsock.NewResponse().WithData(payload, topic)
+		if h.enqueue(sub, event) {
+			count++
+		}
+	}
+	return count
+}
+
+// Subscribers returns the number of connections with at least one subscription
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.subscribers)
+}
+
+// Dropped returns the total number of events discarded for currently connected subscribers
+func (h *Hub) Dropped() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var total uint64
+	for _, sub := range h.subscribers {
+		total += atomic.LoadUint64(&sub.dropped)
+	}
+	return total
+}
+
+// subscriber returns the subscriber of conn, creating it and its delivery goroutine if needed
+// The caller must hold the lock
+func (h *Hub) subscriber(conn *jsonrpc2.Conn) *subscriber {
+	if sub, ok := h.subscribers[conn]; ok {
+		return sub
+	}
+
+	sub := &subscriber{
+		conn:     conn,
+		patterns: make(map[string]struct{}),
+		queue:    make(chan *gsock.Response, h.buffer),
+		done:     make(chan struct{}),
+	}
+	h.subscribers[conn] = sub
+
+	go h.deliver(sub)
+	go func() {
+		select {
+		case <-conn.DisconnectNotify():
+			h.remove(sub)
+		case <-sub.done:
+		}
+	}()
+	return sub
+}
+
+// deliver sends queued events until the subscriber is removed
+func (h *Hub) deliver(sub *subscriber) {
+	for {
+		select {
+		case event := <-sub.queue:
+			if err := sub.conn.Notify(context.Background(), h.method, event); err != nil {
+				h.remove(sub)
+				return
+			}
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// enqueue adds an event to the subscriber's buffer according to the drop policy
+func (h *Hub) enqueue(sub *subscriber, event *gsock.Response) bool {
+	select {
+	case sub.queue <- event:
+		return true
+	default:
+	}
+
+	atomic.AddUint64(&sub.dropped, 1)
+	if h.policy == DropNewest {
+		return false
+	}
+
+	// Make room by discarding the oldest event, then retry once
+	select {
+	case <-sub.queue:
+	default:
+	}
+	select {
+	case sub.queue <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// remove forgets a subscriber and stops its delivery goroutine
+func (h *Hub) remove(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(sub)
+}
+
+// removeLocked is remove for callers holding the lock
+// A later subscriber of the same connection is left alone
+func (h *Hub) removeLocked(sub *subscriber) {
+	if current, ok := h.subscribers[sub.conn]; ok && current == sub {
+		delete(h.subscribers, sub.conn)
+		close(sub.done)
+	}
+}
+
+// matches reports whether any pattern of the subscriber matches topic
+func (s *subscriber) matches(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for pattern := range s.patterns {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// topics lists the subscribed patterns; the caller must hold the lock
+func (s *subscriber) topics() []string {
+	topics := make([]string, 0, len(s.patterns))
+	for pattern := range s.patterns {
+		topics = append(topics, pattern)
+	}
+	return topics
+}
+
+// parseTopic decodes and validates the topic param
+func parseTopic(req *gsock.Request) (string, error) {
+	var params topicParams
+	raw := req.RawRequest()
+	if raw == nil || raw.Params == nil {
+		return "", gerror.WithMessage(gerror.CodeMissingParameter, "topic is required")
+	}
+	if err := json.Unmarshal(*raw.Params, &params); err != nil {
+		return "", gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+	}
+	if !validPattern(params.Topic) {
+		return "", gerror.WithMessage(gerror.CodeInvalidParameter, "invalid topic pattern")
+	}
+	return params.Topic, nil
+}
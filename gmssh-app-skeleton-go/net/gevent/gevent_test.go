@@ -0,0 +1,118 @@
+package gevent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"disk.alert", "disk.alert", true},
+		{"disk.*", "disk.alert", true},
+		{"disk.*", "disk.sda.alert", false},
+		{"disk.**", "disk.sda.alert", true},
+		{"disk.**", "disk", false},
+		{"*.alert", "cpu.alert", true},
+		{"disk.alert", "disk", false},
+	}
+	for _, c := range cases {
+		if got := MatchTopic(c.pattern, c.topic); got != c.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", c.pattern, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestHubPublishAndDisconnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hub := NewHub()
+	service := newTestService(hub)
+
+	serverSide, clientSide := net.Pipe()
+	serverConn := service.NewConn(ctx, serverSide)
+
+	events := make(chan string, 4)
+	adapter := gsock.NewJsonRpcSimpleClient()
+	adapter.RegisterHandle(DefaultNotifyMethod, func(req *gsock.Request) (any, error) {
+		events <- string(*req.RawRequest().Params)
+		return nil, nil
+	})
+	client := adapter.NewConn(ctx, clientSide)
+
+	var resp gsock.Response
+	if err := client.Request(ctx, MethodSubscribe, map[string]string{"topic": "disk.*"}, &resp); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if resp.Code != 200 {
+		t.Fatalf("subscribe rejected: %#v", resp)
+	}
+
+	if n := hub.Publish("cpu.alert", "ignored"); n != 0 {
+		t.Fatalf("published to %d subscribers, want 0", n)
+	}
+	if n := hub.Publish("disk.alert", "sda full"); n != 1 {
+		t.Fatalf("published to %d subscribers, want 1", n)
+	}
+
+	select {
+	case event := <-events:
+		want := `{"code":200,"data":"sda full","meta":{"close":0,"endpoint":"disk.alert"},"msg":"OK"}`
+		if event != want {
+			t.Fatalf("unexpected event %s", event)
+		}
+	case <-ctx.Done():
+		t.Fatal("event not delivered")
+	}
+
+	// Dropping the last pattern forgets the connection; subscribing again starts over
+	if err := client.Request(ctx, MethodUnsubscribe, map[string]string{"topic": "disk.*"}, &resp); err != nil || hub.Subscribers() != 0 {
+		t.Fatalf("unsubscribed connection kept: %d subscribers, %v", hub.Subscribers(), err)
+	}
+	if err := client.Request(ctx, MethodSubscribe, map[string]string{"topic": "disk.*"}, &resp); err != nil || hub.Subscribers() != 1 {
+		t.Fatalf("resubscribe failed: %d subscribers, %v", hub.Subscribers(), err)
+	}
+
+	serverConn.Close()
+	deadline := time.Now().Add(time.Second)
+	for hub.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.Subscribers() != 0 {
+		t.Fatal("subscription not removed on disconnect")
+	}
+}
+
+func TestHubDropPolicy(t *testing.T) {
+	hub := NewHub(WithHubBufferOption(1), WithHubDropPolicyOption(DropNewest))
+	sub := &subscriber{queue: make(chan *gsock.Response, 1)}
+
+	hub.enqueue(sub, gsock.NewResponse().WithData(1, "t"))
+	if hub.enqueue(sub, gsock.NewResponse().WithData(2, "t")) {
+		t.Fatal("expected newest event to be dropped")
+	}
+	if (<-sub.queue).Data != 1 || sub.dropped != 1 {
+		t.Fatal("unexpected queue state for DropNewest")
+	}
+
+	hub = NewHub(WithHubBufferOption(1))
+	hub.enqueue(sub, gsock.NewResponse().WithData(1, "t"))
+	hub.enqueue(sub, gsock.NewResponse().WithData(2, "t"))
+	if (<-sub.queue).Data != 2 {
+		t.Fatal("expected oldest event to be dropped")
+	}
+}
+
+// newTestService builds a service with the hub's methods registered
+func newTestService(hub *Hub) *gsock.JsonRpcSimpleService {
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	hub.Register(service)
+	return service
+}
@@ -0,0 +1,41 @@
+package gevent
+
+import "strings"
+
+// TopicSeparator splits topics into segments (e.g. "disk.alert")
+const TopicSeparator = "."
+
+// MatchTopic reports whether topic matches the subscription pattern
+// Patterns are dot separated and support two wildcards:
+//   - "*"  matches exactly one segment ("disk.*" matches "disk.alert")
+//   - "**" as the last segment matches one or more segments ("disk.**" matches "disk.sda.alert")
+func MatchTopic(pattern, topic string) bool {
+	patternParts := strings.Split(pattern, TopicSeparator)
+	topicParts := strings.Split(topic, TopicSeparator)
+
+	for i, part := range patternParts {
+		if part == "**" && i == len(patternParts)-1 {
+			return len(topicParts) > i
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "*" && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(topicParts)
+}
+
+// validPattern rejects empty patterns and empty segments
+func validPattern(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+	for _, part := range strings.Split(pattern, TopicSeparator) {
+		if part == "" {
+			return false
+		}
+	}
+	return true
+}
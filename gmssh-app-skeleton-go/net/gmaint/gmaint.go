@@ -0,0 +1,117 @@
+// Package gmaint serves admin.maintenance.* RPC methods turning the app, or single
+// methods, off at runtime, e.g. during data migrations
+//
+//	handler := gsock.NewJsonRpcSimpleServiceHandler()
+//	gmaint.NewService(handler.Maintenance()).Register(handler)
+//
+// Refused calls answer with CodeServerBusy, or CodeNotSupported for methods disabled
+// without a retry hint, and a gsock.MaintenanceNotice as data:
+//
+//	gmrpc -s app.sock call admin.maintenance.start '{"reason":"migrating orders","retryAfter":600}'
+//	gmrpc -s app.sock call admin.maintenance.stop
+//
+// The admin methods and the health methods stay up while the whole app is off. Like the
+// debug methods, they are only allowed for the app's user and root by default
+package gmaint
+
+import (
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	MethodStatus = "admin.maintenance.status" // Returns the maintenance state
+	MethodStart  = "admin.maintenance.start"  // Turns the app or a method off
+	MethodStop   = "admin.maintenance.stop"   // Turns the app or a method back on
+)
+
+// StartParams are the params of admin.maintenance.start
+type StartParams struct {
+	Method     string `json:"method"`     // Method to turn off, empty for the whole app
+	Reason     string `json:"reason"`     // Shown to callers
+	RetryAfter int    `json:"retryAfter"` // Seconds after which callers may retry, 0 if unknown
+}
+
+// StopParams are the optional params of admin.maintenance.stop
+type StopParams struct {
+	Method string `json:"method"` // Method to turn back on, empty for the whole app
+}
+
+// ServiceOptFunc defines functions for configuring a maintenance Service
+type ServiceOptFunc func(*Service)
+
+// WithAuthorizeOption sets the check run before every admin method
+// The default, gsock.AppPeers, admits the app's own user and root
+func WithAuthorizeOption(authorize gsock.Authorizer) ServiceOptFunc {
+	return func(s *Service) {
+		s.authorize = authorize
+	}
+}
+
+// Service implements the admin.maintenance.* methods
+type Service struct {
+	maintenance *gsock.Maintenance // Switch the methods act on
+	authorize   gsock.Authorizer   // Access check run before every method
+}
+
+// NewService creates an admin service for the given maintenance switch
+func NewService(maintenance *gsock.Maintenance, opts ...ServiceOptFunc) *Service {
+	s := &Service{
+		maintenance: maintenance,
+		authorize:   gsock.AppPeers(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register binds the admin.maintenance.* methods on the given handler registry
+// and keeps them up while the whole app is off
+func (s *Service) Register(handler gsock.IRpcHandler) {
+	s.maintenance.Exempt(MethodStatus, MethodStart, MethodStop)
+	handler.RegisterHandle(MethodStatus, gsock.Guard(s.authorize, s.Status))
+	handler.RegisterHandle(MethodStart, gsock.Guard(s.authorize, s.Start))
+	handler.RegisterHandle(MethodStop, gsock.Guard(s.authorize, s.Stop))
+}
+
+// Status returns the maintenance state
+func (s *Service) Status(req *gsock.Request) (any, error) {
+	return s.maintenance.Status(), nil
+}
+
+// Start turns the whole app, or the given method, off
+func (s *Service) Start(req *gsock.Request) (any, error) {
+	var params StartParams
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	if params.RetryAfter < 0 {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "retryAfter must not be negative")
+	}
+	retryAfter := time.Duration(params.RetryAfter) * time.Second
+	if params.Method == "" {
+		s.maintenance.Enable(params.Reason, retryAfter)
+	} else {
+		if err := s.maintenance.DisableMethod(params.Method, params.Reason, retryAfter); err != nil {
+			return nil, err
+		}
+	}
+	return s.maintenance.Status(), nil
+}
+
+// Stop turns the whole app, or the given method, back on
+func (s *Service) Stop(req *gsock.Request) (any, error) {
+	var params StopParams
+	if err := req.DecodeOptionalParams(&params); err != nil {
+		return nil, err
+	}
+	if params.Method == "" {
+		s.maintenance.Disable()
+	} else {
+		s.maintenance.EnableMethod(params.Method)
+	}
+	return s.maintenance.Status(), nil
+}
@@ -0,0 +1,116 @@
+package gmaint
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+// newSocketServer serves an "orders.create" method and the admin methods on a Unix socket
+func newSocketServer(t *testing.T) (*gsocktest.Client, *gsock.Maintenance) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler(gsock.WithJsonRpcSimpleServiceHandlerMethods(nil))
+	handler.RegisterHandle("ping", handler.Ping)
+	handler.RegisterHandle("orders.create", func(req *gsock.Request) (any, error) {
+		return "created", nil
+	})
+	NewService(handler.Maintenance()).Register(handler)
+
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	t.Cleanup(cleanup)
+	return client, handler.Maintenance()
+}
+
+// assertRefused checks that resp carries the maintenance exception code and retry hint
+func assertRefused(t *testing.T, resp *gsock.Response, code gerror.Exception, retryAfter int) {
+	t.Helper()
+	gsocktest.AssertCode(t, resp, http.StatusBadRequest)
+	if exc := resp.Exception(); exc.Code() != code.Code() {
+		t.Fatalf("expected code %d, got %v", code.Code(), exc)
+	}
+	var notice gsock.MaintenanceNotice
+	gsocktest.DecodeData(t, resp, &notice)
+	if notice.RetryAfter != retryAfter || notice.Since.IsZero() {
+		t.Fatalf("unexpected notice %+v", notice)
+	}
+}
+
+func TestAppMaintenance(t *testing.T) {
+	client, _ := newSocketServer(t)
+
+	resp := client.Call(t, MethodStart, StartParams{Reason: "migrating orders", RetryAfter: 600})
+	gsocktest.AssertCode(t, resp, http.StatusOK)
+
+	resp = client.Call(t, "orders.create", nil)
+	assertRefused(t, resp, gerror.CodeServerBusy, 600)
+	if resp.Exception().Message() != "migrating orders" {
+		t.Fatalf("unexpected message %q", resp.Message)
+	}
+
+	// Health and admin methods stay up
+	gsocktest.AssertData(t, client.Call(t, "ping", nil), "pong")
+	gsocktest.AssertCode(t, client.Call(t, gsock.MethodMethods, nil), http.StatusOK)
+
+	var status gsock.MaintenanceStatus
+	gsocktest.DecodeData(t, client.Call(t, MethodStatus, nil), &status)
+	if status.App == nil || status.App.Reason != "migrating orders" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	gsocktest.AssertCode(t, client.Call(t, MethodStop, nil), http.StatusOK)
+	gsocktest.AssertData(t, client.Call(t, "orders.create", nil), "created")
+}
+
+func TestMethodMaintenance(t *testing.T) {
+	client, maintenance := newSocketServer(t)
+
+	// Disabled without a retry hint, the method is not supported
+	gsocktest.AssertCode(t, client.Call(t, MethodStart, StartParams{Method: "orders.create"}), http.StatusOK)
+	assertRefused(t, client.Call(t, "orders.create", nil), gerror.CodeNotSupported, 0)
+	gsocktest.AssertData(t, client.Call(t, "ping", nil), "pong")
+
+	gsocktest.AssertCode(t, client.Call(t, MethodStop, StopParams{Method: "orders.create"}), http.StatusOK)
+	gsocktest.AssertData(t, client.Call(t, "orders.create", nil), "created")
+
+	// Config replaces the state; disabled methods with a retry hint are only busy
+	config, err := gsock.LoadMaintenanceConfig(map[string]any{
+		"methods": map[string]any{"orders.create": map[string]any{"reason": "reindexing", "retryAfter": 30}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := maintenance.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	assertRefused(t, client.Call(t, "orders.create", nil), gerror.CodeServerBusy, 30)
+
+	gsocktest.AssertCode(t, client.Call(t, MethodStart, StartParams{RetryAfter: -1}), http.StatusBadRequest)
+
+	// The admin and health methods cannot be turned off, so the app cannot lock itself out
+	for _, method := range []string{MethodStop, MethodStart, "ping", gsock.MethodMethods} {
+		gsocktest.AssertCode(t, client.Call(t, MethodStart, StartParams{Method: method}), http.StatusBadRequest)
+	}
+	config.Methods = map[string]gsock.MaintenanceRule{MethodStop: {Reason: "oops"}}
+	if err := maintenance.Apply(config); err == nil {
+		t.Fatal("config turning off an admin method applied")
+	}
+	gsocktest.AssertCode(t, client.Call(t, MethodStop, nil), http.StatusOK)
+}
+
+func TestAuthorization(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	NewService(handler.Maintenance()).Register(handler)
+	pipe, cleanup := gsocktest.NewPipeServer(gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	// Pipes carry no peer credentials, so the default authorizer denies them
+	exc := pipe.Call(t, MethodStart, nil).Exception()
+	if exc == nil || exc.Code() != gerror.CodeNotAuthorized.Code() {
+		t.Fatalf("pipe peer not denied: %v", exc)
+	}
+	if handler.Maintenance().Status().App != nil {
+		t.Fatal("denied call changed the maintenance state")
+	}
+}
@@ -0,0 +1,275 @@
+package gmiddleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/os/gcache"
+)
+
+const (
+	// DefaultCacheTTL is how long a cached response is served as fresh
+	DefaultCacheTTL = 5 * time.Second
+
+	// DefaultCacheSize bounds the number of cached responses across all routes
+	DefaultCacheSize = 512
+
+	// DefaultCacheUserMetaKey is the request meta key identifying the calling user
+	DefaultCacheUserMetaKey = "user"
+
+	// DefaultCacheLanguageMetaKey is the request meta key carrying the language of messages
+	DefaultCacheLanguageMetaKey = "lang"
+)
+
+// CacheKeyFunc returns the part of a cache key that tells apart callers sharing a method and
+// params, such as users or languages; requests with different variants never share a result
+type CacheKeyFunc func(req *gsock.Request) string
+
+// UserLanguageCacheKey varies cached results by the user and language in the request meta
+// It is the default CacheKeyFunc.
+func UserLanguageCacheKey(req *gsock.Request) string {
+	return "user:" + req.MetaString(DefaultCacheUserMetaKey) + " lang:" + req.MetaString(DefaultCacheLanguageMetaKey)
+}
+
+// CacheOptFunc defines functions for configuring the response cache
+type CacheOptFunc func(*Cache)
+
+// WithCacheTTLOption sets the default fresh lifetime of cached responses
+func WithCacheTTLOption(ttl time.Duration) CacheOptFunc {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithCacheStaleOption sets how long an expired response may still be served
+// while it is refreshed in the background (stale-while-revalidate)
+func WithCacheStaleOption(stale time.Duration) CacheOptFunc {
+	return func(c *Cache) {
+		c.stale = stale
+	}
+}
+
+// WithCacheSizeOption sets the maximum number of cached responses
+func WithCacheSizeOption(size int) CacheOptFunc {
+	return func(c *Cache) {
+		c.size = size
+	}
+}
+
+// WithCacheKeyFuncOption sets how cached results are varied beyond method and params
+func WithCacheKeyFuncOption(keyFunc CacheKeyFunc) CacheOptFunc {
+	return func(c *Cache) {
+		c.keyFunc = keyFunc
+	}
+}
+
+// cacheEntry is a cached handler result
+type cacheEntry struct {
+	body       any       // Handler result
+	freshUntil time.Time // After this the entry is stale
+}
+
+// Cache caches results of read-only routes keyed by method, canonicalized params and the
+// caller's variant (by default user and language, see UserLanguageCacheKey)
+// Only successful results are cached. The same Cache may be attached to several routes;
+// Route returns a variant with route specific lifetimes.
+//
+//	cache := gmiddleware.NewCache()
+//	ds.RegisterHandle("system.info", hand.Info, cache)
+//	ds.RegisterHandle("file.list", hand.List, cache.Route(2*time.Second, 30*time.Second))
+//	...
+//	cache.Invalidate("file.list", `{"path":"/var`)
+type Cache struct {
+	mu         sync.Mutex          // Protects refreshing and generations, orders stores after invalidations
+	refreshing map[string]struct{} // Keys currently revalidated in the background
+	generation map[string]uint64   // Invalidations per method, so results computed before one are not stored
+	purges     uint64              // Purges, counted into every method's generation
+	entries    *gcache.Cache       // LRU storage shared by all routes
+	ttl        time.Duration       // Default fresh lifetime
+	stale      time.Duration       // Default stale window
+	size       int                 // LRU capacity
+	keyFunc    CacheKeyFunc        // Variant of a request's key
+}
+
+// NewCache creates a response cache middleware
+func NewCache(opts ...CacheOptFunc) *Cache {
+	c := &Cache{
+		refreshing: make(map[string]struct{}),
+		generation: make(map[string]uint64),
+		ttl:        DefaultCacheTTL,
+		size:       DefaultCacheSize,
+		keyFunc:    UserLanguageCacheKey,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.entries = gcache.New(c.size)
+	return c
+}
+
+// Route returns a middleware sharing this cache's storage with its own lifetimes
+func (c *Cache) Route(ttl, stale time.Duration) *CacheRoute {
+	return &CacheRoute{cache: c, ttl: ttl, stale: stale}
+}
+
+// Invalidate drops cached results of method whose canonical params start with prefix
+// An empty prefix drops every result of the method. Results of every variant are dropped.
+// Returns the number of removed entries.
+// Results of the method still being computed when Invalidate is called are not cached.
+func (c *Cache) Invalidate(method, prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation[method]++
+	return c.entries.RemovePrefix(cacheKey(method, prefix))
+}
+
+// Purge drops every cached result, including results still being computed
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purges++
+	c.entries.Clear()
+}
+
+// ProcessRequest implements gsock.RPCMiddleware; caching happens in WrapHandler
+func (c *Cache) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware; caching happens in WrapHandler
+func (c *Cache) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper using the default lifetimes
+func (c *Cache) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return c.wrap(api, next, c.ttl, c.stale)
+}
+
+// wrap builds the caching handler for one route
+func (c *Cache) wrap(api string, next gsock.HandlerFunc, ttl, stale time.Duration) gsock.HandlerFunc {
+	return func(req *gsock.Request) (any, error) {
+		var params []byte
+		if raw := req.RawRequest(); raw != nil && raw.Params != nil {
+			params = *raw.Params
+		}
+		key := cacheKey(api, canonicalParams(params)) + "\x00" + c.keyFunc(req)
+
+		if stored, ok := c.entries.Get(key); ok {
+			entry := stored.(*cacheEntry)
+			if time.Now().Before(entry.freshUntil) {
+				return entry.body, nil
+			}
+			// Stale but still within the stale window: answer now, refresh once in the background
+			c.revalidate(api, key, req, next, ttl, stale)
+			return entry.body, nil
+		}
+
+		generation := c.generationOf(api)
+		body, err := next(req)
+		if err == nil {
+			c.store(api, key, generation, body, ttl, stale)
+		}
+		return body, err
+	}
+}
+
+// revalidate refreshes a stale key unless a refresh is already running
+func (c *Cache) revalidate(api, key string, req *gsock.Request, next gsock.HandlerFunc, ttl, stale time.Duration) {
+	c.mu.Lock()
+	if _, ok := c.refreshing[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	generation := c.generation[api] + c.purges
+	c.mu.Unlock()
+
+	// The caller's context ends with its request, so the refresh keeps its values without
+	// its cancellation, along with the session and connection handlers may rely on
+	detached := gsock.MakeRequest(
+		gsock.WithRequestCtxOption(context.WithoutCancel(req.Context())),
+		gsock.WithRequestReqOption(req.RawRequest()),
+		gsock.WithRequestConnOption(req.Conn()),
+		gsock.WithRequestSessionOption(req.Session()),
+	)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		if body, err := next(detached); err == nil {
+			c.store(api, key, generation, body, ttl, stale)
+		}
+	}()
+}
+
+// generationOf returns the current generation of method, taken before its handler runs
+func (c *Cache) generationOf(method string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation[method] + c.purges
+}
+
+// store saves a result; it stays in the LRU for its fresh and stale lifetime
+// Results computed before an invalidation of the method (generation changed) are dropped
+func (c *Cache) store(method, key string, generation uint64, body any, ttl, stale time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation[method]+c.purges != generation {
+		return
+	}
+	c.entries.Set(key, &cacheEntry{body: body, freshUntil: time.Now().Add(ttl)}, ttl+stale)
+}
+
+// CacheRoute is a route specific view of a Cache
+type CacheRoute struct {
+	cache *Cache        // Shared storage
+	ttl   time.Duration // Fresh lifetime for this route
+	stale time.Duration // Stale window for this route
+}
+
+// ProcessRequest implements gsock.RPCMiddleware
+func (r *CacheRoute) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware
+func (r *CacheRoute) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper
+func (r *CacheRoute) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return r.cache.wrap(api, next, r.ttl, r.stale)
+}
+
+// cacheKey joins a method and its canonical params; the variant follows them after a NUL byte
+// so params prefixes still select entries for Invalidate
+func cacheKey(method, params string) string {
+	return method + " " + params
+}
+
+// canonicalParams re-encodes params with sorted object keys and no insignificant whitespace,
+// so equivalent requests share a cache key
+func canonicalParams(params []byte) string {
+	if len(bytes.TrimSpace(params)) == 0 {
+		return ""
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return string(params)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return string(params)
+	}
+	return string(data)
+}
@@ -0,0 +1,270 @@
+package gmiddleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/config"
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// DefaultFaultMessage is the message of injected errors configured without one
+const DefaultFaultMessage = "injected fault"
+
+// errFaultDropped is returned by calls whose connection was closed by a fault;
+// the reply is lost with the connection
+var errFaultDropped = errors.New("connection dropped by fault injection")
+
+// FaultRule describes a fault injected into matching calls
+// Latency combines with the other faults; of Drop, ErrorCode and Truncate the first set one applies
+type FaultRule struct {
+	Methods   []string `json:"methods"`   // Method patterns in path.Match syntax ("orders.*"); empty matches every method
+	Percent   float64  `json:"percent"`   // Share of matching calls affected, 0-100; 100 when zero
+	Latency   string   `json:"latency"`   // Delay before the handler runs, as a duration ("250ms")
+	ErrorCode int      `json:"errorCode"` // gerror code answered instead of running the handler
+	Message   string   `json:"message"`   // Message of the injected error, DefaultFaultMessage when empty
+	Drop      bool     `json:"drop"`      // Close the connection without answering
+	Truncate  bool     `json:"truncate"`  // Run the handler, send half of the reply frame and close the connection
+
+	latency time.Duration
+}
+
+// matches reports whether the rule applies to method
+func (r *FaultRule) matches(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, pattern := range r.Methods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// exception returns the injected error
+func (r *FaultRule) exception() gerror.Exception {
+	message := r.Message
+	if message == "" {
+		message = DefaultFaultMessage
+	}
+	return gerror.New(r.ErrorCode, message, nil)
+}
+
+// FaultConfig is the "fault" config section
+//
+//	"fault": {
+//	  "enabled": true,
+//	  "rules": [
+//	    {"methods": ["orders.*"], "percent": 20, "errorCode": 200063, "message": "busy"},
+//	    {"percent": 50, "latency": "800ms"}
+//	  ]
+//	}
+type FaultConfig struct {
+	Enabled bool        `json:"enabled"` // Turns fault injection on outside prod
+	Rules   []FaultRule `json:"rules"`   // Tried in order; the first matching rule whose percentage hits applies
+}
+
+// LoadFaultConfig creates a FaultConfig from a map of configuration data
+func LoadFaultConfig(cData map[string]any) (*FaultConfig, error) {
+	data, err := json.Marshal(cData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fault config: %w", err)
+	}
+	var cfg FaultConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fault config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Fault injects latency, errors, dropped connections and truncated replies into calls,
+// for testing how clients handle failures against a real app
+// It never injects anything in the prod environment; since config.EnvString treats
+// unknown environments as prod, it has to be created with ENV_DEV or ENV_TEST explicitly.
+// Attach it to routes, or wrap the whole handler to cover every method:
+//
+//	cfg, _ := gmiddleware.LoadFaultConfig(core.Container.CfgFmt().GetValue("fault").MapWithOutErr())
+//	fault, err := gmiddleware.NewFault(config.NewEnvString(env), cfg)
+//	ds.RegisterHandle("orders.create", hand.Create, fault)
+//	service := gsock.NewDefaultJsonRpcSimpleService(fault.Handler(handler))
+type Fault struct {
+	rules   []FaultRule // Parsed rules
+	enabled bool        // Config enabled and env is not prod
+}
+
+// NewFault creates a fault injection middleware for the given environment
+// An error is returned for invalid latencies, percentages or method patterns
+func NewFault(env config.EnvString, cfg *FaultConfig) (*Fault, error) {
+	f := &Fault{
+		rules:   make([]FaultRule, len(cfg.Rules)),
+		enabled: cfg.Enabled && env.String() != config.ENV_PROD.String(),
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Latency != "" {
+			latency, err := time.ParseDuration(rule.Latency)
+			if err != nil {
+				return nil, fmt.Errorf("fault rule %d: %w", i, err)
+			}
+			rule.latency = latency
+		}
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return nil, fmt.Errorf("fault rule %d: percent %v is not between 0 and 100", i, rule.Percent)
+		}
+		if rule.Percent == 0 {
+			rule.Percent = 100
+		}
+		for _, pattern := range rule.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("fault rule %d: pattern %q: %w", i, pattern, err)
+			}
+		}
+		f.rules[i] = rule
+	}
+	return f, nil
+}
+
+// Enabled reports whether faults are injected
+func (f *Fault) Enabled() bool {
+	return f.enabled
+}
+
+// pick returns the rule to apply to a call of method, nil for none
+func (f *Fault) pick(method string) *FaultRule {
+	if !f.enabled {
+		return nil
+	}
+	for i := range f.rules {
+		rule := &f.rules[i]
+		if rule.matches(method) && rand.Float64()*100 < rule.Percent {
+			return rule
+		}
+	}
+	return nil
+}
+
+// ProcessRequest implements gsock.RPCMiddleware; faults are injected in WrapHandler
+func (f *Fault) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware; faults are injected in WrapHandler
+func (f *Fault) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper
+func (f *Fault) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return func(req *gsock.Request) (any, error) {
+		rule := f.pick(api)
+		if rule == nil {
+			return next(req)
+		}
+		if err := f.before(req, rule); err != nil {
+			return nil, err
+		}
+		body, err := next(req)
+		if rule.Truncate {
+			response := gsock.NewResponse()
+			response.SetEndpoint(api)
+			return nil, truncate(req, response.WithResult(body, err))
+		}
+		return body, err
+	}
+}
+
+// Handler wraps a service handler so faults apply to every method it dispatches
+func (f *Fault) Handler(next gsock.IRpcServiceHandle) gsock.IRpcServiceHandle {
+	return &faultHandler{IRpcServiceHandle: next, fault: f}
+}
+
+// faultHandler injects faults around a service handler
+type faultHandler struct {
+	gsock.IRpcServiceHandle
+	fault *Fault
+}
+
+// Handle implements gsock.IRpcServiceHandle
+func (h *faultHandler) Handle(req *gsock.Request) (any, error) {
+	rule := h.fault.pick(req.Method())
+	if rule == nil {
+		return h.IRpcServiceHandle.Handle(req)
+	}
+	if err := h.fault.before(req, rule); err != nil {
+		// Injected errors are answered in the usual envelope
+		response := gsock.NewResponse()
+		response.SetEndpoint(req.Method())
+		return response.WithResult(nil, err), nil
+	}
+	response, err := h.IRpcServiceHandle.Handle(req)
+	if rule.Truncate && err == nil {
+		return nil, truncate(req, response)
+	}
+	return response, err
+}
+
+// Unwrap returns the wrapped handler, see gsock.IUnwrapHandle
+func (h *faultHandler) Unwrap() gsock.IRpcServiceHandle {
+	return h.IRpcServiceHandle
+}
+
+// before applies the faults injected before the handler runs
+// A non-nil error answers the call instead of the handler
+func (f *Fault) before(req *gsock.Request, rule *FaultRule) error {
+	if rule.latency > 0 {
+		timer := time.NewTimer(rule.latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return req.Context().Err()
+		}
+	}
+	switch {
+	case rule.Drop:
+		closeConn(req)
+		return errFaultDropped
+	case rule.ErrorCode != 0:
+		return rule.exception()
+	}
+	return nil
+}
+
+// truncate sends the first half of the reply frame for result and closes the connection
+// The partial frame is written past the JSON-RPC connection, so it may interleave with
+// replies to other calls in flight on the same connection
+func truncate(req *gsock.Request, result any) error {
+	defer closeConn(req)
+
+	raw := req.RawRequest()
+	session := req.Session()
+	if raw == nil || raw.Notif || session == nil {
+		return errFaultDropped
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	message := json.RawMessage(data)
+	frame, err := json.Marshal(&jsonrpc2.Response{ID: raw.ID, Result: &message})
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(frame))
+	_, _ = session.NetConn().Write(append([]byte(header), frame[:len(frame)/2]...))
+	return errFaultDropped
+}
+
+// closeConn closes the connection a request arrived on
+func closeConn(req *gsock.Request) {
+	if session := req.Session(); session != nil {
+		_ = session.Close()
+	} else if conn := req.Conn(); conn != nil {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,215 @@
+package gmiddleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/os/gcache"
+)
+
+const (
+	// DefaultIdempotencyMetaKey is the request meta key carrying the idempotency key
+	DefaultIdempotencyMetaKey = "idempotencyKey"
+
+	// DefaultIdempotencyTTL is how long a stored result answers retries
+	DefaultIdempotencyTTL = 10 * time.Minute
+
+	// DefaultIdempotencySize bounds the number of stored results
+	DefaultIdempotencySize = 1024
+
+	// DefaultIdempotencyUserMetaKey is the request meta key identifying the calling user
+	DefaultIdempotencyUserMetaKey = "user"
+)
+
+// IdempotencyKeyFunc returns the key a request's result is stored under within its route
+// idemKey is the non-empty idempotency key sent in the request meta
+type IdempotencyKeyFunc func(req *gsock.Request, idemKey string) string
+
+// CallerIdempotencyKey scopes idemKey to the caller. On Unix sockets the caller is the user
+// ID of the peer process, so the scope is per uid: processes running as the same user share
+// their keys. The user in the request meta is set by the client and is only used when the
+// transport carries no peer credentials. It is the default IdempotencyKeyFunc.
+func CallerIdempotencyKey(req *gsock.Request, idemKey string) string {
+	if session := req.Session(); session != nil {
+		if cred, err := session.PeerCred(); err == nil {
+			return fmt.Sprintf("uid:%d %s", cred.UID, idemKey)
+		}
+	}
+	return "user:" + req.MetaString(DefaultIdempotencyUserMetaKey) + " " + idemKey
+}
+
+// IdempotencyOptFunc defines functions for configuring the idempotency middleware
+type IdempotencyOptFunc func(*Idempotency)
+
+// WithIdempotencyTTLOption sets how long a stored result is replayed
+func WithIdempotencyTTLOption(ttl time.Duration) IdempotencyOptFunc {
+	return func(i *Idempotency) {
+		i.ttl = ttl
+	}
+}
+
+// WithIdempotencySizeOption sets the maximum number of stored results
+func WithIdempotencySizeOption(size int) IdempotencyOptFunc {
+	return func(i *Idempotency) {
+		i.size = size
+	}
+}
+
+// WithIdempotencyMetaKeyOption sets the request meta key holding the idempotency key
+func WithIdempotencyMetaKeyOption(key string) IdempotencyOptFunc {
+	return func(i *Idempotency) {
+		i.metaKey = key
+	}
+}
+
+// WithIdempotencyKeyFuncOption sets how the storage key of a request is derived from its
+// idempotency key, e.g. to scope keys by tenant
+func WithIdempotencyKeyFuncOption(keyFunc IdempotencyKeyFunc) IdempotencyOptFunc {
+	return func(i *Idempotency) {
+		i.keyFunc = keyFunc
+	}
+}
+
+// idempotencyResult is the first result produced for a key
+type idempotencyResult struct {
+	body any
+	err  error
+}
+
+// idempotencyCall tracks a handler execution that duplicates are waiting on
+type idempotencyCall struct {
+	done   chan struct{}
+	result idempotencyResult
+}
+
+// Idempotency suppresses duplicate executions of non-idempotent routes
+// Requests carrying the same idempotency key in their meta get the stored first result
+// instead of running the handler again, and concurrent duplicates wait for the
+// in-flight call. Requests without a key are passed through untouched.
+// Keys are scoped by route and by caller, the peer uid by default (see CallerIdempotencyKey).
+// Transient failures, such as busy replies, transport errors and cancellations, are not
+// stored, so a retry runs again.
+//
+//	idem := gmiddleware.NewIdempotency()
+//	ds.RegisterHandle("user.create", hand.CreateUser, idem)
+type Idempotency struct {
+	mu       sync.Mutex                  // Protects inflight
+	inflight map[string]*idempotencyCall // Calls currently executing by key
+	results  *gcache.Cache               // Completed results by key
+	ttl      time.Duration               // Result lifetime
+	size     int                         // Result cache capacity
+	metaKey  string                      // Meta key carrying the idempotency key
+	keyFunc  IdempotencyKeyFunc          // Derives storage keys from idempotency keys
+}
+
+// NewIdempotency creates an idempotency middleware
+func NewIdempotency(opts ...IdempotencyOptFunc) *Idempotency {
+	i := &Idempotency{
+		inflight: make(map[string]*idempotencyCall),
+		ttl:      DefaultIdempotencyTTL,
+		size:     DefaultIdempotencySize,
+		metaKey:  DefaultIdempotencyMetaKey,
+		keyFunc:  CallerIdempotencyKey,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.results = gcache.New(i.size)
+	return i
+}
+
+// ProcessRequest implements gsock.RPCMiddleware; deduplication happens in WrapHandler
+func (i *Idempotency) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware; deduplication happens in WrapHandler
+func (i *Idempotency) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper
+func (i *Idempotency) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return func(req *gsock.Request) (any, error) {
+		idemKey := req.MetaString(i.metaKey)
+		if idemKey == "" {
+			return next(req)
+		}
+		key := i.key(api, req, idemKey)
+
+		i.mu.Lock()
+		if stored, ok := i.results.Get(key); ok {
+			i.mu.Unlock()
+			result := stored.(idempotencyResult)
+			return result.body, result.err
+		}
+		if call, ok := i.inflight[key]; ok {
+			i.mu.Unlock()
+			select {
+			case <-call.done:
+				return call.result.body, call.result.err
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		call := &idempotencyCall{done: make(chan struct{})}
+		i.inflight[key] = call
+		i.mu.Unlock()
+
+		completed := false
+		defer func() {
+			if !completed {
+				// The handler panicked; release the waiters without storing anything
+				call.result = idempotencyResult{err: fmt.Errorf("request %s was interrupted", idemKey)}
+			}
+			i.mu.Lock()
+			if completed && !transient(call.result.err) {
+				i.results.Set(key, call.result, i.ttl)
+			}
+			delete(i.inflight, key)
+			i.mu.Unlock()
+			close(call.done)
+		}()
+
+		body, err := next(req)
+		call.result = idempotencyResult{body: body, err: err}
+		completed = true
+		return body, err
+	}
+}
+
+// Forget drops the stored result for the idempotency key of req on api,
+// so the next request with that key runs the handler again
+func (i *Idempotency) Forget(api string, req *gsock.Request) {
+	if idemKey := req.MetaString(i.metaKey); idemKey != "" {
+		i.results.Remove(i.key(api, req, idemKey))
+	}
+}
+
+// key returns the storage key of a request; keys are scoped by method so one key
+// cannot replay another route's result
+func (i *Idempotency) key(api string, req *gsock.Request, idemKey string) string {
+	return fmt.Sprintf("%s:%s", api, i.keyFunc(req, idemKey))
+}
+
+// transient reports whether err is a passing condition rather than the outcome of the
+// operation, so replaying it for the whole TTL would be wrong
+func transient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return gsock.IsRetryable(err) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, jsonrpc2.ErrClosed) ||
+		errors.As(err, &netErr)
+}
@@ -0,0 +1,372 @@
+package gmiddleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/config"
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+func newMiddlewareRequest(t *testing.T, method string, params, meta any) *gsock.Request {
+	req := &jsonrpc2.Request{Method: method}
+	if params != nil {
+		if err := req.SetParams(params); err != nil {
+			t.Fatalf("set params failed: %v", err)
+		}
+	}
+	if meta != nil {
+		if err := req.SetMeta(meta); err != nil {
+			t.Fatalf("set meta failed: %v", err)
+		}
+	}
+	return gsock.MakeRequest(gsock.WithRequestReqOption(req))
+}
+
+func TestIdempotencySuppressesDuplicates(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("user.create", func(req *gsock.Request) (any, error) {
+		<-release
+		return atomic.AddInt32(&calls, 1), nil
+	}, NewIdempotency())
+
+	meta := map[string]any{"idempotencyKey": "k-1"}
+	wg := &sync.WaitGroup{}
+	results := make([]any, 5)
+	for n := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			resp, _ := handler.Handle(newMiddlewareRequest(t, "user.create", nil, meta))
+			results[n] = resp.(*gsock.Response).Data
+		}(n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// A retry after completion is answered from the stored result
+	resp, _ := handler.Handle(newMiddlewareRequest(t, "user.create", nil, meta))
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	for _, data := range append(results, resp.(*gsock.Response).Data) {
+		if data != int32(1) {
+			t.Fatalf("unexpected shared result: %v", data)
+		}
+	}
+
+	// Requests without a key are never deduplicated
+	handler.Handle(newMiddlewareRequest(t, "user.create", nil, nil))
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyScopesCallersAndSkipsTransientErrors(t *testing.T) {
+	var calls int32
+	idem := NewIdempotency()
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("user.create", func(req *gsock.Request) (any, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, gerror.CodeServerBusy
+		}
+		return req.MetaString("user"), nil
+	}, idem)
+
+	alice := map[string]any{"idempotencyKey": "k-1", "user": "alice"}
+	bob := map[string]any{"idempotencyKey": "k-1", "user": "bob"}
+
+	// The busy failure is not replayed: the retry runs the handler
+	resp, _ := handler.Handle(newMiddlewareRequest(t, "user.create", nil, alice))
+	if resp.(*gsock.Response).Code == 200 {
+		t.Fatalf("expected busy reply, got %#v", resp)
+	}
+	resp, _ = handler.Handle(newMiddlewareRequest(t, "user.create", nil, alice))
+	if calls != 2 || resp.(*gsock.Response).Data != "alice" {
+		t.Fatalf("retry after busy reply not executed: %d calls, %v", calls, resp.(*gsock.Response).Data)
+	}
+
+	// Another caller reusing the key gets its own result
+	resp, _ = handler.Handle(newMiddlewareRequest(t, "user.create", nil, bob))
+	if calls != 3 || resp.(*gsock.Response).Data != "bob" {
+		t.Fatalf("key shared across callers: %d calls, %v", calls, resp.(*gsock.Response).Data)
+	}
+
+	idem.Forget("user.create", newMiddlewareRequest(t, "user.create", nil, alice))
+	handler.Handle(newMiddlewareRequest(t, "user.create", nil, alice))
+	handler.Handle(newMiddlewareRequest(t, "user.create", nil, bob))
+	if calls != 4 {
+		t.Fatalf("handler ran %d times, want 4", calls)
+	}
+}
+
+func TestIdempotencyScopesSocketCallersByPeerUID(t *testing.T) {
+	var calls int32
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("user.create", func(req *gsock.Request) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		return req.MetaString("user"), nil
+	}, NewIdempotency())
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	// The user meta is client-controlled: a peer with the same uid replays the stored result
+	for _, user := range []string{"alice", "bob"} {
+		meta := jsonrpc2.Meta(map[string]any{"idempotencyKey": "k-1", "user": user})
+		if resp := client.Call(t, "user.create", nil, meta); resp.Data != "alice" {
+			t.Fatalf("unexpected result for %s: %v", user, resp.Data)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestCacheServesAndInvalidates(t *testing.T) {
+	var calls int32
+	cache := NewCache(WithCacheTTLOption(time.Minute))
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.list", func(req *gsock.Request) (any, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}, cache)
+
+	// Key order and whitespace do not matter
+	handler.Handle(newMiddlewareRequest(t, "file.list", map[string]any{"path": "/", "all": true}, nil))
+	req := &jsonrpc2.Request{Method: "file.list"}
+	raw := []byte(`{ "all": true, "path": "/" }`)
+	req.Params = (*json.RawMessage)(&raw)
+	resp, _ := handler.Handle(gsock.MakeRequest(gsock.WithRequestReqOption(req)))
+	if calls != 1 || resp.(*gsock.Response).Data != int32(1) {
+		t.Fatalf("expected cached response, handler ran %d times", calls)
+	}
+
+	if n := cache.Invalidate("file.list", ""); n != 1 {
+		t.Fatalf("invalidated %d entries, want 1", n)
+	}
+	handler.Handle(newMiddlewareRequest(t, "file.list", map[string]any{"path": "/", "all": true}, nil))
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestCacheDropsResultsComputedBeforeInvalidate(t *testing.T) {
+	var calls int32
+	started, release := make(chan struct{}), make(chan struct{})
+	cache := NewCache(WithCacheTTLOption(time.Minute))
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.list", func(req *gsock.Request) (any, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return calls, nil
+	}, cache)
+
+	// The first call reads the old state, the invalidation lands while it runs
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.Handle(newMiddlewareRequest(t, "file.list", nil, nil))
+	}()
+	<-started
+	cache.Invalidate("file.list", "")
+	close(release)
+	<-done
+
+	resp, _ := handler.Handle(newMiddlewareRequest(t, "file.list", nil, nil))
+	if calls != 2 || resp.(*gsock.Response).Data != int32(2) {
+		t.Fatalf("stale result cached after invalidation, handler ran %d times", calls)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	cache := NewCache()
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("system.info", func(req *gsock.Request) (any, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}, cache.Route(10*time.Millisecond, time.Minute))
+
+	handler.Handle(newMiddlewareRequest(t, "system.info", nil, nil))
+	time.Sleep(20 * time.Millisecond)
+
+	// The stale value is served immediately while a refresh runs
+	resp, _ := handler.Handle(newMiddlewareRequest(t, "system.info", nil, nil))
+	if resp.(*gsock.Response).Data != int32(1) {
+		t.Fatalf("expected stale value, got %v", resp.(*gsock.Response).Data)
+	}
+	time.Sleep(20 * time.Millisecond)
+	resp, _ = handler.Handle(newMiddlewareRequest(t, "system.info", nil, nil))
+	if resp.(*gsock.Response).Data != int32(2) {
+		t.Fatalf("expected refreshed value, got %v", resp.(*gsock.Response).Data)
+	}
+}
+
+func TestCacheVariesByCallerAndKeepsRequestScope(t *testing.T) {
+	type ctxKey struct{}
+	var calls int32
+	values := make(chan any, 4)
+	cache := NewCache()
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("user.profile", func(req *gsock.Request) (any, error) {
+		values <- req.Context().Value(ctxKey{})
+		atomic.AddInt32(&calls, 1)
+		return req.MetaString("user") + "/" + req.MetaString("lang"), nil
+	}, cache.Route(10*time.Millisecond, time.Minute))
+
+	request := func(user, lang string) *gsock.Request {
+		req := newMiddlewareRequest(t, "user.profile", nil, map[string]any{"user": user, "lang": lang})
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, user))
+		t.Cleanup(cancel)
+		return gsock.MakeRequest(gsock.WithRequestCtxOption(ctx), gsock.WithRequestReqOption(req.RawRequest()))
+	}
+	for _, caller := range [][2]string{{"alice", "en"}, {"alice", "zh-CN"}, {"bob", "en"}} {
+		resp, _ := handler.Handle(request(caller[0], caller[1]))
+		if want := caller[0] + "/" + caller[1]; resp.(*gsock.Response).Data != want {
+			t.Fatalf("got %v, want %s", resp.(*gsock.Response).Data, want)
+		}
+		<-values
+	}
+	if calls != 3 {
+		t.Fatalf("handler ran %d times, want 3", calls)
+	}
+
+	// The background refresh sees the values of the request that triggered it
+	time.Sleep(20 * time.Millisecond)
+	handler.Handle(request("bob", "en"))
+	select {
+	case v := <-values:
+		if v != "bob" {
+			t.Fatalf("refresh lost request values: %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stale entry not refreshed")
+	}
+}
+
+func TestFaultRouteErrorsAndLatency(t *testing.T) {
+	cfg := &FaultConfig{Enabled: true, Rules: []FaultRule{
+		{Methods: []string{"orders.*"}, ErrorCode: gerror.CodeServerBusy.Code(), Message: "busy"},
+		{Latency: "30ms"},
+	}}
+
+	// Nothing is injected in prod, which is also what unknown environments resolve to
+	for _, env := range []config.EnvString{config.ENV_PROD, config.NewEnvString("staging")} {
+		fault, err := NewFault(env, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fault.Enabled() {
+			t.Fatalf("fault injection enabled in %q", env)
+		}
+	}
+
+	fault, err := NewFault(config.ENV_DEV, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("orders.create", func(req *gsock.Request) (any, error) {
+		return "created", nil
+	}, fault)
+	handler.RegisterHandle("system.info", func(req *gsock.Request) (any, error) {
+		return "info", nil
+	}, fault)
+
+	resp, _ := handler.Handle(newMiddlewareRequest(t, "orders.create", nil, nil))
+	if exc := resp.(*gsock.Response).Exception(); exc == nil || exc.Code() != gerror.CodeServerBusy.Code() || exc.Message() != "busy" {
+		t.Fatalf("expected injected error, got %v", exc)
+	}
+
+	start := time.Now()
+	resp, _ = handler.Handle(newMiddlewareRequest(t, "system.info", nil, nil))
+	if resp.(*gsock.Response).Data != "info" || time.Since(start) < 30*time.Millisecond {
+		t.Fatalf("expected delayed result, got %v after %v", resp.(*gsock.Response).Data, time.Since(start))
+	}
+
+	if _, err := NewFault(config.ENV_DEV, &FaultConfig{Rules: []FaultRule{{Latency: "soon"}}}); err == nil {
+		t.Fatal("invalid latency accepted")
+	}
+	if _, err := NewFault(config.ENV_DEV, &FaultConfig{Rules: []FaultRule{{Percent: 120}}}); err == nil {
+		t.Fatal("invalid percent accepted")
+	}
+}
+
+func TestFaultHandlerConnections(t *testing.T) {
+	cfg, err := LoadFaultConfig(map[string]any{
+		"enabled": true,
+		"rules": []any{
+			map[string]any{"methods": []any{"file.drop"}, "drop": true},
+			map[string]any{"methods": []any{"file.truncate"}, "truncate": true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fault, err := NewFault(config.ENV_TEST, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.truncate", func(req *gsock.Request) (any, error) {
+		return "a reply long enough to be cut in half", nil
+	})
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(fault.Handler(handler)))
+	defer cleanup()
+
+	// Unmatched methods pass through; the wrapper covers unregistered methods too
+	gsocktest.AssertCode(t, client.Call(t, "file.stat", nil), 404)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var resp gsock.Response
+	if err := gsock.NewRpcSimpleClient(client.SocketPath).Request(ctx, "file.drop", nil, &resp); err == nil {
+		t.Fatalf("dropped call answered: %+v", resp)
+	}
+
+	// A truncated reply announces the full frame but ends halfway
+	conn, err := net.Dial("unix", client.SocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	body := `{"jsonrpc":"2.0","id":1,"method":"file.truncate"}`
+	fmt.Fprintf(conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+
+	reader := bufio.NewReader(conn)
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length == 0 || len(rest) != length/2 {
+		t.Fatalf("expected %d of %d bytes, got %d", length/2, length, len(rest))
+	}
+}
@@ -0,0 +1,274 @@
+package grecord
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DemonZack/simplejrpc-go/core/gaudit"
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// tailChunkSize is how much of a recording is read at a time when looking for its last record
+const tailChunkSize = 64 << 10
+
+// Record is one request/response pair as stored in a recording
+type Record struct {
+	Seq      uint64          `json:"seq"`              // Position in the recording, starting at 1
+	Time     time.Time       `json:"time"`             // When the request arrived
+	Method   string          `json:"method"`           // RPC method
+	Params   json.RawMessage `json:"params,omitempty"` // Redacted request params
+	Meta     json.RawMessage `json:"meta,omitempty"`   // Redacted request meta
+	Notif    bool            `json:"notif,omitempty"`  // The request was a notification
+	Route    bool            `json:"route,omitempty"`  // Recorded by the route middleware, without the service meta
+	Response *gsock.Response `json:"response"`         // Redacted response envelope
+	Duration time.Duration   `json:"duration"`         // Handler run time in nanoseconds
+}
+
+// RecorderOptFunc defines functions for configuring a Recorder
+type RecorderOptFunc func(*Recorder)
+
+// WithRecorderRedactKeysOption replaces the keys whose values are masked in params, meta and responses
+func WithRecorderRedactKeysOption(keys ...string) RecorderOptFunc {
+	return func(r *Recorder) {
+		r.redactKeys = keys
+	}
+}
+
+// Recorder appends request/response pairs to a JSONL file
+// It records either every request of a service, by decorating its handler:
+//
+//	recorder, _ := grecord.NewRecorder("data/session.jsonl")
+//	ds := gsock.NewDefaultJsonRpcSimpleService(recorder.Handler(gsock.NewJsonRpcSimpleServiceHandler()))
+//
+// or selected routes, as a route middleware:
+//
+//	ds.RegisterHandle("file.list", listFiles, recorder)
+//
+// A route middleware sees the envelope before the service fills in its meta (deprecation
+// warnings, close hints), so Replay compares such records without the "meta" field.
+// Sensitive values are redacted with the same rules as core/gaudit
+type Recorder struct {
+	mu         sync.Mutex // Serializes writes
+	file       *os.File   // Open recording
+	seq        uint64     // Last written sequence number
+	redactKeys []string   // Keys masked before writing
+}
+
+// NewRecorder opens (or creates) a recording and appends to it
+// Only the tail of an existing recording is read to continue its sequence numbers; a line
+// torn by a crash mid-write is cut off
+func NewRecorder(path string, opts ...RecorderOptFunc) (*Recorder, error) {
+	r := &Recorder{redactKeys: gaudit.DefaultRedactKeys}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeFileCreateError, err, "")
+	}
+	if r.seq, err = resumeTail(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.file = file
+	return r, nil
+}
+
+// resumeTail returns the sequence number of the last record of a recording
+// A final line without newline is completed when it holds a record, and cut off otherwise
+func resumeTail(file *os.File) (uint64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, gerror.WithMessageErr(gerror.CodeFileReadError, err, "")
+	}
+
+	var tail []byte
+	offset := info.Size()
+	for offset > 0 {
+		n := min(offset, tailChunkSize)
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return 0, gerror.WithMessageErr(gerror.CodeFileReadError, err, "")
+		}
+		tail = append(chunk, tail...)
+
+		// Wait for the start of the last line, unless the file has been read whole
+		trimmed := bytes.TrimRight(tail, "\n")
+		start := bytes.LastIndexByte(trimmed, '\n')
+		if len(trimmed) == 0 || (start < 0 && offset > 0) {
+			continue
+		}
+		line := trimmed[start+1:]
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err == nil {
+			if len(trimmed) == len(tail) {
+				_, err = file.Write([]byte{'\n'})
+			}
+			return rec.Seq, err
+		}
+		if len(trimmed) < len(tail) {
+			return 0, gerror.WithMessage(gerror.CodeInvalidParameter, "corrupted recording")
+		}
+
+		// A torn line: drop it and continue from the record before
+		end := offset + int64(start+1)
+		zap.L().Warn("cut off torn recording line", zap.String("path", file.Name()), zap.Int64("offset", end))
+		if err := file.Truncate(end); err != nil {
+			return 0, gerror.WithMessageErr(gerror.CodeFileWriteError, err, "")
+		}
+		return resumeTail(file)
+	}
+	return 0, nil
+}
+
+// ProcessRequest implements gsock.RPCMiddleware; recording happens in WrapHandler
+func (r *Recorder) ProcessRequest(req *gsock.Request) {}
+
+// ProcessResponse implements gsock.RPCMiddleware; recording happens in WrapHandler
+func (r *Recorder) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// WrapHandler implements gsock.RPCHandlerWrapper and records the route's envelope
+func (r *Recorder) WrapHandler(api string, next gsock.HandlerFunc) gsock.HandlerFunc {
+	return func(req *gsock.Request) (any, error) {
+		start := time.Now()
+		data, err := next(req)
+		response := gsock.NewResponse().WithData(nil, api).WithResult(data, err)
+		r.record(req, response, start, true)
+		return data, err
+	}
+}
+
+// Handler decorates a service handler so that every request it handles is recorded,
+// including unknown methods
+func (r *Recorder) Handler(inner gsock.IRpcServiceHandle) gsock.IRpcServiceHandle {
+	return &recordingHandler{IRpcServiceHandle: inner, recorder: r}
+}
+
+// Close closes the recording
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// record redacts and appends one pair; failures are logged so recording never breaks a request
+func (r *Recorder) record(req *gsock.Request, response any, start time.Time, route bool) {
+	rec := Record{
+		Time:     start,
+		Method:   req.Method(),
+		Route:    route,
+		Duration: time.Since(start),
+	}
+	raw := req.RawRequest()
+	rec.Notif = raw.Notif
+
+	var err error
+	if raw.Params != nil {
+		rec.Params, err = gaudit.Redact(*raw.Params, r.redactKeys...)
+	}
+	if err == nil && raw.Meta != nil {
+		rec.Meta, err = gaudit.Redact(*raw.Meta, r.redactKeys...)
+	}
+	if err == nil {
+		rec.Response, err = redactResponse(response, r.redactKeys)
+	}
+	if err != nil {
+		zap.L().Warn("record rpc traffic failed", zap.String("method", rec.Method), zap.Error(err))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	rec.Seq = r.seq
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = r.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		zap.L().Warn("record rpc traffic failed", zap.String("method", rec.Method), zap.Error(err))
+	}
+}
+
+// redactResponse marshals any response and masks sensitive keys in it
+func redactResponse(response any, keys []string) (*gsock.Response, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = gaudit.Redact(data, keys...); err != nil {
+		return nil, err
+	}
+
+	var out gsock.Response
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// recordingHandler records every request passing through a service handler
+type recordingHandler struct {
+	gsock.IRpcServiceHandle
+	recorder *Recorder
+}
+
+// Handle implements gsock.IRpcServiceHandle
+func (h *recordingHandler) Handle(req *gsock.Request) (any, error) {
+	start := time.Now()
+	response, err := h.IRpcServiceHandle.Handle(req)
+	if err == nil {
+		h.recorder.record(req, response, start, false)
+	}
+	return response, err
+}
+
+// Unwrap returns the recorded handler, see gsock.IUnwrapHandle
+func (h *recordingHandler) Unwrap() gsock.IRpcServiceHandle {
+	return h.IRpcServiceHandle
+}
+
+// Load reads all records of a recording
+// A torn final line, left by a crash mid-write, is skipped
+func Load(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	reader := bufio.NewReaderSize(file, 64<<10)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, gerror.WithMessageErr(gerror.CodeFileReadError, readErr, "")
+		}
+		if line = bytes.TrimRight(line, "\n"); len(line) > 0 {
+			var rec Record
+			if err := json.Unmarshal(line, &rec); err == nil {
+				records = append(records, rec)
+			} else if readErr == nil {
+				return nil, gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "corrupted recording")
+			}
+		}
+		if readErr == io.EOF {
+			return records, nil
+		}
+	}
+}
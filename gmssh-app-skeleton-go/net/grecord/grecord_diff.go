@@ -0,0 +1,130 @@
+package grecord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diff compares two values by their JSON form and lists every differing field
+// Each entry reads "<path>: recorded <want>, got <got>"; fields under an ignored path are skipped
+func Diff(want, got any, ignore ...string) ([]string, error) {
+	wantValue, err := normalize(want)
+	if err != nil {
+		return nil, err
+	}
+	gotValue, err := normalize(got)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	diffValue("", wantValue, gotValue, ignore, &diffs)
+	return diffs, nil
+}
+
+// normalize converts a value to its generic JSON form, keeping numbers verbatim
+func normalize(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var out any
+	if err := decoder.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// diffValue walks both values in parallel and appends differences to diffs
+func diffValue(path string, want, got any, ignore []string, diffs *[]string) {
+	if ignored(path, ignore) {
+		return
+	}
+
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValue(joinPath(path, k), w[k], g[k], ignore, diffs)
+		}
+		return
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		if len(w) != len(g) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: recorded %d items, got %d", displayPath(path), len(w), len(g)))
+		}
+		for i := 0; i < len(w) && i < len(g); i++ {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), w[i], g[i], ignore, diffs)
+		}
+		return
+	}
+
+	if !equalJSON(want, got) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: recorded %s, got %s", displayPath(path), render(want), render(got)))
+	}
+}
+
+// equalJSON compares two scalar or mismatched-kind JSON values
+func equalJSON(a, b any) bool {
+	return render(a) == render(b)
+}
+
+// render formats a JSON value compactly
+func render(value any) string {
+	if value == nil {
+		return "null"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// joinPath appends an object key to a path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// displayPath names the root of the document
+func displayPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+// ignored reports whether path is an ignored path or lies beneath one
+func ignored(path string, ignore []string) bool {
+	for _, prefix := range ignore {
+		if path == prefix || strings.HasPrefix(path, prefix+".") || strings.HasPrefix(path, prefix+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package grecord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gaudit"
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// ReplayOptFunc defines functions for configuring a replay
+type ReplayOptFunc func(*replayConfig)
+
+// WithReplayIgnoreOption excludes response fields from the comparison
+// Paths use the envelope layout, e.g. "data.updatedAt", "data.items[0].mtime" or "meta"
+func WithReplayIgnoreOption(paths ...string) ReplayOptFunc {
+	return func(c *replayConfig) {
+		c.ignore = append(c.ignore, paths...)
+	}
+}
+
+// WithReplayRedactKeysOption sets the keys masked in live responses before comparison
+// It must match the keys the recording was made with
+func WithReplayRedactKeysOption(keys ...string) ReplayOptFunc {
+	return func(c *replayConfig) {
+		c.redactKeys = keys
+	}
+}
+
+// WithReplayRewriteOption edits each record before it is sent
+// Use it to put back credentials that were redacted in the recording
+func WithReplayRewriteOption(rewrite func(rec *Record)) ReplayOptFunc {
+	return func(c *replayConfig) {
+		c.rewrite = rewrite
+	}
+}
+
+// replayConfig holds replay options
+type replayConfig struct {
+	ignore     []string          // Response paths excluded from the diff
+	redactKeys []string          // Keys masked in live responses
+	rewrite    func(rec *Record) // Optional record editor
+}
+
+// Mismatch describes a replayed request whose response differs from the recording
+type Mismatch struct {
+	Seq    uint64   `json:"seq"`             // Record sequence number
+	Method string   `json:"method"`          // RPC method
+	Error  string   `json:"error,omitempty"` // Transport error, if the call failed
+	Diffs  []string `json:"diffs,omitempty"` // Field differences, one per line
+}
+
+// Report summarizes a replay
+type Report struct {
+	Total      int        `json:"total"`      // Records replayed
+	Matched    int        `json:"matched"`    // Responses identical to the recording
+	Mismatches []Mismatch `json:"mismatches"` // Everything else
+}
+
+// OK reports whether every response matched
+func (r *Report) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// String renders the report for terminals and CI logs
+func (r *Report) String() string {
+	out := fmt.Sprintf("replayed %d, matched %d, mismatched %d\n", r.Total, r.Matched, len(r.Mismatches))
+	for _, m := range r.Mismatches {
+		out += fmt.Sprintf("#%d %s\n", m.Seq, m.Method)
+		if m.Error != "" {
+			out += fmt.Sprintf("    error: %s\n", m.Error)
+		}
+		for _, diff := range m.Diffs {
+			out += fmt.Sprintf("    %s\n", diff)
+		}
+	}
+	return out
+}
+
+// ReplaySocket replays a recording against the server listening on a Unix socket
+func ReplaySocket(ctx context.Context, socketPath, recording string, opts ...ReplayOptFunc) (*Report, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeOperationFailed, err, "")
+	}
+	defer conn.Close()
+
+	client := gsock.NewJsonRpcSimpleClient().NewConn(ctx, conn)
+	return Replay(ctx, client, recording, opts...)
+}
+
+// Replay sends every record of a recording through client, in order, and diffs each
+// response against the recorded one. Notifications are sent when the client supports
+// them (as JsonRpcSimpleClientHandler does) but never compared
+func Replay(ctx context.Context, client gsock.IRpcClient, recording string, opts ...ReplayOptFunc) (*Report, error) {
+	cfg := &replayConfig{redactKeys: gaudit.DefaultRedactKeys}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	records, err := Load(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Mismatches: make([]Mismatch, 0)}
+	for i := range records {
+		rec := records[i]
+		if cfg.rewrite != nil {
+			cfg.rewrite(&rec)
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		report.Total++
+		mismatch, err := replayOne(ctx, client, &rec, cfg)
+		if err != nil {
+			return report, err
+		}
+		if mismatch == nil {
+			report.Matched++
+			continue
+		}
+		report.Mismatches = append(report.Mismatches, *mismatch)
+	}
+	return report, nil
+}
+
+// replayOne sends a single record and compares the response
+func replayOne(ctx context.Context, client gsock.IRpcClient, rec *Record, cfg *replayConfig) (*Mismatch, error) {
+	var params any
+	if rec.Params != nil {
+		params = rec.Params
+	}
+	var callOpts []jsonrpc2.CallOption
+	if rec.Meta != nil {
+		callOpts = append(callOpts, jsonrpc2.Meta(rec.Meta))
+	}
+
+	if rec.Notif {
+		notifier, ok := client.(interface {
+			Notify(ctx context.Context, method string, params any, opts ...jsonrpc2.CallOption) error
+		})
+		if ok {
+			if err := notifier.Notify(ctx, rec.Method, params, callOpts...); err != nil {
+				return &Mismatch{Seq: rec.Seq, Method: rec.Method, Error: err.Error()}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	var got json.RawMessage
+	if err := client.Request(ctx, rec.Method, params, &got, callOpts...); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &Mismatch{Seq: rec.Seq, Method: rec.Method, Error: err.Error()}, nil
+	}
+
+	live, err := redactResponse(got, cfg.redactKeys)
+	if err != nil {
+		return &Mismatch{Seq: rec.Seq, Method: rec.Method, Error: err.Error()}, nil
+	}
+	ignore := cfg.ignore
+	if rec.Route {
+		ignore = append(slices.Clone(ignore), "meta")
+	}
+	diffs, err := Diff(rec.Response, live, ignore...)
+	if err != nil {
+		return nil, err
+	}
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+	return &Mismatch{Seq: rec.Seq, Method: rec.Method, Diffs: diffs}, nil
+}
@@ -0,0 +1,197 @@
+package grecord
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("open recorder failed: %v", err)
+	}
+
+	version := "1.0.0"
+	client := serve(ctx, t, recorder.Handler(gsock.NewJsonRpcSimpleServiceHandler()), &version)
+	var resp gsock.Response
+	client.Request(ctx, "user.login", map[string]string{"name": "root", "password": "hunter2"}, &resp)
+	client.Request(ctx, "app.info", nil, &resp)
+	client.Request(ctx, "app.fail", nil, &resp)
+	client.Request(ctx, "app.missing", nil, &resp)
+	recorder.Close()
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "s3cr3t") {
+		t.Fatalf("secrets leaked into the recording:\n%s", data)
+	}
+	records, err := Load(path)
+	if err != nil || len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d (%v)", len(records), err)
+	}
+	if records[2].Response.Code != 400 || records[2].Response.Message != "disk full" || records[3].Response.Code != 404 {
+		t.Fatalf("unexpected recorded responses %#v %#v", records[2].Response, records[3].Response)
+	}
+
+	// The same server replays cleanly
+	report, err := Replay(ctx, serve(ctx, t, gsock.NewJsonRpcSimpleServiceHandler(), &version), path)
+	if err != nil || !report.OK() || report.Matched != 4 {
+		t.Fatalf("unexpected replay report %v, %v", report, err)
+	}
+
+	// A changed response is reported with the differing field
+	version = "1.1.0"
+	report, _ = Replay(ctx, serve(ctx, t, gsock.NewJsonRpcSimpleServiceHandler(), &version), path)
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Method != "app.info" ||
+		report.Mismatches[0].Diffs[0] != `data.version: recorded "1.0.0", got "1.1.0"` {
+		t.Fatalf("unexpected replay report %v", report)
+	}
+	report, _ = Replay(ctx, serve(ctx, t, gsock.NewJsonRpcSimpleServiceHandler(), &version), path,
+		WithReplayIgnoreOption("data.version"))
+	if !report.OK() {
+		t.Fatalf("ignored field still reported: %v", report)
+	}
+}
+
+func TestHandlerKeepsOptionalInterfaces(t *testing.T) {
+	recorder, err := NewRecorder(filepath.Join(t.TempDir(), "session.jsonl"))
+	if err != nil {
+		t.Fatalf("open recorder failed: %v", err)
+	}
+	defer recorder.Close()
+
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	filtered, _ := gsock.NewMethodFilter(recorder.Handler(handler), "*")
+	service := gsock.NewDefaultJsonRpcSimpleService(filtered)
+	if service.Maintenance() == nil || service.Maintenance() != handler.Maintenance() {
+		t.Fatal("maintenance of the recorded handler not reachable")
+	}
+}
+
+func TestResumeTornRecording(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	version := "1.0.0"
+	for _, torn := range []string{`{"seq":3,"method":"app.in`, `{"seq":4,"method":"app.info","response":null}`} {
+		recorder, err := NewRecorder(path)
+		if err != nil {
+			t.Fatalf("open recorder failed: %v", err)
+		}
+		var resp gsock.Response
+		serve(ctx, t, recorder.Handler(gsock.NewJsonRpcSimpleServiceHandler()), &version).Request(ctx, "app.info", nil, &resp)
+		recorder.Close()
+
+		// A crash mid-write leaves a line without newline behind
+		file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		file.WriteString(torn)
+		file.Close()
+	}
+	if records, err := Load(path); err != nil || len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d (%v)", len(records), err)
+	}
+
+	// A complete record without newline is kept, a torn one is cut off
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("reopen recorder failed: %v", err)
+	}
+	var resp gsock.Response
+	serve(ctx, t, recorder.Handler(gsock.NewJsonRpcSimpleServiceHandler()), &version).Request(ctx, "app.info", nil, &resp)
+	recorder.Close()
+
+	records, err := Load(path)
+	if err != nil || len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d (%v)", len(records), err)
+	}
+	for i, rec := range records {
+		if want := []uint64{1, 2, 4, 5}[i]; rec.Seq != want {
+			t.Fatalf("record %d has seq %d, want %d", i, rec.Seq, want)
+		}
+	}
+}
+
+func TestRouteRecordsIgnoreServiceMeta(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("open recorder failed: %v", err)
+	}
+	newService := func(routeMiddlewares ...gsock.RPCMiddleware) gsock.IRpcClient {
+		service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+		routeMiddlewares = append(routeMiddlewares, gsock.WithMethodDeprecatedOption(gsock.Deprecation{Removal: "2.0"}))
+		service.RegisterHandle("app.old", func(req *gsock.Request) (any, error) {
+			return "ok", nil
+		}, routeMiddlewares...)
+
+		serverSide, clientSide := net.Pipe()
+		conn := service.NewConn(ctx, serverSide)
+		t.Cleanup(func() { conn.Close() })
+		return gsock.NewJsonRpcSimpleClient().NewConn(ctx, clientSide)
+	}
+
+	var resp gsock.Response
+	newService(recorder).Request(ctx, "app.old", nil, &resp)
+	recorder.Close()
+	if resp.Meta.Warning == "" {
+		t.Fatal("expected a deprecation warning on the wire")
+	}
+
+	report, err := Replay(ctx, newService(), path)
+	if err != nil || !report.OK() || report.Matched != 1 {
+		t.Fatalf("unexpected replay report %v, %v", report, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	want := map[string]any{"items": []any{1, 2, 3}, "name": "a", "extra": true}
+	got := map[string]any{"items": []any{1, 5}, "name": "a", "added": 1}
+
+	diffs, err := Diff(want, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"added: recorded null, got 1",
+		"extra: recorded true, got null",
+		"items: recorded 3 items, got 2",
+		"items[1]: recorded 2, got 5",
+	}
+	if strings.Join(diffs, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected diffs:\n%s", strings.Join(diffs, "\n"))
+	}
+}
+
+// serve starts a service on an in-memory connection and returns a client for it
+func serve(ctx context.Context, t *testing.T, handler gsock.IRpcServiceHandle, version *string) gsock.IRpcClient {
+	service := gsock.NewDefaultJsonRpcSimpleService(handler)
+	service.RegisterHandle("user.login", func(req *gsock.Request) (any, error) {
+		return map[string]string{"user": "root", "token": "s3cr3t"}, nil
+	})
+	service.RegisterHandle("app.info", func(req *gsock.Request) (any, error) {
+		return map[string]string{"version": *version}, nil
+	})
+	service.RegisterHandle("app.fail", func(req *gsock.Request) (any, error) {
+		return nil, errors.New("disk full")
+	})
+
+	serverSide, clientSide := net.Pipe()
+	conn := service.NewConn(ctx, serverSide)
+	t.Cleanup(func() { conn.Close() })
+	return gsock.NewJsonRpcSimpleClient().NewConn(ctx, clientSide)
+}
@@ -0,0 +1,174 @@
+// Package gconform checks app socket servers against golden wire-format fixtures,
+// so the Go module and the Python simplejrpc skeleton can be verified as interchangeable
+// back-ends. The fixtures cover framing, the response envelope, error codes, meta and
+// i18n messages; see fixtures/README.md for their format and the semantics they pin down
+//
+//	fixtures, err := gconform.Fixtures()
+//	if err != nil {
+//		return err
+//	}
+//	report := gconform.Run(ctx, "/path/to/app.sock", fixtures, gconform.WithLanguageOption("zh-CN"))
+//	fmt.Print(report)
+package gconform
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// fixtureFS holds the golden fixtures
+//
+//go:embed fixtures/*.json
+var fixtureFS embed.FS
+
+// Fixture is one conformance check, run on its own connection
+type Fixture struct {
+	Name  string  `json:"name"`  // Name, "<area>/<case>"
+	Doc   string  `json:"doc"`   // What the fixture checks
+	Steps []*Step `json:"steps"` // Steps run in order on the same connection
+}
+
+// Step writes raw chunks and reads the expected responses
+type Step struct {
+	Send   []string  `json:"send"`   // Raw chunks written verbatim, one write each
+	Expect []*Expect `json:"expect"` // Expected responses, matched by id
+}
+
+// Expect is an expected response
+type Expect struct {
+	ID     json.RawMessage `json:"id"`     // Request id the response answers
+	Result *Envelope       `json:"result"` // Expected response envelope
+}
+
+// Envelope is the expected response envelope; absent fields are not compared
+type Envelope struct {
+	Code *int            `json:"code"` // Response code
+	Data json.RawMessage `json:"data"` // Response data, compared as JSON
+	Msg  Messages        `json:"msg"`  // Message by language
+	Meta *Meta           `json:"meta"` // Response meta
+}
+
+// Meta is the expected response meta
+type Meta struct {
+	Endpoint string `json:"endpoint"` // Method the response answers
+	Close    int    `json:"close"`    // 0 keeps the caller's stream open, 1 ends it
+}
+
+// anyLanguage keys a message that is the same in every language
+const anyLanguage = "*"
+
+// Messages holds an expected message by language
+// It decodes from a string, the same in every language, or an object keyed by language
+type Messages map[string]string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (m *Messages) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = Messages{anyLanguage: s}
+		return nil
+	}
+	var byLanguage map[string]string
+	if err := json.Unmarshal(data, &byLanguage); err != nil {
+		return fmt.Errorf("msg must be a string or an object keyed by language: %w", err)
+	}
+	*m = byLanguage
+	return nil
+}
+
+// Lookup returns the message expected in lang
+func (m Messages) Lookup(lang string) (string, bool) {
+	if msg, ok := m[lang]; ok {
+		return msg, true
+	}
+	msg, ok := m[anyLanguage]
+	return msg, ok
+}
+
+// Fixtures returns the golden fixtures
+func Fixtures() ([]*Fixture, error) {
+	sub, err := fs.Sub(fixtureFS, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFixtures(sub)
+}
+
+// LoadFixtures reads the fixtures of every .json file at the root of fsys, sorted by name
+func LoadFixtures(fsys fs.FS) ([]*Fixture, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures []*Fixture
+	seen := make(map[string]string)
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var list []*Fixture
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, fixture := range list {
+			if err := fixture.validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if other, ok := seen[fixture.Name]; ok {
+				return nil, fmt.Errorf("%s: fixture %s already defined in %s", file, fixture.Name, other)
+			}
+			seen[fixture.Name] = path.Base(file)
+			fixtures = append(fixtures, fixture)
+		}
+	}
+	sort.SliceStable(fixtures, func(i, j int) bool {
+		return fixtures[i].Name < fixtures[j].Name
+	})
+	return fixtures, nil
+}
+
+// validate checks that the fixture can be run
+func (f *Fixture) validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("fixture without a name")
+	}
+	if len(f.Steps) == 0 {
+		return fmt.Errorf("fixture %s has no steps", f.Name)
+	}
+	for i, step := range f.Steps {
+		if len(step.Send) == 0 {
+			return fmt.Errorf("fixture %s step %d sends nothing", f.Name, i+1)
+		}
+		ids := make(map[string]bool)
+		for _, expect := range step.Expect {
+			if len(expect.ID) == 0 || expect.Result == nil {
+				return fmt.Errorf("fixture %s step %d: expectations need an id and a result", f.Name, i+1)
+			}
+			id := string(canonicalJSON(expect.ID))
+			if ids[id] {
+				return fmt.Errorf("fixture %s step %d expects id %s twice", f.Name, i+1, id)
+			}
+			ids[id] = true
+		}
+	}
+	return nil
+}
+
+// canonicalJSON re-encodes a JSON value so equal values compare equal as bytes
+func canonicalJSON(raw json.RawMessage) []byte {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,309 @@
+package gconform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds the run of one fixture
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultLanguage is the language expected messages are looked up in
+	DefaultLanguage = "en"
+
+	// chunkDelay separates the writes of a step, so split frames reach the server in several reads
+	chunkDelay = 20 * time.Millisecond
+)
+
+// OptFunc defines functions for configuring a conformance run
+type OptFunc func(*options)
+
+// WithNetworkOption sets the network of the server address, "unix" by default
+func WithNetworkOption(network string) OptFunc {
+	return func(o *options) {
+		o.network = network
+	}
+}
+
+// WithLanguageOption sets the language the server was started with, DefaultLanguage by default
+func WithLanguageOption(lang string) OptFunc {
+	return func(o *options) {
+		o.lang = lang
+	}
+}
+
+// WithTimeoutOption bounds the run of each fixture, DefaultTimeout by default
+func WithTimeoutOption(timeout time.Duration) OptFunc {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// options holds conformance run options
+type options struct {
+	network string        // Network of the server address
+	lang    string        // Language of expected messages
+	timeout time.Duration // Per fixture timeout
+}
+
+// Result is the outcome of one fixture
+type Result struct {
+	Fixture  *Fixture      // Fixture run
+	Failures []string      // Mismatches found, empty when the fixture passed
+	Elapsed  time.Duration // Time taken
+}
+
+// Passed reports whether the fixture passed
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Report is the outcome of a conformance run
+type Report struct {
+	Language string    // Language expected messages were looked up in
+	Results  []*Result // Results in fixture order
+}
+
+// Passed reports whether every fixture passed
+func (r *Report) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the results of the fixtures that failed
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, result := range r.Results {
+		if !result.Passed() {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// String formats the report like go test -v output
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "--- %s: %s (%.2fs)\n", status, result.Fixture.Name, result.Elapsed.Seconds())
+		for _, failure := range result.Failures {
+			fmt.Fprintf(&b, "    %s\n", failure)
+		}
+	}
+	if failed := len(r.Failed()); failed > 0 {
+		fmt.Fprintf(&b, "FAIL %d of %d fixtures (lang %s)\n", failed, len(r.Results), r.Language)
+	} else {
+		fmt.Fprintf(&b, "PASS %d fixtures (lang %s)\n", len(r.Results), r.Language)
+	}
+	return b.String()
+}
+
+// Run checks the server listening on address against fixtures, each on a new connection
+func Run(ctx context.Context, address string, fixtures []*Fixture, opts ...OptFunc) *Report {
+	o := &options{network: "unix", lang: DefaultLanguage, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	report := &Report{Language: o.lang}
+	for _, fixture := range fixtures {
+		start := time.Now()
+		failures := runFixture(ctx, o, address, fixture)
+		report.Results = append(report.Results, &Result{
+			Fixture:  fixture,
+			Failures: failures,
+			Elapsed:  time.Since(start),
+		})
+	}
+	return report
+}
+
+// runFixture runs one fixture and returns its failures
+func runFixture(ctx context.Context, o *options, address string, fixture *Fixture) []string {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, o.network, address)
+	if err != nil {
+		return []string{fmt.Sprintf("dial: %v", err)}
+	}
+	defer conn.Close()
+	// Unblock reads and writes when the context ends
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	for i, step := range fixture.Steps {
+		failures := runStep(o, conn, reader, step)
+		if len(failures) == 0 {
+			continue
+		}
+		// Later steps depend on the connection state, so the fixture stops at the first failing step
+		if len(fixture.Steps) > 1 {
+			for j := range failures {
+				failures[j] = fmt.Sprintf("step %d: %s", i+1, failures[j])
+			}
+		}
+		return failures
+	}
+	return nil
+}
+
+// runStep writes the chunks of a step and checks the responses read back
+func runStep(o *options, conn net.Conn, reader *bufio.Reader, step *Step) []string {
+	for i, chunk := range step.Send {
+		if i > 0 {
+			time.Sleep(chunkDelay)
+		}
+		if _, err := io.WriteString(conn, chunk); err != nil {
+			return []string{fmt.Sprintf("write: %v", err)}
+		}
+	}
+
+	pending := make(map[string]*Expect, len(step.Expect))
+	for _, expect := range step.Expect {
+		pending[string(canonicalJSON(expect.ID))] = expect
+	}
+
+	var failures []string
+	for len(pending) > 0 {
+		body, err := readFrame(reader)
+		if err != nil {
+			return append(failures, fmt.Sprintf("read response: %v", err))
+		}
+		var msg struct {
+			Version string           `json:"jsonrpc"`
+			ID      json.RawMessage  `json:"id"`
+			Result  json.RawMessage  `json:"result"`
+			Error   *json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return append(failures, fmt.Sprintf("response is not a JSON object: %v: %s", err, body))
+		}
+
+		id := string(canonicalJSON(msg.ID))
+		expect, ok := pending[id]
+		if !ok {
+			return append(failures, fmt.Sprintf("unexpected response with id %s: %s", id, body))
+		}
+		delete(pending, id)
+
+		prefix := "id " + id + ": "
+		if msg.Version != "2.0" {
+			failures = append(failures, prefix+fmt.Sprintf("jsonrpc is %q, want \"2.0\"", msg.Version))
+		}
+		if msg.Error != nil {
+			failures = append(failures, prefix+fmt.Sprintf("got JSON-RPC error %s, want a result envelope", *msg.Error))
+			continue
+		}
+		for _, failure := range compareEnvelope(expect.Result, msg.Result, o.lang) {
+			failures = append(failures, prefix+failure)
+		}
+	}
+	return failures
+}
+
+// readFrame reads one Content-Length framed message and returns its body
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			return nil, fmt.Errorf("header line %q does not end with \\r\\n", line)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header line %q", line)
+		}
+		if name != "Content-Length" {
+			continue
+		}
+		if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid Content-Length %q", value)
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("frame without a Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, fmt.Errorf("body shorter than Content-Length %d: %w", length, err)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("Content-Length %d does not frame a JSON value: %q", length, body)
+	}
+	return body, nil
+}
+
+// envelopeFields are the keys every response envelope carries
+var envelopeFields = []string{"code", "data", "msg", "meta"}
+
+// compareEnvelope compares a result against the expected envelope
+func compareEnvelope(want *Envelope, result json.RawMessage, lang string) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil || fields == nil {
+		return []string{fmt.Sprintf("result %s is not an envelope object", result)}
+	}
+
+	var failures []string
+	for _, key := range envelopeFields {
+		if _, ok := fields[key]; !ok {
+			failures = append(failures, fmt.Sprintf("envelope lacks %q", key))
+		}
+	}
+
+	if want.Code != nil {
+		var code int
+		if err := json.Unmarshal(fields["code"], &code); err != nil || code != *want.Code {
+			failures = append(failures, fmt.Sprintf("code: got %s, want %d", orNull(fields["code"]), *want.Code))
+		}
+	}
+	if len(want.Data) > 0 && !bytes.Equal(canonicalJSON(fields["data"]), canonicalJSON(want.Data)) {
+		failures = append(failures, fmt.Sprintf("data: got %s, want %s", orNull(fields["data"]), want.Data))
+	}
+	if msg, ok := want.Msg.Lookup(lang); ok {
+		var got string
+		if err := json.Unmarshal(fields["msg"], &got); err != nil || got != msg {
+			failures = append(failures, fmt.Sprintf("msg (%s): got %s, want %q", lang, orNull(fields["msg"]), msg))
+		}
+	}
+	if want.Meta != nil {
+		var got *Meta
+		if err := json.Unmarshal(fields["meta"], &got); err != nil || got == nil || *got != *want.Meta {
+			failures = append(failures, fmt.Sprintf("meta: got %s, want {\"endpoint\":%q,\"close\":%d}",
+				orNull(fields["meta"]), want.Meta.Endpoint, want.Meta.Close))
+		}
+	}
+	return failures
+}
+
+// orNull formats an absent JSON value as null
+func orNull(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	return raw
+}
@@ -0,0 +1,127 @@
+package gconform
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
+)
+
+func TestFixturesFrameRequests(t *testing.T) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures")
+	}
+
+	// Every step must send whole frames carrying at least one request per expected response
+	for _, fixture := range fixtures {
+		for i, step := range fixture.Steps {
+			reader := bufio.NewReader(strings.NewReader(strings.Join(step.Send, "")))
+			requests := 0
+			for reader.Buffered() > 0 || requests == 0 {
+				body, err := readFrame(reader)
+				if err != nil {
+					t.Fatalf("%s step %d: %v", fixture.Name, i+1, err)
+				}
+				var req struct {
+					ID json.RawMessage `json:"id"`
+				}
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatalf("%s step %d: %v", fixture.Name, i+1, err)
+				}
+				if req.ID != nil {
+					requests++
+				}
+			}
+			if requests != len(step.Expect) {
+				t.Errorf("%s step %d sends %d requests, expects %d responses", fixture.Name, i+1, requests, len(step.Expect))
+			}
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	for _, tc := range []struct {
+		frame, err string
+	}{
+		{"Content-Length: 2\r\n\r\n{}", ""},
+		{"Content-Length: 2\r\nContent-Type: application/json\r\n\r\n{}", ""},
+		{"Content-Length: 2\n\n{}", `does not end with \r\n`},
+		{"Content-Type: application/json\r\n\r\n{}", "without a Content-Length"},
+		{"Content-Length: 1\r\n\r\n{}", "does not frame a JSON value"},
+		{"Content-Length: 5\r\n\r\n{}", "body shorter"},
+	} {
+		_, err := readFrame(bufio.NewReader(strings.NewReader(tc.frame)))
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("readFrame(%q) = %v, want %q", tc.frame, err, tc.err)
+		}
+	}
+}
+
+func TestMessagesLookup(t *testing.T) {
+	var shared, byLanguage Messages
+	if err := json.Unmarshal([]byte(`"Not Found"`), &shared); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"en":"OK","zh-CN":"成功"}`), &byLanguage); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := shared.Lookup("zh-CN"); !ok || msg != "Not Found" {
+		t.Errorf("any language lookup = %q, %v", msg, ok)
+	}
+	if msg, ok := byLanguage.Lookup("zh-CN"); !ok || msg != "成功" {
+		t.Errorf("zh-CN lookup = %q, %v", msg, ok)
+	}
+	if _, ok := byLanguage.Lookup("fr"); ok {
+		t.Error("fr lookup found a message")
+	}
+	if err := json.Unmarshal([]byte(`1`), &shared); err == nil {
+		t.Error("number msg decoded")
+	}
+}
+
+func TestRunReportsMismatches(t *testing.T) {
+	// A bare handler answers ping with msg "OK" and knows no hello
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	client, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := Run(context.Background(), client.SocketPath, fixtures)
+	results := make(map[string]*Result)
+	for _, result := range report.Results {
+		results[result.Fixture.Name] = result
+	}
+
+	if result := results["errors/not-found"]; !result.Passed() {
+		t.Errorf("errors/not-found failed: %v", result.Failures)
+	}
+	ping := results["framing/ping"]
+	if len(ping.Failures) != 1 || !strings.Contains(ping.Failures[0], `msg (en): got "OK", want " Operation successful"`) {
+		t.Errorf("framing/ping failures %q", ping.Failures)
+	}
+	hello := results["envelope/success"]
+	if len(hello.Failures) != 3 || !strings.Contains(hello.Failures[0], "code: got 404, want 200") {
+		t.Errorf("envelope/success failures %q", hello.Failures)
+	}
+	if report.Passed() || !strings.Contains(report.String(), "--- FAIL: framing/ping") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+
+	// Dial errors fail every fixture without aborting the run
+	report = Run(context.Background(), client.SocketPath+".missing", fixtures[:2])
+	if len(report.Failed()) != 2 || !strings.HasPrefix(report.Results[0].Failures[0], "dial:") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
@@ -0,0 +1,488 @@
+// Package gmsgpack encodes Go values as MessagePack following encoding/json conventions,
+// so the types handlers already return keep their field names, omitempty and Marshalers,
+// while []byte values are written as binary instead of base64 strings
+//
+// Decoding goes through JSON: ToJSON transcodes MessagePack to the JSON encoding/json would
+// have produced (binary as base64), which lets jsonrpc2 and existing params types decode it
+// unchanged. FromJSON is the reverse transcoding, used for values that only know how to
+// marshal themselves to JSON.
+package gmsgpack
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxDepth bounds the nesting of encoded and decoded values
+const maxDepth = 1000
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// Marshal returns the MessagePack encoding of v
+func Marshal(v any) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// encoder appends MessagePack to buf
+type encoder struct {
+	buf []byte
+}
+
+// encode appends v
+func (e *encoder) encode(v reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("gmsgpack: exceeded max depth of %d", maxDepth)
+	}
+	if !v.IsValid() {
+		e.writeNil()
+		return nil
+	}
+
+	// Marshalers come first, as in encoding/json, including on addressable values
+	t := v.Type()
+	if v.Kind() != reflect.Pointer && v.CanAddr() &&
+		(reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)) {
+		v = v.Addr()
+		t = v.Type()
+	}
+	if t.Implements(jsonMarshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		data, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return e.appendJSON(data, depth)
+	}
+	if t.Implements(textMarshalerType) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		e.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("gmsgpack: unsupported value: %v", f)
+		}
+		if v.Kind() == reflect.Float32 {
+			e.writeFloat32(float32(f))
+		} else {
+			e.writeFloat64(f)
+		}
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.writeBin(v.Bytes())
+			return nil
+		}
+		return e.encodeArray(v, depth)
+	case reflect.Array:
+		return e.encodeArray(v, depth)
+	case reflect.Map:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		return e.encodeMap(v, depth)
+	case reflect.Struct:
+		return e.encodeStruct(v, depth)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		return e.encode(v.Elem(), depth+1)
+	default:
+		return fmt.Errorf("gmsgpack: unsupported type: %s", t)
+	}
+	return nil
+}
+
+// encodeArray appends the elements of a slice or array
+func (e *encoder) encodeArray(v reflect.Value, depth int) error {
+	e.writeArrayHeader(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMap appends a map with its keys converted and sorted as encoding/json does
+func (e *encoder) encodeMap(v reflect.Value, depth int) error {
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := mapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key, iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	e.writeMapHeader(len(entries))
+	for _, ent := range entries {
+		e.writeString(ent.key)
+		if err := e.encode(ent.value, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKey converts a map key to the string encoding/json would use
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("gmsgpack: unsupported map key type: %s", k.Type())
+}
+
+// encodeStruct appends the fields encoding/json would marshal
+func (e *encoder) encodeStruct(v reflect.Value, depth int) error {
+	type entry struct {
+		field *field
+		value reflect.Value
+	}
+	fields := cachedFields(v.Type())
+	entries := make([]entry, 0, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		entries = append(entries, entry{f, fv})
+	}
+
+	e.writeMapHeader(len(entries))
+	for _, ent := range entries {
+		e.writeString(ent.field.name)
+		if ent.field.quoted {
+			// The ",string" option wraps the JSON of scalar values in a string
+			data, err := json.Marshal(ent.value.Interface())
+			if err != nil {
+				return err
+			}
+			e.writeString(string(data))
+			continue
+		}
+		if err := e.encode(ent.value, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field is a struct field as encoding/json sees it
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	quoted    bool
+}
+
+// fieldCache holds the fields of struct types by reflect.Type
+var fieldCache sync.Map
+
+// cachedFields returns the fields of t, computing them once
+func cachedFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return fields.([]field)
+}
+
+// typeFields lists the fields of t following the encoding/json rules: json tags name
+// fields, untagged embedded structs promote their fields, and shallower fields hide
+// deeper ones while names that collide at the same depth are dropped
+func typeFields(t reflect.Type) []field {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []field
+	hidden := make(map[string]bool)
+	visited := make(map[reflect.Type]bool)
+	for current := []embedded{{typ: t}}; len(current) > 0; {
+		var (
+			next  []embedded
+			level []field
+			count = make(map[string]int)
+		)
+		for _, ent := range current {
+			if visited[ent.typ] {
+				continue
+			}
+			visited[ent.typ] = true
+
+			for i := 0; i < ent.typ.NumField(); i++ {
+				sf := ent.typ.Field(i)
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(append([]int(nil), ent.index...), i)
+
+				ft := sf.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+					if name == "" && ft.Kind() == reflect.Struct {
+						next = append(next, embedded{ft, index})
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				if name == "" {
+					name = sf.Name
+				}
+				quoted := false
+				if hasOption(opts, "string") {
+					switch ft.Kind() {
+					case reflect.Bool, reflect.String,
+						reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+						reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+						reflect.Float32, reflect.Float64:
+						quoted = true
+					}
+				}
+				level = append(level, field{name: name, index: index, omitEmpty: hasOption(opts, "omitempty"), quoted: quoted})
+				count[name]++
+			}
+		}
+
+		for _, f := range level {
+			if !hidden[f.name] && count[f.name] == 1 {
+				fields = append(fields, f)
+			}
+		}
+		for name := range count {
+			hidden[name] = true
+		}
+		current = next
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+// hasOption reports whether a json tag option list contains option
+func hasOption(opts, option string) bool {
+	for opts != "" {
+		var name string
+		name, opts, _ = strings.Cut(opts, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex returns a possibly promoted field, false when an embedded pointer on the way is nil
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether omitempty drops v
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (e *encoder) writeNil() {
+	e.buf = append(e.buf, 0xc0)
+}
+
+func (e *encoder) writeBool(b bool) {
+	if b {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+}
+
+func (e *encoder) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.writeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xd2), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xd3), uint64(n))
+	}
+}
+
+func (e *encoder) writeUint(n uint64) {
+	switch {
+	case n <= math.MaxInt8:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xce), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcf), n)
+	}
+}
+
+func (e *encoder) writeFloat32(f float32) {
+	e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xca), math.Float32bits(f))
+}
+
+func (e *encoder) writeFloat64(f float64) {
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0xcb), math.Float64bits(f))
+}
+
+func (e *encoder) writeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xda), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdb), uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) writeBin(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xc5), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xc6), uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xdc), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdd), uint32(n))
+	}
+}
+
+func (e *encoder) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, 0xde), uint16(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0xdf), uint32(n))
+	}
+}
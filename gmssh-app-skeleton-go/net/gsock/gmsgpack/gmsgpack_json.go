@@ -0,0 +1,377 @@
+package gmsgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// extTimestamp is the MessagePack extension type of timestamps
+const extTimestamp = -1
+
+// errTruncated is returned for input ending inside a value
+var errTruncated = errors.New("gmsgpack: unexpected end of data")
+
+// FromJSON transcodes a JSON document to MessagePack
+// Integers that fit 64 bits stay integers, other numbers become floats
+func FromJSON(data []byte) ([]byte, error) {
+	e := &encoder{}
+	if err := e.appendJSON(data, 0); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// appendJSON appends the MessagePack encoding of a JSON document
+func (e *encoder) appendJSON(data []byte, depth int) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := e.appendJSONValue(decoder, depth); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("gmsgpack: invalid JSON: trailing data")
+	}
+	return nil
+}
+
+// appendJSONValue appends the next JSON value read from decoder
+func (e *encoder) appendJSONValue(decoder *json.Decoder, depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("gmsgpack: exceeded max depth of %d", maxDepth)
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("gmsgpack: invalid JSON: %w", err)
+	}
+
+	switch t := token.(type) {
+	case nil:
+		e.writeNil()
+	case bool:
+		e.writeBool(t)
+	case string:
+		e.writeString(t)
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			e.writeInt(n)
+		} else if n, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			e.writeUint(n)
+		} else if f, err := t.Float64(); err == nil {
+			e.writeFloat64(f)
+		} else {
+			return fmt.Errorf("gmsgpack: invalid JSON number %q", t)
+		}
+	case json.Delim:
+		// Headers carry the element count, so elements are encoded before it is known
+		elements := &encoder{}
+		n := 0
+		for decoder.More() {
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return fmt.Errorf("gmsgpack: invalid JSON: %w", err)
+				}
+				elements.writeString(key.(string))
+			}
+			if err := elements.appendJSONValue(decoder, depth+1); err != nil {
+				return err
+			}
+			n++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("gmsgpack: invalid JSON: %w", err)
+		}
+		if t == '{' {
+			e.writeMapHeader(n)
+		} else {
+			e.writeArrayHeader(n)
+		}
+		e.buf = append(e.buf, elements.buf...)
+	}
+	return nil
+}
+
+// ToJSON transcodes one MessagePack value to JSON
+// Binary values become base64 strings and timestamps RFC 3339 strings, which is how
+// encoding/json represents []byte and time.Time; map keys must be strings or integers
+func ToJSON(data []byte) ([]byte, error) {
+	d := &decoder{data: data}
+	if err := d.value(0); err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("gmsgpack: trailing data")
+	}
+	return d.out, nil
+}
+
+// decoder transcodes MessagePack from data to JSON in out
+type decoder struct {
+	data []byte
+	pos  int
+	out  []byte
+}
+
+// read consumes n bytes
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// length reads a big-endian length of size bytes
+func (d *decoder) length(size int) (int, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+// value transcodes the next value
+func (d *decoder) value(depth int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("gmsgpack: exceeded max depth of %d", maxDepth)
+	}
+	head, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	b := head[0]
+
+	switch {
+	case b <= 0x7f:
+		d.out = strconv.AppendInt(d.out, int64(b), 10)
+		return nil
+	case b >= 0xe0:
+		d.out = strconv.AppendInt(d.out, int64(int8(b)), 10)
+		return nil
+	case b&0xf0 == 0x80:
+		return d.object(int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return d.array(int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return d.str(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		d.out = append(d.out, "null"...)
+	case 0xc2:
+		d.out = append(d.out, "false"...)
+	case 0xc3:
+		d.out = append(d.out, "true"...)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (b - 0xc4))
+		if err != nil {
+			return err
+		}
+		raw, err := d.read(n)
+		if err != nil {
+			return err
+		}
+		d.out = append(d.out, '"')
+		d.out = base64.StdEncoding.AppendEncode(d.out, raw)
+		d.out = append(d.out, '"')
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (b - 0xc7))
+		if err != nil {
+			return err
+		}
+		return d.ext(n)
+	case 0xca:
+		raw, err := d.read(4)
+		if err != nil {
+			return err
+		}
+		return d.float(float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), 32)
+	case 0xcb:
+		raw, err := d.read(8)
+		if err != nil {
+			return err
+		}
+		return d.float(math.Float64frombits(binary.BigEndian.Uint64(raw)), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		raw, err := d.read(1 << (b - 0xcc))
+		if err != nil {
+			return err
+		}
+		var n uint64
+		for _, x := range raw {
+			n = n<<8 | uint64(x)
+		}
+		d.out = strconv.AppendUint(d.out, n, 10)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		raw, err := d.read(size)
+		if err != nil {
+			return err
+		}
+		var n uint64
+		for _, x := range raw {
+			n = n<<8 | uint64(x)
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		d.out = strconv.AppendInt(d.out, int64(n<<shift)>>shift, 10)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (b - 0xd9))
+		if err != nil {
+			return err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (b - 0xdc))
+		if err != nil {
+			return err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (b - 0xde))
+		if err != nil {
+			return err
+		}
+		return d.object(n, depth)
+	default:
+		return fmt.Errorf("gmsgpack: invalid type byte 0x%x", b)
+	}
+	return nil
+}
+
+// str transcodes a string of n bytes
+func (d *decoder) str(n int) error {
+	raw, err := d.read(n)
+	if err != nil {
+		return err
+	}
+	quoted, err := json.Marshal(string(raw))
+	if err != nil {
+		return err
+	}
+	d.out = append(d.out, quoted...)
+	return nil
+}
+
+// float transcodes a float, which JSON cannot carry when it is not finite
+func (d *decoder) float(f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("gmsgpack: unsupported value: %v", f)
+	}
+	d.out = strconv.AppendFloat(d.out, f, 'g', -1, bits)
+	return nil
+}
+
+// array transcodes n elements
+func (d *decoder) array(n, depth int) error {
+	// Every element takes at least a byte, which bounds claimed lengths by the input
+	if n > len(d.data)-d.pos {
+		return errTruncated
+	}
+	d.out = append(d.out, '[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out = append(d.out, ',')
+		}
+		if err := d.value(depth + 1); err != nil {
+			return err
+		}
+	}
+	d.out = append(d.out, ']')
+	return nil
+}
+
+// object transcodes n key-value pairs
+func (d *decoder) object(n, depth int) error {
+	if n > (len(d.data)-d.pos)/2 {
+		return errTruncated
+	}
+	d.out = append(d.out, '{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out = append(d.out, ',')
+		}
+		if err := d.key(); err != nil {
+			return err
+		}
+		d.out = append(d.out, ':')
+		if err := d.value(depth + 1); err != nil {
+			return err
+		}
+	}
+	d.out = append(d.out, '}')
+	return nil
+}
+
+// key transcodes a map key, quoting integer keys as encoding/json does
+func (d *decoder) key() error {
+	if d.pos >= len(d.data) {
+		return errTruncated
+	}
+	b := d.data[d.pos]
+	isString := b&0xe0 == 0xa0 || (b >= 0xd9 && b <= 0xdb)
+	isInt := b <= 0x7f || b >= 0xe0 || (b >= 0xcc && b <= 0xcf) || (b >= 0xd0 && b <= 0xd3)
+	switch {
+	case isString:
+		return d.value(0)
+	case isInt:
+		d.out = append(d.out, '"')
+		if err := d.value(0); err != nil {
+			return err
+		}
+		d.out = append(d.out, '"')
+		return nil
+	}
+	return fmt.Errorf("gmsgpack: unsupported map key type byte 0x%x", b)
+}
+
+// ext transcodes an extension value with n bytes of data; only timestamps are supported
+func (d *decoder) ext(n int) error {
+	typ, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	raw, err := d.read(n)
+	if err != nil {
+		return err
+	}
+	if int8(typ[0]) != extTimestamp {
+		return fmt.Errorf("gmsgpack: unsupported extension type %d", int8(typ[0]))
+	}
+
+	var sec, nsec int64
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(raw))
+	case 8:
+		v := binary.BigEndian.Uint64(raw)
+		nsec, sec = int64(v>>34), int64(v&(1<<34-1))
+	case 12:
+		nsec, sec = int64(binary.BigEndian.Uint32(raw)), int64(binary.BigEndian.Uint64(raw[4:]))
+	default:
+		return fmt.Errorf("gmsgpack: invalid timestamp of %d bytes", n)
+	}
+	d.out = append(d.out, '"')
+	d.out = time.Unix(sec, nsec).UTC().AppendFormat(d.out, time.RFC3339Nano)
+	d.out = append(d.out, '"')
+	return nil
+}
@@ -0,0 +1,267 @@
+package gmsgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type meta struct {
+	Endpoint string `json:"endpoint"`
+	Close    int    `json:"close,omitempty"`
+}
+
+type Embedded struct {
+	Shared string `json:"shared"`
+}
+
+type envelope struct {
+	Embedded
+	Code    int             `json:"code"`
+	Data    any             `json:"data"`
+	Message string          `json:"msg"`
+	Meta    *meta           `json:"meta,omitempty"`
+	Count   int64           `json:"count,string"`
+	Raw     json.RawMessage `json:"raw"`
+	When    time.Time       `json:"when"`
+	Skipped string          `json:"-"`
+	hidden  string
+}
+
+// assertJSON checks that Marshal followed by ToJSON matches encoding/json
+func assertJSON(t *testing.T, v any) {
+	t.Helper()
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(v)
+
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	_ = json.Unmarshal(want, &wantValue)
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Fatalf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestMarshalFollowsJSON(t *testing.T) {
+	assertJSON(t, &envelope{
+		Embedded: Embedded{Shared: "promoted"},
+		Code:     200,
+		Data:     map[string]any{"chunk": []byte{0, 1, 2, 255}, "offset": uint64(math.MaxUint64), "ratio": 0.25},
+		Message:  "ok",
+		Count:    -42,
+		Raw:      json.RawMessage(`{"nested":[1,"two",null,true]}`),
+		When:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Skipped:  "skipped",
+		hidden:   "hidden",
+	})
+	assertJSON(t, map[int]string{3: "c", 1: "a"})
+	assertJSON(t, []any{nil, false, int8(-100), int16(-30000), int32(-2e9), int64(math.MinInt64), float32(1.5), strings.Repeat("x", 70000)})
+	assertJSON(t, [3]int{1, 2, 3})
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	chunk := bytes.Repeat([]byte{0xff}, 1000)
+	data, err := Marshal(map[string]any{"data": chunk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > len(chunk)+16 {
+		t.Fatalf("%d bytes for a %d byte chunk", len(data), len(chunk))
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	doc := `{"id":18446744073709551615,"neg":-5,"f":1.5e300,"list":[1,{"a":"b"}],"empty":{},"s":"é"}`
+	data, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want any
+	_ = json.Unmarshal(back, &got)
+	_ = json.Unmarshal([]byte(doc), &want)
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Fatalf("got %s, want %s", gotJSON, wantJSON)
+	}
+
+	if _, err := FromJSON([]byte(`{"a":1} {}`)); err == nil {
+		t.Fatal("trailing data accepted")
+	}
+}
+
+func TestToJSONRejectsMalformed(t *testing.T) {
+	cases := map[string][]byte{
+		"truncated string": {0xa5, 'a'},
+		"huge array":       {0xdd, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"huge bin":         {0xc6, 0xff, 0xff, 0xff, 0xff},
+		"unused byte":      {0xc1},
+		"binary map key":   {0x81, 0xc4, 0x00, 0x01},
+		"unknown ext":      {0xd4, 0x05, 0x00},
+		"trailing data":    {0x01, 0x02},
+		"empty":            {},
+	}
+	for name, data := range cases {
+		if _, err := ToJSON(data); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	deep := append(bytes.Repeat([]byte{0x91}, maxDepth+2), 0xc0)
+	if _, err := ToJSON(deep); err == nil {
+		t.Error("excessive nesting accepted")
+	}
+}
+
+func TestTimestampExtension(t *testing.T) {
+	// timestamp 32: 2024-05-01T12:00:00Z
+	got, err := ToJSON([]byte{0xd6, 0xff, 0x66, 0x32, 0x2e, 0xc0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `"2024-05-01T12:00:00Z"` {
+		t.Fatalf("unexpected timestamp %s", got)
+	}
+}
+
+func TestLengthHeaders(t *testing.T) {
+	cases := map[string][]byte{
+		"fixstr":          {0xbf, 'a'},
+		"str8":            {0xd9, 0x05, 'a'},
+		"str16":           {0xda, 0x00, 0x02, 'a'},
+		"str32":           {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"str32 header":    {0xdb, 0x00, 0x00},
+		"bin8":            {0xc4, 0x02, 0x00},
+		"bin16 header":    {0xc5, 0x00},
+		"bin32":           {0xc6, 0x7f, 0xff, 0xff, 0xff, 0x00},
+		"fixarray":        {0x9f, 0x01},
+		"array16":         {0xdc, 0xff, 0xff, 0x01},
+		"array32":         {0xdd, 0x7f, 0xff, 0xff, 0xff},
+		"array32 header":  {0xdd, 0x00, 0x00, 0x00},
+		"fixmap":          {0x8f, 0xa1, 'a', 0x01},
+		"map16":           {0xde, 0x00, 0x02, 0xa1, 'a', 0x01},
+		"map32":           {0xdf, 0xff, 0xff, 0xff, 0xff},
+		"ext8":            {0xc7, 0xff, 0xff, 0x00},
+		"ext32 header":    {0xc9, 0x00, 0x00, 0x00},
+		"timestamp":       {0xd6, 0xff, 0x66},
+		"uint64":          {0xcf, 0x00, 0x00},
+		"float64":         {0xcb, 0x3f, 0xf0},
+		"nested overflow": {0x91, 0x92, 0x01},
+	}
+	for name, data := range cases {
+		if _, err := ToJSON(data); !errors.Is(err, errTruncated) {
+			t.Errorf("%s: got %v, want %v", name, err, errTruncated)
+		}
+	}
+
+	// Lengths that fit the input are accepted at every header width
+	valid := map[string][]byte{
+		"str8":    {0xd9, 0x01, 'a'},
+		"str16":   {0xda, 0x00, 0x01, 'a'},
+		"str32":   {0xdb, 0x00, 0x00, 0x00, 0x01, 'a'},
+		"bin32":   {0xc6, 0x00, 0x00, 0x00, 0x01, 'a'},
+		"array16": {0xdc, 0x00, 0x01, 0x01},
+		"map32":   {0xdf, 0x00, 0x00, 0x00, 0x01, 0xa1, 'a', 0x01},
+	}
+	for name, data := range valid {
+		if _, err := ToJSON(data); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// sameJSON reports whether two JSON documents hold the same value
+func sameJSON(a, b []byte) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func FuzzToJSON(f *testing.F) {
+	for _, v := range []any{
+		map[string]any{"code": 200, "data": []byte{0, 1, 255}, "msg": "ok", "meta": map[string]any{"endpoint": "ping"}},
+		[]any{nil, true, -1, int64(math.MinInt64), uint64(math.MaxUint64), 1.5, float32(0.25), "é"},
+		map[int]string{1: "a"},
+		time.Date(2024, 5, 1, 12, 0, 0, 5, time.UTC),
+	} {
+		data, err := Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{0xdd, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Add([]byte{0xd7, 0xff, 0, 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := ToJSON(data)
+		if err != nil {
+			return
+		}
+		if !json.Valid(out) {
+			t.Fatalf("invalid JSON %q from %x", out, data)
+		}
+		// Whatever ToJSON produces transcodes back to the same value
+		packed, err := FromJSON(out)
+		if err != nil {
+			t.Fatalf("FromJSON(%s): %v", out, err)
+		}
+		back, err := ToJSON(packed)
+		if err != nil {
+			t.Fatalf("ToJSON after FromJSON(%s): %v", out, err)
+		}
+		if !sameJSON(out, back) {
+			t.Fatalf("round trip changed %s to %s", out, back)
+		}
+	})
+}
+
+func FuzzFromJSON(f *testing.F) {
+	for _, doc := range []string{
+		`{"id":18446744073709551615,"neg":-5,"f":1.5e300,"list":[1,{"a":"b"}],"empty":{},"s":"é"}`,
+		`[null,true,false,0,-0,1e-7,"\u003c\ud83d\ude00"]`,
+		`"x"`,
+		`{"a":1,"a":2}`,
+	} {
+		f.Add([]byte(doc))
+	}
+
+	f.Fuzz(func(t *testing.T, doc []byte) {
+		packed, err := FromJSON(doc)
+		if err != nil {
+			return
+		}
+		if !json.Valid(doc) {
+			t.Fatalf("FromJSON accepted invalid JSON %q", doc)
+		}
+		out, err := ToJSON(packed)
+		if err != nil {
+			t.Fatalf("ToJSON(FromJSON(%s)): %v", doc, err)
+		}
+		if !sameJSON(doc, out) {
+			t.Fatalf("round trip changed %s to %s", doc, out)
+		}
+	})
+}
@@ -18,6 +18,18 @@ type RPCMiddleware interface {
 	ProcessResponse(resp any) (any, error)
 }
 
+// HandlerFunc is the signature shared by all registered RPC handlers
+type HandlerFunc func(req *Request) (any, error)
+
+// RPCHandlerWrapper is an optional extension for route middlewares
+// A middleware passed to RegisterHandle that also implements this interface
+// wraps the handler itself, so it sees the request together with the handler result
+// and may answer without calling the handler at all
+type RPCHandlerWrapper interface {
+	// WrapHandler returns a handler that decorates next for the given api
+	WrapHandler(api string, next HandlerFunc) HandlerFunc
+}
+
 // IRpcHandler provides method registration capabilities for RPC services
 type IRpcHandler interface {
 	// RegisterHandle binds a handler function to an API endpoint
@@ -51,6 +63,52 @@ type IRpcService interface {
 	Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error)
 }
 
+// ISessionHooks is implemented by services that track connections as sessions
+type ISessionHooks interface {
+	// OnConnect adds a hook run for every new connection, before its first request is handled
+	OnConnect(hook SessionHook)
+
+	// OnDisconnect adds a hook run once a connection is closed, by either side
+	OnDisconnect(hook SessionHook)
+}
+
+// IDeprecatedCalls is implemented by handlers and services that count calls of deprecated methods
+type IDeprecatedCalls interface {
+	// DeprecatedCalls returns the call counters of the deprecated methods, sorted by method
+	DeprecatedCalls() []DeprecatedCall
+}
+
+// IMaintenance is implemented by handlers and services that can turn methods off at runtime
+type IMaintenance interface {
+	// Maintenance returns the maintenance switch, nil if there is none
+	Maintenance() *Maintenance
+}
+
+// IUnwrapHandle is implemented by handlers wrapping another one, e.g. recorders or method filters
+// The optional handler interfaces (IMaintenance, IDeprecatedCalls) are looked up through
+// the whole chain with LookupHandle, so wrappers don't have to forward them
+type IUnwrapHandle interface {
+	// Unwrap returns the wrapped handler
+	Unwrap() IRpcServiceHandle
+}
+
+// LookupHandle returns the first handler implementing T, starting at handler and following
+// IUnwrapHandle down the chain of wrapped handlers
+func LookupHandle[T any](handler IRpcServiceHandle) (T, bool) {
+	for handler != nil {
+		if t, ok := handler.(T); ok {
+			return t, true
+		}
+		wrapper, ok := handler.(IUnwrapHandle)
+		if !ok {
+			break
+		}
+		handler = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
 // IRpcServiceHandle provides a simplified handler-only interface
 type IRpcServiceHandle interface {
 	IRpcHandler
@@ -0,0 +1,55 @@
+package gsock
+
+import (
+	"os"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+// errUnauthorized is returned to peers an authorizer from PeerUID denies
+var errUnauthorized = gerror.WithMessage(gerror.CodeNotAuthorized, "method not allowed for this peer")
+
+// Authorizer decides whether a request may call a privileged method, such as the debug
+// and admin methods
+// It returns nil to allow the call, or the error sent back to the caller
+type Authorizer func(req *Request) error
+
+// PeerUID allows peers whose process runs as one of uids
+// The peer is identified through the credentials of its Unix socket connection,
+// so requests not received over a Unix socket are denied
+func PeerUID(uids ...uint32) Authorizer {
+	return func(req *Request) error {
+		session := req.Session()
+		if session == nil {
+			return errUnauthorized
+		}
+		cred, err := session.PeerCred()
+		if err != nil {
+			return errUnauthorized
+		}
+		for _, uid := range uids {
+			if cred.UID == uid {
+				return nil
+			}
+		}
+		return errUnauthorized
+	}
+}
+
+// AppPeers allows peers running as the app's own user or as root
+// It is the default Authorizer of privileged methods
+func AppPeers() Authorizer {
+	return PeerUID(uint32(os.Getuid()), 0)
+}
+
+// Guard runs authorize before next; a nil authorize allows every call
+func Guard(authorize Authorizer, next HandlerFunc) HandlerFunc {
+	return func(req *Request) (any, error) {
+		if authorize != nil {
+			if err := authorize(req); err != nil {
+				return nil, err
+			}
+		}
+		return next(req)
+	}
+}
@@ -0,0 +1,92 @@
+package gsock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// CallOptFunc defines functions for configuring a typed call
+type CallOptFunc func(*callOptions)
+
+// callOptions holds the settings of a typed call
+type callOptions struct {
+	meta    *Meta                 // Receives the response metadata
+	rpcOpts []jsonrpc2.CallOption // Passed through to the client
+}
+
+// WithCallMetaOption stores the response metadata in meta, on success and on error responses
+func WithCallMetaOption(meta *Meta) CallOptFunc {
+	return func(o *callOptions) {
+		o.meta = meta
+	}
+}
+
+// WithCallRPCOption passes raw JSON-RPC call options to the client
+func WithCallRPCOption(opts ...jsonrpc2.CallOption) CallOptFunc {
+	return func(o *callOptions) {
+		o.rpcOpts = append(o.rpcOpts, opts...)
+	}
+}
+
+// rawResponse is a Response whose data is decoded later, into the caller's type
+type rawResponse struct {
+	Code    int             `json:"code"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"msg"`
+	Meta    *Meta           `json:"meta"`
+}
+
+// Call invokes method and decodes the data of the response envelope into T
+// Transport and decoding failures are returned as is; a non-success response is returned
+// as a gerror.Exception carrying its code, message and data as detail
+//
+// Example:
+//
+//	files, err := gsock.Call[[]string](ctx, client, "file.list", map[string]any{"path": "/"})
+//	var exception gerror.Exception
+//	if errors.As(err, &exception) && exception.Code() == gerror.CodeNotFound.Code() {
+//	    ...
+//	}
+func Call[T any](ctx context.Context, client IRpcClient, method string, params any, opts ...CallOptFunc) (T, error) {
+	var (
+		options callOptions
+		result  T
+		resp    rawResponse
+	)
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err := client.Request(ctx, method, params, &resp, options.rpcOpts...); err != nil {
+		return result, err
+	}
+	if options.meta != nil && resp.Meta != nil {
+		*options.meta = *resp.Meta
+	}
+
+	if resp.Code != http.StatusOK {
+		failed := &Response{Code: resp.Code, Message: resp.Message, Meta: resp.Meta}
+		if hasData(resp.Data) {
+			// The detail is informational; undecodable data is dropped
+			_ = json.Unmarshal(resp.Data, &failed.Data)
+		}
+		return result, failed.Exception()
+	}
+
+	if hasData(resp.Data) {
+		if err := json.Unmarshal(resp.Data, &result); err != nil {
+			return result, fmt.Errorf("decode %s result: %w", method, err)
+		}
+	}
+	return result, nil
+}
+
+// hasData reports whether raw holds a value other than null
+func hasData(raw json.RawMessage) bool {
+	return len(raw) > 0 && !bytes.Equal(raw, []byte("null"))
+}
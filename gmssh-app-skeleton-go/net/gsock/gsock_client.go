@@ -2,11 +2,85 @@ package gsock
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+// RpcClientOptFunc defines functions for configuring an RPC client
+type RpcClientOptFunc func(*rpcClient)
+
+// WithRpcClientAdapterOption sets the protocol adapter, e.g. a JsonRpcSimpleClient with compression
+func WithRpcClientAdapterOption(adapter ClientAdapter) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.adapter = adapter
+	}
+}
+
+// WithRpcClientPoolSizeOption caps the number of persistent connections of a keep-alive client
+func WithRpcClientPoolSizeOption(size int) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.poolSize = size
+	}
+}
+
+// WithRpcClientPoolStreamsOption sets how many calls may share a connection before another is dialed
+func WithRpcClientPoolStreamsOption(streams int) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.poolStreams = streams
+	}
+}
+
+// WithRpcClientIdleTimeoutOption sets how long an unused pooled connection stays open (0 = forever)
+func WithRpcClientIdleTimeoutOption(timeout time.Duration) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.idleTimeout = timeout
+	}
+}
+
+// WithRpcClientHealthCheckOption sets how often idle pooled connections are health checked (0 = never)
+func WithRpcClientHealthCheckOption(interval time.Duration) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.healthInterval = interval
+	}
+}
+
+// WithRpcClientHealthMethodOption sets the method health checks call, e.g. a cheap "ping"
+func WithRpcClientHealthMethodOption(method string) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.healthMethod = method
+	}
+}
+
+// WithRpcClientRetryOption retries failed requests to the given methods under policy
+// Without methods the policy applies to every method lacking a policy of its own
+func WithRpcClientRetryOption(policy *RetryPolicy, methods ...string) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		if len(methods) == 0 {
+			c.retry = policy
+			return
+		}
+		if c.retries == nil {
+			c.retries = make(map[string]*RetryPolicy, len(methods))
+		}
+		for _, method := range methods {
+			c.retries[method] = policy
+		}
+	}
+}
+
+// WithRpcClientBreakerOption guards requests with the group's circuit breaker for the client's socket
+// Clients sharing a group share the state of each socket
+func WithRpcClientBreakerOption(group *BreakerGroup) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.breakers = group
+	}
+}
+
 // RPCClient provides JSON-RPC 2.0 client functionality over Unix domain sockets.
 // It manages connection lifecycle and request/response handling through a configurable adapter.
 //
@@ -14,19 +88,55 @@ import (
 //   - sockPath:  Filesystem path to the Unix domain socket (e.g., "/tmp/rpc.sock")
 //   - adapter:   Protocol adapter implementing the ClientAdapter interface (defaults to JSON-RPC)
 //   - idCounter: Atomic counter for generating unique request IDs
-//   - keepLive:  Flag controlling whether connections should be kept alive after requests
+//   - keepLive:  Flag controlling whether requests share pooled persistent connections
 type rpcClient struct {
-	sockPath  string        // Path to the Unix domain socket
-	adapter   ClientAdapter // Protocol adapter (defaults to JSON-RPC)
-	idCounter int64         // Atomic counter for generating request IDs
-	keepLive  bool          // Connection persistence flag
+	sockPath       string                  // Path to the Unix domain socket
+	adapter        ClientAdapter           // Protocol adapter (defaults to JSON-RPC)
+	idCounter      uint64                  // Atomic counter for generating request IDs
+	keepLive       bool                    // Connection persistence flag
+	poolSize       int                     // Maximum pooled connections
+	poolStreams    int                     // Calls per connection before dialing another
+	idleTimeout    time.Duration           // Idle pooled connection lifetime
+	healthInterval time.Duration           // Pooled connection health check interval
+	healthMethod   string                  // Method called by health checks
+	poolOnce       sync.Once               // Creates pool on first use
+	pool           *connPool               // Persistent connections (keep-alive clients only)
+	retry          *RetryPolicy            // Retry policy of methods without their own
+	retries        map[string]*RetryPolicy // Per-method retry policies
+	breakers       *BreakerGroup           // Per-socket circuit breakers (nil = none)
+	interceptors   []ClientInterceptor     // Wrap every request, in order
 }
 
-// NewRpcKeepLivClient creates a new RPC client with connection persistence disabled.
-// Connections will remain open after requests (caller must manage cleanup).
+// newRpcClient applies options over the defaults
+func newRpcClient(socketPath string, keepLive bool, opts []RpcClientOptFunc) *rpcClient {
+	client := &rpcClient{
+		sockPath:       socketPath,
+		adapter:        NewJsonRpcSimpleClient(),
+		keepLive:       keepLive,
+		poolSize:       DefaultPoolSize,
+		poolStreams:    DefaultPoolStreams,
+		idleTimeout:    DefaultPoolIdleTimeout,
+		healthInterval: DefaultPoolHealthInterval,
+		healthMethod:   DefaultPoolHealthMethod,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.poolSize <= 0 {
+		client.poolSize = DefaultPoolSize
+	}
+	if client.poolStreams <= 0 {
+		client.poolStreams = DefaultPoolStreams
+	}
+	return client
+}
+
+// NewRpcSimpleClient creates a new RPC client without connection persistence.
+// Each request dials its own connection and closes it once the response arrived.
 //
 // Parameters:
 //   - socketPath: Absolute filesystem path to the Unix domain socket
+//   - opts:       Optional client configuration
 //
 // Returns:
 //   - *rpcClient: Initialized client instance ready for RPC calls
@@ -34,37 +144,41 @@ type rpcClient struct {
 // Note:
 //
 //	Uses JsonRpcSimpleClient as the default adapter
-func NewRpcSimpleClient(socketPath string) *rpcClient {
-	return &rpcClient{
-		sockPath:  socketPath,
-		adapter:   &JsonRpcSimpleClient{},
-		idCounter: 0,
-	}
+func NewRpcSimpleClient(socketPath string, opts ...RpcClientOptFunc) *rpcClient {
+	return newRpcClient(socketPath, false, opts)
 }
 
-// NewRpcSimpleClient creates a new RPC client with connection persistence enabled.
-// The client will automatically close connections after each request.
+// NewRpcKeepLiveClient creates a new RPC client with connection persistence enabled.
+// Requests are multiplexed over a pool of persistent connections: idle connections are
+// health checked and evicted, the pool size is capped, and Close releases everything.
 //
 // Parameters:
 //   - socketPath: Absolute filesystem path to the Unix domain socket
+//   - opts:       Optional client and pool configuration
 //
 // Returns:
-//   - *rpcClient: Initialized client instance with keepalive disabled
+//   - *rpcClient: Initialized client instance; call Close when done
 //
 // Note:
 //
 //	Uses JsonRpcSimpleClient as the default adapter
-func NewRpcKeepLiveClient(socketPath string) *rpcClient {
-	return &rpcClient{
-		sockPath:  socketPath,
-		adapter:   &JsonRpcSimpleClient{},
-		idCounter: 0,
-		keepLive:  true,
+func NewRpcKeepLiveClient(socketPath string, opts ...RpcClientOptFunc) *rpcClient {
+	return newRpcClient(socketPath, true, opts)
+}
+
+// RegisterHandle binds a handler for calls and notifications the server sends back
+// on this client's connections (e.g. progress pushes or confirmation prompts).
+// It is a no-op if the adapter does not support server-initiated calls.
+func (c *rpcClient) RegisterHandle(api string, hand func(req *Request) (any, error), middlewares ...RPCMiddleware) {
+	if handler, ok := c.adapter.(IRpcHandler); ok {
+		handler.RegisterHandle(api, hand, middlewares...)
 	}
 }
 
 // Request executes a JSON-RPC 2.0 method call and handles response decoding.
 // Automatically manages connection establishment, request ID generation, and error handling.
+// Failed requests are retried under the method's RetryPolicy, and requests fail fast while
+// the socket's circuit breaker is open. Client interceptors wrap the whole exchange.
 //
 // Parameters:
 //   - ctx:       Context for cancellation and timeout control
@@ -78,6 +192,7 @@ func NewRpcKeepLiveClient(socketPath string) *rpcClient {
 //   - Connection errors
 //   - Protocol errors
 //   - Deserialization errors
+//   - ErrCircuitOpen while the socket is considered down
 //
 // Example:
 //
@@ -89,19 +204,114 @@ func NewRpcKeepLiveClient(socketPath string) *rpcClient {
 //	    &response,
 //	)
 func (c *rpcClient) Request(ctx context.Context, method string, params, result any, opts ...jsonrpc2.CallOption) error {
-	conn, err := net.Dial("unix", c.sockPath)
+	if len(c.interceptors) == 0 {
+		return c.send(ctx, method, params, result, opts)
+	}
+
+	call := &ClientCall{Method: method, Params: params, Result: result, Opts: opts}
+	return chainInterceptors(c.interceptors, func(ctx context.Context, call *ClientCall) error {
+		opts := call.Opts
+		if len(call.Meta) > 0 {
+			opts = append(opts[:len(opts):len(opts)], jsonrpc2.Meta(call.Meta))
+		}
+		return c.send(ctx, call.Method, call.Params, call.Result, opts)
+	})(ctx, call)
+}
+
+// send makes a request, retrying it under the method's policy
+func (c *rpcClient) send(ctx context.Context, method string, params, result any, opts []jsonrpc2.CallOption) error {
+	policy := c.retryPolicy(method)
+	var breaker *CircuitBreaker
+	if c.breakers != nil {
+		breaker = c.breakers.Get(c.sockPath)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.attempt(ctx, breaker, method, params, result, opts)
+		if policy == nil || attempt >= policy.MaxAttempts || !policy.retryable(responseError(err, result)) {
+			return err
+		}
+		if !sleepContext(ctx, policy.backoff(attempt)) {
+			// Out of time: report the last failure rather than the deadline
+			return err
+		}
+	}
+}
+
+// attempt sends a request once, through the circuit breaker if there is one
+func (c *rpcClient) attempt(ctx context.Context, breaker *CircuitBreaker, method string, params, result any, opts []jsonrpc2.CallOption) error {
+	if breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return fmt.Errorf("%w: %s", err, c.sockPath)
+		}
+	}
+
+	err := c.call(ctx, method, params, result, opts)
+	if breaker != nil {
+		failure := responseError(err, result)
+		breaker.Record(failure != nil && (isTransportError(failure) || isBusy(failure)))
+	}
+	return err
+}
+
+// call sends a request once over a pooled or a dedicated connection
+func (c *rpcClient) call(ctx context.Context, method string, params, result any, opts []jsonrpc2.CallOption) error {
+	// Generate monotonic request ID, unique across pooled connections
+	idOpt := jsonrpc2.PickID(jsonrpc2.ID{Num: atomic.AddUint64(&c.idCounter, 1)})
+	opts = append(opts[:len(opts):len(opts)], idOpt)
+
+	if c.keepLive {
+		pool := c.connPool()
+		pc, err := pool.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		err = pc.client.Request(ctx, method, params, result, opts...)
+		pool.release(pc, err)
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.sockPath)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
+
+	client := c.adapter.NewConn(ctx, conn)
+	return client.Request(ctx, method, params, result, opts...)
+}
+
+// retryPolicy returns the policy for a method, nil if it is not retried
+func (c *rpcClient) retryPolicy(method string) *RetryPolicy {
+	if policy, ok := c.retries[method]; ok {
+		return policy
+	}
+	return c.retry
+}
+
+// Close closes every pooled connection and stops health checks
+// Requests made after Close fail with ErrClientClosed. Clients without keep-alive hold
+// no connections between requests, so Close does nothing for them
+func (c *rpcClient) Close() error {
 	if !c.keepLive {
-		defer conn.Close()
+		return nil
 	}
+	return c.connPool().close()
+}
 
-	// Generate monotonic request ID
-	c.idCounter++
-	idOpt := jsonrpc2.PickID(jsonrpc2.ID{Num: uint64(c.idCounter)})
-	opts = append(opts, idOpt)
+// Conns returns the number of open pooled connections
+func (c *rpcClient) Conns() int {
+	if !c.keepLive {
+		return 0
+	}
+	return c.connPool().len()
+}
 
-	client := c.adapter.NewConn(ctx, conn)
-	return client.Request(ctx, method, params, result, opts...)
+// connPool returns the connection pool, creating it on first use
+func (c *rpcClient) connPool() *connPool {
+	c.poolOnce.Do(func() {
+		c.pool = newConnPool(c)
+	})
+	return c.pool
 }
@@ -0,0 +1,81 @@
+package gsock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// ClientCall is an outgoing request as seen by client interceptors
+// Interceptors may rewrite the params, add meta or fill the result themselves
+type ClientCall struct {
+	Method string                // RPC method name
+	Params any                   // Input parameters
+	Result any                   // Pointer the response is decoded into
+	Meta   map[string]any        // Sent as the JSON-RPC "meta" member when not empty
+	Opts   []jsonrpc2.CallOption // Raw call options
+}
+
+// SetMeta sets one meta value, creating the map on first use
+func (c *ClientCall) SetMeta(key string, value any) {
+	if c.Meta == nil {
+		c.Meta = make(map[string]any)
+	}
+	c.Meta[key] = value
+}
+
+// SetResult stores v into the call's result as if it had been received, for interceptors
+// that answer without sending the request
+func (c *ClientCall) SetResult(v any) error {
+	if c.Result == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c.Result); err != nil {
+		return fmt.Errorf("decode %s result: %w", c.Method, err)
+	}
+	return nil
+}
+
+// ClientInvoker sends a call, or hands it to the next interceptor
+type ClientInvoker func(ctx context.Context, call *ClientCall) error
+
+// ClientInterceptor is the client-side counterpart of a route middleware
+// It sees every call made through the client and decides whether, and how, next is invoked
+type ClientInterceptor func(ctx context.Context, call *ClientCall, next ClientInvoker) error
+
+// WithRpcClientInterceptorOption appends interceptors to the client's chain
+// Interceptors run in registration order, each wrapping the ones registered after it;
+// retries and circuit breaking happen inside the chain, so interceptors see one call per Request
+func WithRpcClientInterceptorOption(interceptors ...ClientInterceptor) RpcClientOptFunc {
+	return func(c *rpcClient) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// MetaInterceptor sets a meta value on every call, e.g. an auth token or a trace ID taken from ctx
+// Calls whose value is nil are sent unchanged
+func MetaInterceptor(key string, value func(ctx context.Context) any) ClientInterceptor {
+	return func(ctx context.Context, call *ClientCall, next ClientInvoker) error {
+		if v := value(ctx); v != nil {
+			call.SetMeta(key, v)
+		}
+		return next(ctx, call)
+	}
+}
+
+// chainInterceptors wraps invoker so that interceptors run in order around it
+func chainInterceptors(interceptors []ClientInterceptor, invoker ClientInvoker) ClientInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, call *ClientCall) error {
+			return interceptor(ctx, call, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,347 @@
+package gsock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	// DefaultPoolSize is the maximum number of connections a keep-alive client opens
+	DefaultPoolSize = 4
+
+	// DefaultPoolStreams is the number of in-flight calls on a connection before another one is dialed
+	DefaultPoolStreams = 16
+
+	// DefaultPoolIdleTimeout is how long an unused connection is kept open
+	DefaultPoolIdleTimeout = 90 * time.Second
+
+	// DefaultPoolHealthInterval is how often idle connections are health checked
+	DefaultPoolHealthInterval = 30 * time.Second
+
+	// DefaultPoolHealthMethod is called by health checks; any reply, even "not found", proves the connection works
+	// rpc.methods is answered by every JsonRpcSimpleServiceHandler, with 404 unless the listing is on
+	DefaultPoolHealthMethod = MethodMethods
+)
+
+// ErrClientClosed is returned by requests on a client after Close
+var ErrClientClosed = errors.New("gsock: client closed")
+
+// poolConn is a pooled connection shared by concurrent calls
+type poolConn struct {
+	client   IRpcClient      // Protocol client on top of conn
+	conn     net.Conn        // Underlying socket
+	done     <-chan struct{} // Closed when the protocol client disconnects (nil if unknown)
+	inflight int32           // Calls currently using the connection
+	lastUsed time.Time       // Last time a call finished; protected by the pool lock
+	broken   int32           // Set once a transport error was seen
+}
+
+// alive reports whether the connection can still carry calls
+func (pc *poolConn) alive() bool {
+	if atomic.LoadInt32(&pc.broken) == 1 {
+		return false
+	}
+	if pc.done == nil {
+		return true
+	}
+	select {
+	case <-pc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// close closes the protocol client, or the socket if the client cannot be closed
+func (pc *poolConn) close() {
+	if closer, ok := pc.client.(io.Closer); ok {
+		closer.Close()
+	}
+	pc.conn.Close()
+}
+
+// connPool keeps persistent connections to one socket and spreads calls over them
+type connPool struct {
+	mu       sync.Mutex
+	conns    []*poolConn   // Open connections
+	dialing  int           // Connections being dialed
+	changed  chan struct{} // Closed and replaced whenever a dial finishes
+	closed   bool          // Set by close
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopped  chan struct{} // Closed when the janitor exits
+	sockPath string        // Socket to dial
+	adapter  ClientAdapter // Protocol adapter
+	size     int           // Maximum number of connections
+	streams  int           // In-flight calls per connection before dialing another
+	idle     time.Duration // Idle timeout
+	health   time.Duration // Health check interval
+	method   string        // Health check method
+}
+
+// newConnPool creates a pool and starts its janitor
+func newConnPool(c *rpcClient) *connPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &connPool{
+		ctx:      ctx,
+		cancel:   cancel,
+		stopped:  make(chan struct{}),
+		changed:  make(chan struct{}),
+		sockPath: c.sockPath,
+		adapter:  c.adapter,
+		size:     c.poolSize,
+		streams:  c.poolStreams,
+		idle:     c.idleTimeout,
+		health:   c.healthInterval,
+		method:   c.healthMethod,
+	}
+	go p.janitor()
+	return p
+}
+
+// acquire returns a connection for one call; release must be called when the call ends
+// The least loaded connection is reused unless every connection is busy and the pool has room.
+// When all slots are still being dialed the call waits for one of them
+func (p *connPool) acquire(ctx context.Context) (*poolConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrClientClosed
+		}
+
+		best := p.leastLoaded()
+		full := len(p.conns)+p.dialing >= p.size
+		if best != nil && (full || int(atomic.LoadInt32(&best.inflight)) < p.streams) {
+			atomic.AddInt32(&best.inflight, 1)
+			p.mu.Unlock()
+			return best, nil
+		}
+		if !full {
+			p.dialing++
+			p.mu.Unlock()
+			return p.add(ctx)
+		}
+
+		changed := p.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// leastLoaded drops dead connections and returns the one with the fewest calls in flight
+// The caller must hold the lock
+func (p *connPool) leastLoaded() *poolConn {
+	var best *poolConn
+	live := p.conns[:0]
+	for _, pc := range p.conns {
+		if !pc.alive() {
+			go pc.close()
+			continue
+		}
+		live = append(live, pc)
+		if best == nil || atomic.LoadInt32(&pc.inflight) < atomic.LoadInt32(&best.inflight) {
+			best = pc
+		}
+	}
+	p.conns = live
+	return best
+}
+
+// add dials a connection for a reserved slot and hands it to the caller
+func (p *connPool) add(ctx context.Context) (*poolConn, error) {
+	pc, err := p.dial(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dialing--
+	close(p.changed)
+	p.changed = make(chan struct{})
+	if err != nil {
+		return nil, err
+	}
+	if p.closed {
+		go pc.close()
+		return nil, ErrClientClosed
+	}
+	pc.inflight = 1
+	p.conns = append(p.conns, pc)
+	return pc, nil
+}
+
+// release returns a connection after a call; failed connections are dropped
+func (p *connPool) release(pc *poolConn, err error) {
+	if err != nil && isTransportError(err) {
+		atomic.StoreInt32(&pc.broken, 1)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.lastUsed = time.Now()
+	if atomic.AddInt32(&pc.inflight, -1) == 0 && !pc.alive() {
+		p.remove(pc)
+	}
+}
+
+// dial opens a new pooled connection
+func (p *connPool) dial(ctx context.Context) (*poolConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", p.sockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &poolConn{
+		client:   p.adapter.NewConn(p.ctx, conn),
+		conn:     conn,
+		lastUsed: time.Now(),
+	}
+	if notifier, ok := pc.client.(interface{ DisconnectNotify() <-chan struct{} }); ok {
+		pc.done = notifier.DisconnectNotify()
+	}
+	return pc, nil
+}
+
+// remove drops and closes a connection; the caller must hold the lock
+func (p *connPool) remove(pc *poolConn) {
+	for i, candidate := range p.conns {
+		if candidate == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			break
+		}
+	}
+	go pc.close()
+}
+
+// janitor evicts idle connections and health checks the rest until the pool is closed
+func (p *connPool) janitor() {
+	defer close(p.stopped)
+
+	interval := p.health
+	if p.idle > 0 && (interval <= 0 || p.idle/2 < interval) {
+		interval = p.idle / 2
+	}
+	if interval <= 0 {
+		<-p.ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.evictIdle()
+		if p.health > 0 && time.Since(lastCheck) >= p.health {
+			lastCheck = time.Now()
+			p.checkHealth()
+		}
+	}
+}
+
+// evictIdle closes connections unused for longer than the idle timeout
+func (p *connPool) evictIdle() {
+	if p.idle <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pc := range append([]*poolConn(nil), p.conns...) {
+		if atomic.LoadInt32(&pc.inflight) == 0 && (!pc.alive() || time.Since(pc.lastUsed) > p.idle) {
+			p.remove(pc)
+		}
+	}
+}
+
+// checkHealth calls the health method on every idle connection and drops those that fail
+func (p *connPool) checkHealth() {
+	p.mu.Lock()
+	idle := make([]*poolConn, 0, len(p.conns))
+	for _, pc := range p.conns {
+		if atomic.LoadInt32(&pc.inflight) == 0 {
+			atomic.AddInt32(&pc.inflight, 1)
+			idle = append(idle, pc)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		ctx, cancel := context.WithTimeout(p.ctx, DefaultHandshakeTimeout)
+		var reply any
+		err := pc.client.Request(ctx, p.method, nil, &reply)
+		cancel()
+		var replyErr *jsonrpc2.Error
+		if errors.As(err, &replyErr) {
+			// An error reply still proves the connection works
+			err = nil
+		}
+
+		p.mu.Lock()
+		if err != nil {
+			atomic.StoreInt32(&pc.broken, 1)
+		}
+		if atomic.AddInt32(&pc.inflight, -1) == 0 && !pc.alive() {
+			p.remove(pc)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// close stops the janitor and closes every connection
+func (p *connPool) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+
+	p.cancel()
+	<-p.stopped
+	for _, pc := range conns {
+		pc.close()
+	}
+	return nil
+}
+
+// len returns the number of open connections
+func (p *connPool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.conns)
+}
+
+// isTransportError reports whether err means the connection itself is unusable,
+// as opposed to an error reply, a decode failure or a canceled call
+func isTransportError(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, jsonrpc2.ErrClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &opErr)
+}
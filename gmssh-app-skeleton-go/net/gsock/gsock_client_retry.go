@@ -0,0 +1,344 @@
+package gsock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+const (
+	// DefaultRetryAttempts is the number of attempts, including the first, made by a default policy
+	DefaultRetryAttempts = 3
+
+	// DefaultRetryBaseDelay is the backoff before the first retry
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+
+	// DefaultRetryMaxDelay caps the backoff between two attempts
+	DefaultRetryMaxDelay = 5 * time.Second
+
+	// DefaultBreakerThreshold is the number of consecutive failures that opens a circuit
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is how long an open circuit fails fast before letting a trial request through
+	DefaultBreakerCooldown = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting the socket while its circuit breaker is open
+var ErrCircuitOpen = errors.New("gsock: circuit open")
+
+// RetryPolicy decides whether and when a failed request is sent again
+type RetryPolicy struct {
+	MaxAttempts int                  // Attempts including the first one; 1 disables retries
+	BaseDelay   time.Duration        // Backoff before the first retry
+	MaxDelay    time.Duration        // Upper bound of the backoff
+	Multiplier  float64              // Backoff growth factor per attempt
+	Jitter      float64              // Fraction (0-1) of each backoff that is randomized
+	Retryable   func(err error) bool // Decides which errors are retried (default IsRetryable)
+}
+
+// NewRetryPolicy creates a policy making up to maxAttempts attempts with jittered exponential backoff
+// Only errors accepted by IsRetryable are retried; set Retryable to change that
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		Multiplier:  2,
+		Jitter:      0.5,
+		Retryable:   IsRetryable,
+	}
+}
+
+// retryable reports whether err may be retried under this policy
+func (p *RetryPolicy) retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the jittered delay before the given retry (1 = first retry)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.BaseDelay)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryable reports whether a request failed without reaching a handler, or was turned away
+// because the server is busy: dial errors (socket missing or refusing connections) and
+// CodeServerBusy replies. Errors after a request was written are not retried, as the
+// handler may already have run
+func IsRetryable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return isBusy(err)
+}
+
+// isBusy reports whether err carries CodeServerBusy, as a JSON-RPC error or a response exception
+func isBusy(err error) bool {
+	var replyErr *jsonrpc2.Error
+	if errors.As(err, &replyErr) {
+		return replyErr.Code == int64(gerror.CodeServerBusy.Code())
+	}
+	var exception gerror.Exception
+	if errors.As(err, &exception) {
+		return exception.Code() == gerror.CodeServerBusy.Code()
+	}
+	return false
+}
+
+// responseError returns err, or the exception of a busy response decoded into result
+// so that policies and breakers see a busy reply as a failure, whatever the result type
+func responseError(err error, result any) error {
+	if err != nil {
+		return err
+	}
+	resp := envelopeOf(result)
+	if resp == nil {
+		return nil
+	}
+	if exception := resp.Exception(); exception != nil && exception.Code() == gerror.CodeServerBusy.Code() {
+		return exception
+	}
+	return nil
+}
+
+// envelopeOf returns the code and message of the response envelope decoded into result,
+// nil when result holds none
+func envelopeOf(result any) *Response {
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case *Response:
+		return r
+	case *rawResponse:
+		return &Response{Code: r.Code, Message: r.Message}
+	case *map[string]any:
+		if r != nil {
+			return envelopeFromMap(*r)
+		}
+		return nil
+	case *any:
+		if r != nil {
+			if m, ok := (*r).(map[string]any); ok {
+				return envelopeFromMap(m)
+			}
+		}
+		return nil
+	}
+
+	// Other types are re-encoded to find the envelope fields they kept
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil
+	}
+	var envelope struct {
+		Code    int    `json:"code"`
+		Message string `json:"msg"`
+	}
+	if json.Unmarshal(data, &envelope) != nil || envelope.Code == 0 {
+		return nil
+	}
+	return &Response{Code: envelope.Code, Message: envelope.Message}
+}
+
+// envelopeFromMap reads the envelope fields of a response decoded into a map
+func envelopeFromMap(m map[string]any) *Response {
+	code, _ := m["code"].(float64)
+	message, _ := m["msg"].(string)
+	if code == 0 {
+		return nil
+	}
+	return &Response{Code: int(code), Message: message}
+}
+
+// sleepContext waits for d, giving up early if ctx ends first or its deadline falls within d
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Requests flow normally
+	BreakerOpen                         // Requests fail fast with ErrCircuitOpen
+	BreakerHalfOpen                     // One trial request is let through to detect recovery
+)
+
+// String returns the state name
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// CircuitBreaker fails fast while a socket is down
+// It opens after threshold consecutive failures, stays open for the cooldown, then lets a
+// single trial request through: success closes it again, failure reopens it
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int           // Consecutive failures while closed
+	openedAt  time.Time     // When the circuit last opened
+	trial     bool          // A half-open trial request is in flight
+	threshold int           // Failures that open the circuit
+	cooldown  time.Duration // Time spent open before a trial
+}
+
+// NewCircuitBreaker creates a closed breaker; non-positive arguments select the defaults
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// State returns the current state, moving an expired open circuit to half-open
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire()
+	return b.state
+}
+
+// expire moves an open circuit whose cooldown elapsed to half-open; the caller must hold the lock
+func (b *CircuitBreaker) expire() {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+		b.trial = false
+	}
+}
+
+// Allow reports whether a request may be sent; every allowed request must be followed by Record
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire()
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed request
+func (b *CircuitBreaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		if failed {
+			b.open()
+			return
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.trial = false
+	}
+	// Results of requests started before the circuit opened are ignored
+}
+
+// open trips the circuit; the caller must hold the lock
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+	b.trial = false
+}
+
+// BreakerGroup hands out one circuit breaker per socket path, so that every client of a
+// socket shares its state
+type BreakerGroup struct {
+	mu        sync.Mutex
+	breakers  map[string]*CircuitBreaker
+	threshold int
+	cooldown  time.Duration
+}
+
+// NewBreakerGroup creates a group whose breakers use the given threshold and cooldown
+func NewBreakerGroup(threshold int, cooldown time.Duration) *BreakerGroup {
+	return &BreakerGroup{
+		breakers:  make(map[string]*CircuitBreaker),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Get returns the breaker of a socket, creating it on first use
+func (g *BreakerGroup) Get(sockPath string) *CircuitBreaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	breaker, ok := g.breakers[sockPath]
+	if !ok {
+		breaker = NewCircuitBreaker(g.threshold, g.cooldown)
+		g.breakers[sockPath] = breaker
+	}
+	return breaker
+}
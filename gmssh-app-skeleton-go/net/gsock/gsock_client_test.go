@@ -1,17 +1,46 @@
-package gsock
+package gsock_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gsocktest"
 )
 
+// newTestService registers the ping and multiply example handlers
+func newTestService() gsock.IRpcService {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	handler.RegisterHandle("multiply", func(req *gsock.Request) (any, error) {
+		var args struct {
+			A, B int
+		}
+		if err := json.Unmarshal(*req.RawRequest().Params, &args); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+		return args.A * args.B, nil
+	})
+	return gsock.NewDefaultJsonRpcSimpleService(handler)
+}
+
 func TestMultiJsonRPCRequest(t *testing.T) {
-	socketPath := "/tmp/rpc.sock"
+	server, cleanup := gsocktest.NewSocketServer(t, newTestService())
+	defer cleanup()
+	socketPath := server.SocketPath
 	count := 0
 
 	wg := &sync.WaitGroup{}
@@ -21,17 +50,19 @@ func TestMultiJsonRPCRequest(t *testing.T) {
 			defer wg.Done()
 
 			nt := time.Now()
-			simpleClient := NewRpcSimpleClient(socketPath)
-			var result any
+			simpleClient := gsock.NewRpcSimpleClient(socketPath)
+			var result gsock.Response
 
-			opts := []jsonrpc2.CallOption{WithSimpleIDClientOpt(index)}
+			opts := []jsonrpc2.CallOption{gsock.WithSimpleIDClientOpt(index)}
 			err := simpleClient.Request(
 				context.TODO(), "ping", nil, &result, opts...)
 			if err != nil {
-				fmt.Printf("[%d] send sockets failed err : %#v  cost: %#v \n", index, err, time.Since(nt).Microseconds())
+				t.Errorf("[%d] send sockets failed err : %#v  cost: %#v", index, err, time.Since(nt).Microseconds())
 				return
 			}
-			fmt.Printf("[%d] request successfully res : %#v cost: %#v \n", index, result, time.Since(nt).Microseconds())
+			if result.Data != "pong" {
+				t.Errorf("[%d] unexpected result: %#v", index, result)
+			}
 		}(wg, count)
 		count++
 	}
@@ -40,11 +71,12 @@ func TestMultiJsonRPCRequest(t *testing.T) {
 }
 
 func TestJsonRPCPingClient(t *testing.T) {
-	socketPath := "/tmp/rpc.sock"
+	server, cleanup := gsocktest.NewSocketServer(t, newTestService())
+	defer cleanup()
 
-	simpleClient := NewRpcSimpleClient(socketPath)
+	simpleClient := gsock.NewRpcSimpleClient(server.SocketPath)
 
-	var result any
+	var result gsock.Response
 	err := simpleClient.Request(
 		context.TODO(), "ping", nil, &result,
 	)
@@ -53,15 +85,18 @@ func TestJsonRPCPingClient(t *testing.T) {
 		return
 	}
 
-	fmt.Printf("[*] request successfully res:%#v \n", result)
+	gsocktest.AssertCode(t, &result, http.StatusOK)
+	gsocktest.AssertData(t, &result, "pong")
+	gsocktest.AssertMeta(t, &result, gsock.Meta{Endpoint: "ping"})
 }
 
 func TestJsonRPCClient(t *testing.T) {
-	socketPath := "/tmp/rpc.sock"
+	server, cleanup := gsocktest.NewSocketServer(t, newTestService())
+	defer cleanup()
 
-	simpleClient := NewRpcSimpleClient(socketPath)
+	simpleClient := gsock.NewRpcSimpleClient(server.SocketPath)
 
-	var result any
+	var result gsock.Response
 	err := simpleClient.Request(
 		context.TODO(), "multiply", map[string]any{"A": 10, "B": 5}, &result,
 	)
@@ -70,5 +105,359 @@ func TestJsonRPCClient(t *testing.T) {
 		return
 	}
 
-	fmt.Printf("[*] request successfully res:%#v \n", result)
+	gsocktest.AssertCode(t, &result, http.StatusOK)
+	gsocktest.AssertData(t, &result, 50)
+}
+
+func TestKeepLiveClientPool(t *testing.T) {
+	server, cleanup := gsocktest.NewSocketServer(t, newTestService())
+	defer cleanup()
+
+	client := gsock.NewRpcKeepLiveClient(server.SocketPath,
+		gsock.WithRpcClientPoolSizeOption(2),
+		gsock.WithRpcClientPoolStreamsOption(4),
+		gsock.WithRpcClientIdleTimeoutOption(100*time.Millisecond),
+	)
+	defer client.Close()
+
+	wg := &sync.WaitGroup{}
+	for index := 0; index < 200; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+
+			var result gsock.Response
+			if err := client.Request(context.TODO(), "multiply", map[string]any{"A": index, "B": 2}, &result); err != nil {
+				t.Errorf("[%d] request failed: %v", index, err)
+				return
+			}
+			if result.Data != float64(index*2) {
+				t.Errorf("[%d] unexpected result: %#v", index, result.Data)
+			}
+		}(index)
+	}
+	wg.Wait()
+
+	if conns := client.Conns(); conns < 1 || conns > 2 {
+		t.Fatalf("pool holds %d connections, want 1-2", conns)
+	}
+
+	// Idle connections are evicted
+	deadline := time.Now().Add(2 * time.Second)
+	for client.Conns() != 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if client.Conns() != 0 {
+		t.Fatalf("idle connections not evicted: %d open", client.Conns())
+	}
+
+	// The pool dials again on demand, and refuses work once closed
+	var result gsock.Response
+	if err := client.Request(context.TODO(), "ping", nil, &result); err != nil || result.Data != "pong" {
+		t.Fatalf("request after eviction failed: %v %#v", err, result)
+	}
+	client.Close()
+	if client.Conns() != 0 {
+		t.Fatal("connections left open after Close")
+	}
+	if err := client.Request(context.TODO(), "ping", nil, &result); !errors.Is(err, gsock.ErrClientClosed) {
+		t.Fatalf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientHealthMethodAndClose(t *testing.T) {
+	checks := make(chan struct{}, 16)
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	handler.RegisterHandle("health.check", func(req *gsock.Request) (any, error) {
+		checks <- struct{}{}
+		return true, nil
+	})
+	server, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	client := gsock.NewRpcKeepLiveClient(server.SocketPath,
+		gsock.WithRpcClientHealthCheckOption(20*time.Millisecond),
+		gsock.WithRpcClientHealthMethodOption("health.check"),
+	)
+	defer client.Close()
+	var result gsock.Response
+	if err := client.Request(context.TODO(), "ping", nil, &result); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	select {
+	case <-checks:
+	case <-time.After(2 * time.Second):
+		t.Fatal("health method not called")
+	}
+
+	// Clients without keep-alive have nothing to close and keep working
+	simple := gsock.NewRpcSimpleClient(server.SocketPath)
+	if err := simple.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := simple.Request(context.TODO(), "ping", nil, &result); err != nil || result.Data != "pong" {
+		t.Fatalf("request after close failed: %v %#v", err, result)
+	}
+}
+
+func TestKeepLiveClientRecoversFromServerRestart(t *testing.T) {
+	server, cleanup := gsocktest.NewSocketServer(t, newTestService())
+	client := gsock.NewRpcKeepLiveClient(server.SocketPath)
+	defer client.Close()
+
+	var result gsock.Response
+	if err := client.Request(context.TODO(), "ping", nil, &result); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	// Once the server drops the connection the pool stops handing it out
+	cleanup()
+	deadline := time.Now().Add(2 * time.Second)
+	for client.Request(context.TODO(), "ping", nil, &result) == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	for client.Conns() != 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if client.Conns() != 0 {
+		t.Fatalf("dead connection kept in the pool")
+	}
+}
+
+func TestRequestRetriesBusyServer(t *testing.T) {
+	var calls int32
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.list", func(req *gsock.Request) (any, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return nil, gerror.CodeServerBusy
+		}
+		return []string{"/etc"}, nil
+	})
+	handler.RegisterHandle("file.delete", func(req *gsock.Request) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, gerror.CodeServerBusy
+	})
+	server, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	policy := gsock.NewRetryPolicy(5)
+	policy.BaseDelay = 5 * time.Millisecond
+	client := gsock.NewRpcSimpleClient(server.SocketPath, gsock.WithRpcClientRetryOption(policy, "file.list"))
+
+	var result gsock.Response
+	if err := client.Request(context.TODO(), "file.list", nil, &result); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	gsocktest.AssertCode(t, &result, http.StatusOK)
+	if calls := atomic.LoadInt32(&calls); calls != 3 {
+		t.Fatalf("handler called %d times, want 3", calls)
+	}
+
+	// Methods without a policy are sent once
+	atomic.StoreInt32(&calls, 0)
+	if err := client.Request(context.TODO(), "file.delete", nil, &result); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if exception := result.Exception(); exception == nil || exception.Code() != gerror.CodeServerBusy.Code() {
+		t.Fatalf("expected busy response, got %#v", result)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestTypedCallRetriesBusyServer(t *testing.T) {
+	var calls int32
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.list", func(req *gsock.Request) (any, error) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			return nil, gerror.CodeServerBusy
+		}
+		return []string{"/etc"}, nil
+	})
+	server, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	policy := gsock.NewRetryPolicy(5)
+	policy.BaseDelay = 5 * time.Millisecond
+	client := gsock.NewRpcSimpleClient(server.SocketPath, gsock.WithRpcClientRetryOption(policy, "file.list"))
+
+	// Busy replies decoded by Call are retried like those decoded into a Response
+	files, err := gsock.Call[[]string](context.TODO(), client, "file.list", nil)
+	if err != nil || len(files) != 1 || files[0] != "/etc" {
+		t.Fatalf("call returned %v, %v", files, err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 3 {
+		t.Fatalf("handler called %d times, want 3", calls)
+	}
+
+	// So are results of other types
+	var result any
+	if err := client.Request(context.TODO(), "file.list", nil, &result); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 6 {
+		t.Fatalf("handler called %d times, want 6", calls)
+	}
+
+	// Busy replies count toward the breaker
+	group := gsock.NewBreakerGroup(2, time.Minute)
+	noRetry := gsock.NewRpcSimpleClient(server.SocketPath, gsock.WithRpcClientBreakerOption(group))
+	for i := 0; i < 2; i++ {
+		if _, err := gsock.Call[[]string](context.TODO(), noRetry, "file.list", nil); err == nil {
+			t.Fatalf("[%d] expected a busy exception", i)
+		}
+	}
+	if state := group.Get(server.SocketPath).State(); state != gsock.BreakerOpen {
+		t.Fatalf("breaker %v, want open", state)
+	}
+}
+
+func TestRequestRetryRespectsDeadline(t *testing.T) {
+	policy := gsock.NewRetryPolicy(10)
+	policy.BaseDelay = time.Second
+	client := gsock.NewRpcSimpleClient(filepath.Join(os.TempDir(), "gsock-missing.sock"), gsock.WithRpcClientRetryOption(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var opErr *net.OpError
+	if err := client.Request(ctx, "ping", nil, nil); !errors.As(err, &opErr) {
+		t.Fatalf("expected the dial error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("waited %v for a retry that could not finish before the deadline", elapsed)
+	}
+}
+
+func TestCircuitBreakerRecovers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "app.sock")
+
+	group := gsock.NewBreakerGroup(2, 100*time.Millisecond)
+	client := gsock.NewRpcSimpleClient(socketPath, gsock.WithRpcClientBreakerOption(group))
+	var result gsock.Response
+	for i := 0; i < 2; i++ {
+		if err := client.Request(context.TODO(), "ping", nil, &result); err == nil || errors.Is(err, gsock.ErrCircuitOpen) {
+			t.Fatalf("[%d] expected a dial error, got %v", i, err)
+		}
+	}
+
+	// The socket is down: other clients of the group fail fast
+	other := gsock.NewRpcSimpleClient(socketPath, gsock.WithRpcClientBreakerOption(group))
+	if err := other.Request(context.TODO(), "ping", nil, &result); !errors.Is(err, gsock.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	service := newTestService()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			service.NewConn(context.Background(), conn)
+		}
+	}()
+
+	// After the cooldown a trial request gets through and closes the circuit
+	time.Sleep(150 * time.Millisecond)
+	if state := group.Get(socketPath).State(); state != gsock.BreakerHalfOpen {
+		t.Fatalf("breaker %v, want half-open", state)
+	}
+	if err := client.Request(context.TODO(), "ping", nil, &result); err != nil {
+		t.Fatalf("trial request failed: %v", err)
+	}
+	gsocktest.AssertData(t, &result, "pong")
+	if state := group.Get(socketPath).State(); state != gsock.BreakerClosed {
+		t.Fatalf("breaker %v, want closed", state)
+	}
+}
+
+func TestTypedCall(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.stat", func(req *gsock.Request) (any, error) {
+		return map[string]any{"name": "app.log", "size": 42}, nil
+	})
+	handler.RegisterHandle("file.missing", func(req *gsock.Request) (any, error) {
+		return map[string]string{"path": "/nope"}, gerror.WithMessage(gerror.CodeFileNotExistsError, "no such file")
+	})
+	client, cleanup := gsocktest.NewPipeServer(gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	type stat struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	var meta gsock.Meta
+	got, err := gsock.Call[stat](context.TODO(), client, "file.stat", nil, gsock.WithCallMetaOption(&meta))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if got != (stat{Name: "app.log", Size: 42}) || meta.Endpoint != "file.stat" {
+		t.Fatalf("unexpected result %+v, meta %+v", got, meta)
+	}
+
+	_, err = gsock.Call[stat](context.TODO(), client, "file.missing", nil)
+	var exception gerror.Exception
+	if !errors.As(err, &exception) {
+		t.Fatalf("expected an exception, got %v", err)
+	}
+	if exception.Code() != gerror.CodeFileNotExistsError.Code() || exception.Message() != "no such file" {
+		t.Fatalf("unexpected exception %v", exception)
+	}
+	if detail, ok := exception.Detail().(map[string]any); !ok || detail["path"] != "/nope" {
+		t.Fatalf("unexpected detail %#v", exception.Detail())
+	}
+
+	if _, err := gsock.Call[int](context.TODO(), client, "file.stat", nil); err == nil || errors.As(err, &exception) {
+		t.Fatalf("expected a decode error, got %v", err)
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("whoami", func(req *gsock.Request) (any, error) {
+		return req.MetaString("token") + "/" + req.MetaString("traceId"), nil
+	})
+	server, cleanup := gsocktest.NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	defer cleanup()
+
+	type traceKey struct{}
+	var order []string
+	logger := func(ctx context.Context, call *gsock.ClientCall, next gsock.ClientInvoker) error {
+		order = append(order, "log:"+call.Method)
+		return next(ctx, call)
+	}
+	client := gsock.NewRpcSimpleClient(server.SocketPath, gsock.WithRpcClientInterceptorOption(
+		logger,
+		gsock.MetaInterceptor("token", func(ctx context.Context) any { return "secret" }),
+		gsock.MetaInterceptor("traceId", func(ctx context.Context) any { return ctx.Value(traceKey{}) }),
+		gsocktest.MockInterceptor("file.list", []string{"/etc"}, nil),
+	))
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "t-1")
+	got, err := gsock.Call[string](ctx, client, "whoami", nil)
+	if err != nil || got != "secret/t-1" {
+		t.Fatalf("unexpected result %q, %v", got, err)
+	}
+
+	// Mocked methods never reach the server, which does not know them
+	files, err := gsock.Call[[]string](ctx, client, "file.list", nil)
+	if err != nil || len(files) != 1 || files[0] != "/etc" {
+		t.Fatalf("unexpected mocked result %v, %v", files, err)
+	}
+	if len(order) != 2 || order[0] != "log:whoami" || order[1] != "log:file.list" {
+		t.Fatalf("logger saw %v", order)
+	}
 }
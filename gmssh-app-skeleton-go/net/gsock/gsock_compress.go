@@ -0,0 +1,317 @@
+package gsock
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	// MethodHandshake is called by a client right after connecting to negotiate connection features
+	MethodHandshake = "rpc.handshake"
+
+	EncodingGzip = "gzip" // gzip payload compression
+	EncodingZstd = "zstd" // zstd payload compression
+
+	// DefaultCompressThreshold is the smallest marshaled message that gets compressed
+	DefaultCompressThreshold = 8 << 10 // 8KB
+
+	// DefaultHandshakeTimeout bounds how long a client waits for the handshake reply
+	DefaultHandshakeTimeout = 5 * time.Second
+
+	// maxDecodedSize caps the size of a decompressed message on connections without a frame size limit
+	maxDecodedSize = 256 << 20 // 256MB
+)
+
+// Compression configures negotiated payload compression for a connection
+// Encodings are listed in order of preference; a nil *Compression disables the feature
+type Compression struct {
+	Threshold int      // Messages smaller than this are sent uncompressed
+	Encodings []string // Supported encodings, preferred first
+}
+
+// NewCompression creates a compression config
+// Without encodings both zstd and gzip are offered, zstd preferred
+func NewCompression(threshold int, encodings ...string) *Compression {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	if len(encodings) == 0 {
+		encodings = []string{EncodingZstd, EncodingGzip}
+	}
+	return &Compression{Threshold: threshold, Encodings: encodings}
+}
+
+// HandshakeParams are sent by the client in rpc.handshake
+type HandshakeParams struct {
+	Compression []string `json:"compression"`       // Encodings the client can send and receive
+	Formats     []string `json:"formats,omitempty"` // Payload formats the client can send and receive, preferred first
+}
+
+// HandshakeResult is returned by rpc.handshake
+type HandshakeResult struct {
+	Compression string `json:"compression"`      // Encoding chosen by the server, empty for none
+	Format      string `json:"format,omitempty"` // Payload format chosen by the server, empty for servers without format support
+}
+
+// negotiate picks the first of the server's encodings the client also offered
+func (c *Compression) negotiate(offered []string) string {
+	for _, encoding := range c.Encodings {
+		for _, candidate := range offered {
+			if encoding == candidate && supportedEncoding(encoding) {
+				return encoding
+			}
+		}
+	}
+	return ""
+}
+
+// negotiatedCodec is a VSCodeObjectCodec that understands Content-Encoding and Content-Type headers
+// Messages are only compressed or sent as MessagePack once negotiated, in both directions:
+// peers that never take part in the handshake keep receiving plain JSON frames, and frames
+// using an encoding or format the handshake did not pick are rejected
+type negotiatedCodec struct {
+	threshold int          // Minimum size worth compressing
+	encoding  atomic.Value // Negotiated outgoing encoding (string)
+	format    atomic.Value // Negotiated outgoing format (string)
+	accepted  atomic.Value // Encodings and formats incoming frames may use (acceptedFrames)
+	frames    *frameReader // Reads incoming frames within the connection's limits
+}
+
+// acceptedFrames lists the encodings and formats a peer may send
+type acceptedFrames struct {
+	encodings []string
+	formats   []string
+}
+
+// newNegotiatedCodec creates a per-connection codec with nothing negotiated yet
+func newNegotiatedCodec(threshold int, frames *frameReader) *negotiatedCodec {
+	c := &negotiatedCodec{threshold: threshold, frames: frames}
+	c.encoding.Store("")
+	c.format.Store(FormatJSON)
+	c.accepted.Store(acceptedFrames{})
+	return c
+}
+
+// accept sets the encodings and formats incoming frames may use
+func (c *negotiatedCodec) accept(encodings, formats []string) {
+	c.accepted.Store(acceptedFrames{encodings: encodings, formats: formats})
+}
+
+// activate starts compressing outgoing messages with encoding
+func (c *negotiatedCodec) activate(encoding string) {
+	c.encoding.Store(encoding)
+}
+
+// activateFormat starts sending outgoing messages in format
+func (c *negotiatedCodec) activateFormat(format string) {
+	c.format.Store(format)
+}
+
+// Encoding returns the negotiated outgoing encoding
+func (c *negotiatedCodec) Encoding() string {
+	return c.encoding.Load().(string)
+}
+
+// Format returns the negotiated outgoing format
+func (c *negotiatedCodec) Format() string {
+	return c.format.Load().(string)
+}
+
+// WriteObject implements jsonrpc2.ObjectCodec
+func (c *negotiatedCodec) WriteObject(stream io.Writer, obj any) error {
+	data, header, err := encodeFrame(c.Format(), obj)
+	if err != nil {
+		return err
+	}
+
+	if encoding := c.Encoding(); encoding != "" && len(data) >= c.threshold {
+		// Keep the plain payload if compression fails or doesn't pay off
+		if compressed, err := compress(encoding, data); err == nil && len(compressed) < len(data) {
+			data = compressed
+			header += fmt.Sprintf("Content-Encoding: %s\r\n", encoding)
+		}
+	}
+
+	if _, err := fmt.Fprintf(stream, "Content-Length: %d\r\n%s\r\n", len(data), header); err != nil {
+		return err
+	}
+	_, err = stream.Write(data)
+	return err
+}
+
+// ReadObject implements jsonrpc2.ObjectCodec
+func (c *negotiatedCodec) ReadObject(stream *bufio.Reader, v any) error {
+	return c.frames.readObject(stream, v, c.decode)
+}
+
+// decode accepts only the negotiated encoding and format
+func (c *negotiatedCodec) decode(header frameHeader, data []byte, maxSize int) ([]byte, error) {
+	accepted := c.accepted.Load().(acceptedFrames)
+	if header.encoding != "" && !slices.Contains(accepted.encodings, header.encoding) {
+		return nil, fmt.Errorf("content encoding %q was not negotiated", header.encoding)
+	}
+	if header.contentType == contentTypeMsgpack && !slices.Contains(accepted.formats, FormatMsgpack) {
+		return nil, fmt.Errorf("content type %q was not negotiated", header.contentType)
+	}
+	return decodeFrame(header, data, maxSize)
+}
+
+// supportedEncoding reports whether this package can encode and decode encoding
+func supportedEncoding(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+
+	// zstdDecoders holds streaming decoders, which decode synchronously with a concurrency of 1
+	zstdDecoders = sync.Pool{New: func() any {
+		decoder, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecodedSize))
+		return decoder
+	}}
+)
+
+// zstdCodec returns the shared zstd encoder; EncodeAll is safe for concurrent use
+func zstdCodec() *zstd.Encoder {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	})
+	return zstdEncoder
+}
+
+// compress encodes data with encoding
+func compress(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingZstd:
+		encoder := zstdCodec()
+		return encoder.EncodeAll(data, nil), nil
+	case EncodingGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("jsonrpc2: unsupported content encoding %q", encoding)
+}
+
+// decompress decodes data with encoding, refusing output larger than maxSize
+// Output is read through a bounded reader, so a small bomb never inflates past the limit
+func decompress(encoding string, data []byte, maxSize int) ([]byte, error) {
+	switch encoding {
+	case EncodingZstd:
+		decoder := zstdDecoders.Get().(*zstd.Decoder)
+		defer func() {
+			decoder.Reset(nil)
+			zstdDecoders.Put(decoder)
+		}()
+		if err := decoder.Reset(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		return readBounded(decoder, maxSize)
+	case EncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readBounded(reader, maxSize)
+	}
+	return nil, fmt.Errorf("jsonrpc2: unsupported content encoding %q", encoding)
+}
+
+// readBounded reads r to the end, failing once more than maxSize bytes come out
+func readBounded(r io.Reader, maxSize int) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxSize {
+		return nil, fmt.Errorf("jsonrpc2: decompressed message exceeds %d bytes", maxSize)
+	}
+	return out, nil
+}
+
+// acceptHandshake answers rpc.handshake on the server side
+// Compression and the format are switched on before replying: the client advertised it can
+// decode what it offered, so even the reply may already use them
+// compression and formats are what the server offers, nil when it offers none
+func acceptHandshake(compression *Compression, formats []string, codec *negotiatedCodec, req *jsonrpc2.Request) (any, error) {
+	var params HandshakeParams
+	if req.Params != nil {
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+		}
+	}
+
+	var result HandshakeResult
+	if compression != nil {
+		result.Compression = compression.negotiate(params.Compression)
+	}
+	if len(formats) > 0 {
+		result.Format = negotiateFormat(formats, params.Formats)
+	}
+	var accepted acceptedFrames
+	if result.Compression != "" {
+		codec.activate(result.Compression)
+		accepted.encodings = []string{result.Compression}
+	}
+	if result.Format != "" {
+		codec.activateFormat(result.Format)
+		accepted.formats = []string{result.Format}
+	}
+	codec.accept(accepted.encodings, accepted.formats)
+	return NewResponse().WithData(result, MethodHandshake), nil
+}
+
+// handshake negotiates compression and the payload format from the client side
+// Servers without support answer with an error, a non-200 envelope or empty choices,
+// in which case the connection simply stays uncompressed JSON
+func handshake(ctx context.Context, conn *jsonrpc2.Conn, compression *Compression, formats []string, codec *negotiatedCodec) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultHandshakeTimeout)
+	defer cancel()
+
+	var resp struct {
+		Code int             `json:"code"`
+		Data HandshakeResult `json:"data"`
+	}
+	params := HandshakeParams{Formats: formats}
+	if compression != nil {
+		params.Compression = compression.Encodings
+	}
+	// The server may already use its choice for the reply, so anything offered is accepted
+	// until the reply tells which one it picked
+	codec.accept(params.Compression, formats)
+	if err := conn.Call(ctx, MethodHandshake, params, &resp); err != nil || resp.Code != http.StatusOK {
+		codec.accept(nil, nil)
+		return
+	}
+	var accepted acceptedFrames
+	if compression != nil && supportedEncoding(resp.Data.Compression) {
+		codec.activate(resp.Data.Compression)
+		accepted.encodings = []string{resp.Data.Compression}
+	}
+	if slices.Contains(formats, resp.Data.Format) && supportedFormat(resp.Data.Format) {
+		codec.activateFormat(resp.Data.Format)
+		accepted.formats = []string{resp.Data.Format}
+	}
+	codec.accept(accepted.encodings, accepted.formats)
+}
@@ -0,0 +1,100 @@
+package gsock
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock/gmsgpack"
+)
+
+const (
+	FormatJSON    = "json"    // JSON payloads, the default
+	FormatMsgpack = "msgpack" // MessagePack payloads; []byte values travel as binary instead of base64
+
+	// contentTypeMsgpack marks frames with a MessagePack payload
+	contentTypeMsgpack = "application/msgpack"
+)
+
+// supportedFormat reports whether this package can encode and decode format
+func supportedFormat(format string) bool {
+	return format == FormatJSON || format == FormatMsgpack
+}
+
+// negotiateFormat picks the first of the server's formats the client also offered, JSON for none
+func negotiateFormat(formats, offered []string) string {
+	for _, format := range formats {
+		for _, candidate := range offered {
+			if format == candidate && supportedFormat(format) {
+				return format
+			}
+		}
+	}
+	return FormatJSON
+}
+
+// decodeFrame turns a compressed or MessagePack payload into JSON
+func decodeFrame(header frameHeader, data []byte, maxSize int) ([]byte, error) {
+	if header.encoding != "" {
+		var err error
+		if data, err = decompress(header.encoding, data, maxSize); err != nil {
+			return nil, err
+		}
+	}
+	if header.contentType == contentTypeMsgpack {
+		return gmsgpack.ToJSON(data)
+	}
+	return data, nil
+}
+
+// encodeFrame marshals obj in format, returning the payload and its Content-Type header line
+func encodeFrame(format string, obj any) ([]byte, string, error) {
+	if format == FormatMsgpack {
+		data, err := gmsgpack.Marshal(obj)
+		return data, "Content-Type: " + contentTypeMsgpack + "\r\n", err
+	}
+	data, err := json.Marshal(obj)
+	return data, "", err
+}
+
+// directReply is a successful response written straight to the stream, so the codec encodes
+// the result value itself instead of the JSON jsonrpc2 would have marshaled it to
+type directReply struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      jsonrpc2.ID `json:"id"`
+	Result  any         `json:"result"`
+}
+
+// formatHandler answers requests like jsonrpc2.HandlerWithError, except that results are
+// written directly once a binary format is negotiated, keeping []byte data binary on the wire
+type formatHandler struct {
+	handle func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error)
+	codec  *negotiatedCodec
+	stream jsonrpc2.ObjectStream
+}
+
+// Handle implements jsonrpc2.Handler
+func (h *formatHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	result, err := h.handle(ctx, conn, req)
+	if req.Notif {
+		return
+	}
+	if err == nil && h.codec.Format() != FormatJSON {
+		_ = h.stream.WriteObject(&directReply{JSONRPC: "2.0", ID: req.ID, Result: result})
+		return
+	}
+
+	resp := &jsonrpc2.Response{ID: req.ID}
+	if err == nil {
+		err = resp.SetResult(result)
+	}
+	if err != nil {
+		if e, ok := err.(*jsonrpc2.Error); ok {
+			resp.Error = e
+		} else {
+			resp.Error = &jsonrpc2.Error{Message: err.Error()}
+		}
+	}
+	_ = conn.SendResponse(ctx, resp)
+}
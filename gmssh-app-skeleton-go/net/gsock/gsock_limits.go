@@ -0,0 +1,364 @@
+package gsock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+const (
+	// DefaultMaxFrameSize bounds the Content-Length the server accepts
+	DefaultMaxFrameSize = 64 << 20 // 64MB
+
+	// maxHeaderSize bounds the header section of a frame
+	maxHeaderSize = 8 << 10 // 8KB
+)
+
+// Limits bounds what a peer may send on a server connection
+// Oversized frames and frames that cannot be parsed get an error reply with meta.close set,
+// then the connection is closed. Oversized params and batches only fail their own request.
+type Limits struct {
+	MaxFrameSize   int           // Largest Content-Length accepted, and largest decompressed payload, in bytes
+	MaxParamsSize  int           // Largest params accepted, in bytes; 0 leaves them bounded by the frame
+	MaxBatchLength int           // Largest batch accepted; 0 for no limit. Batches within it are passed on to jsonrpc2, which does not dispatch them
+	ReadTimeout    time.Duration // Idle time after which a connection without calls in flight is closed, and the time a started frame has to arrive; 0 disables it
+}
+
+// NewLimits creates limits with DefaultMaxFrameSize and everything else disabled
+func NewLimits() *Limits {
+	return &Limits{MaxFrameSize: DefaultMaxFrameSize}
+}
+
+// LoadLimitsConfig creates Limits from the "limits" config section; missing keys keep NewLimits values
+//
+//	"limits": {"maxFrameSize": 4194304, "maxParamsSize": 1048576, "maxBatchLength": 32, "readTimeout": "5m"}
+func LoadLimitsConfig(cData map[string]any) (*Limits, error) {
+	data, err := json.Marshal(cData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal limits config: %w", err)
+	}
+	var config struct {
+		MaxFrameSize   *int   `json:"maxFrameSize"`
+		MaxParamsSize  int    `json:"maxParamsSize"`
+		MaxBatchLength int    `json:"maxBatchLength"`
+		ReadTimeout    string `json:"readTimeout"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal limits config: %w", err)
+	}
+
+	limits := NewLimits()
+	if config.MaxFrameSize != nil {
+		limits.MaxFrameSize = *config.MaxFrameSize
+	}
+	limits.MaxParamsSize = config.MaxParamsSize
+	limits.MaxBatchLength = config.MaxBatchLength
+	if config.ReadTimeout != "" {
+		if limits.ReadTimeout, err = time.ParseDuration(config.ReadTimeout); err != nil {
+			return nil, fmt.Errorf("invalid limits readTimeout: %w", err)
+		}
+	}
+	return limits, nil
+}
+
+// frameError is a frame rejected by the frame reader
+type frameError struct {
+	status  int          // Response code of the reply
+	message string       // Reply message
+	id      *jsonrpc2.ID // Request to reply to, nil for the whole frame
+	notif   bool         // The rejected request is a notification, which gets no reply
+	close   bool         // Whether the connection is closed afterwards
+}
+
+// Error implements error
+func (e *frameError) Error() string {
+	return "jsonrpc2: " + e.message
+}
+
+// rejection is a reply sent by the frame reader, outside any handler
+type rejection struct {
+	JSONRPC string       `json:"jsonrpc"`
+	ID      *jsonrpc2.ID `json:"id"` // null when the request could not be identified
+	Result  *Response    `json:"result"`
+}
+
+// malformedFrames counts malformed frames by peer
+type malformedFrames struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// add counts a malformed frame of peer
+func (m *malformedFrames) add(peer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts = make(map[string]uint64)
+	}
+	m.counts[peer]++
+}
+
+// snapshot returns a copy of the counts
+func (m *malformedFrames) snapshot() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]uint64, len(m.counts))
+	for peer, n := range m.counts {
+		counts[peer] = n
+	}
+	return counts
+}
+
+// peerKey identifies the process behind a session for the malformed frame counter
+func peerKey(s *Session) string {
+	if cred, err := s.PeerCred(); err == nil {
+		return fmt.Sprintf("pid:%d uid:%d", cred.PID, cred.UID)
+	}
+	if addr := s.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	return "unknown"
+}
+
+// frameReader reads Content-Length frames of one connection within its limits
+// Without a session it only enforces the frame size, as clients do
+type frameReader struct {
+	limits    *Limits
+	session   *Session
+	stream    jsonrpc2.ObjectStream // Sends rejections, set once the stream exists
+	malformed *malformedFrames
+}
+
+// frameHeader holds the frame headers that affect how the payload is decoded
+type frameHeader struct {
+	encoding    string // Content-Encoding, empty for none
+	contentType string // Content-Type, empty for the default JSON
+}
+
+// plain reports whether the payload is uncompressed JSON
+func (h frameHeader) plain() bool {
+	return h.encoding == "" && h.contentType != contentTypeMsgpack
+}
+
+// frameDecoder turns the payload of a frame with non-plain headers into JSON
+// Decompressed payloads larger than maxSize are refused
+type frameDecoder func(header frameHeader, data []byte, maxSize int) ([]byte, error)
+
+// readObject reads the next acceptable frame into v
+// decode handles compressed and non-JSON payloads, nil when none are supported
+func (r *frameReader) readObject(stream *bufio.Reader, v any, decode frameDecoder) error {
+	for {
+		data, err := r.readFrame(stream, decode)
+		if err == nil {
+			err = r.check(data)
+		}
+		if err == nil {
+			if err = json.Unmarshal(data, v); err != nil {
+				err = &frameError{status: http.StatusBadRequest, message: err.Error(), close: true}
+			}
+		}
+		if err == nil {
+			return nil
+		}
+
+		var rejected *frameError
+		if !errors.As(err, &rejected) {
+			return err // I/O errors and timeouts close the connection silently
+		}
+		if r.session != nil && r.malformed != nil && rejected.close {
+			r.malformed.add(peerKey(r.session))
+		}
+		r.reject(rejected)
+		if rejected.close {
+			return rejected
+		}
+	}
+}
+
+// readFrame reads one frame, waiting out idle periods while calls are in flight
+func (r *frameReader) readFrame(stream *bufio.Reader, decode frameDecoder) ([]byte, error) {
+	if err := r.awaitFrame(stream); err != nil {
+		return nil, err
+	}
+
+	var (
+		contentLength uint64
+		header        frameHeader
+		headerSize    int
+	)
+	for {
+		line, err := stream.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, &frameError{status: http.StatusBadRequest, message: "header line too long", close: true}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if headerSize += len(line); headerSize > maxHeaderSize {
+			return nil, &frameError{status: http.StatusBadRequest, message: "header too long", close: true}
+		}
+		if !bytes.HasSuffix(line, []byte("\r\n")) {
+			return nil, &frameError{status: http.StatusBadRequest, message: `line endings must be \r\n`, close: true}
+		}
+		if len(line) == 2 {
+			break
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(string(line)), ":")
+		switch strings.TrimSpace(name) {
+		case "Content-Length":
+			if contentLength, err = strconv.ParseUint(strings.TrimSpace(value), 10, 63); err != nil {
+				return nil, &frameError{status: http.StatusBadRequest, message: "invalid Content-Length", close: true}
+			}
+		case "Content-Encoding":
+			header.encoding = strings.TrimSpace(value)
+		case "Content-Type":
+			header.contentType, _, _ = strings.Cut(strings.TrimSpace(value), ";")
+		}
+	}
+	if contentLength == 0 {
+		return nil, &frameError{status: http.StatusBadRequest, message: "no Content-Length header found", close: true}
+	}
+	maxSize := uint64(math.MaxUint32)
+	if r.limits.MaxFrameSize > 0 {
+		maxSize = uint64(r.limits.MaxFrameSize)
+	}
+	if contentLength > maxSize {
+		return nil, &frameError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("frame of %d bytes exceeds the limit of %d bytes", contentLength, maxSize),
+			close:   true,
+		}
+	}
+
+	data := make([]byte, contentLength)
+	if _, err := io.ReadFull(stream, data); err != nil {
+		return nil, err
+	}
+	if header.plain() {
+		return data, nil
+	}
+	if decode == nil {
+		message := fmt.Sprintf("unsupported content encoding %q", header.encoding)
+		if header.encoding == "" {
+			message = fmt.Sprintf("unsupported content type %q", header.contentType)
+		}
+		return nil, &frameError{status: http.StatusBadRequest, message: message, close: true}
+	}
+	decodedSize := maxDecodedSize
+	if r.limits.MaxFrameSize > 0 {
+		decodedSize = r.limits.MaxFrameSize
+	}
+	data, err := decode(header, data, decodedSize)
+	if err != nil {
+		return nil, &frameError{status: http.StatusBadRequest, message: err.Error(), close: true}
+	}
+	return data, nil
+}
+
+// awaitFrame waits for the first byte of a frame under the read timeout, then gives the
+// rest of the frame the same time to arrive
+// Timeouts while calls are in flight are ignored: the connection is busy, not idle
+func (r *frameReader) awaitFrame(stream *bufio.Reader) error {
+	if r.session == nil || r.limits.ReadTimeout <= 0 {
+		return nil
+	}
+	conn := r.session.NetConn()
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(r.limits.ReadTimeout)); err != nil {
+			return nil // The connection does not support deadlines
+		}
+		_, err := stream.Peek(1)
+		if err == nil {
+			return conn.SetReadDeadline(time.Now().Add(r.limits.ReadTimeout))
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) || r.session.inflight.Load() == 0 {
+			return err
+		}
+	}
+}
+
+// check applies the params and batch limits to a complete frame
+func (r *frameReader) check(data []byte) error {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if r.limits.MaxBatchLength <= 0 {
+			return nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		if _, err := decoder.Token(); err != nil {
+			return nil // Left to jsonrpc2 to report
+		}
+		n := 0
+		for decoder.More() {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil
+			}
+			if n++; n > r.limits.MaxBatchLength {
+				return &frameError{
+					status:  http.StatusRequestEntityTooLarge,
+					message: fmt.Sprintf("batch exceeds the limit of %d requests", r.limits.MaxBatchLength),
+				}
+			}
+		}
+		return nil
+	}
+
+	if r.limits.MaxParamsSize <= 0 {
+		return nil
+	}
+	var message struct {
+		ID     *jsonrpc2.ID    `json:"id"`
+		Method *string         `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil || message.Method == nil {
+		return nil // Malformed frames and responses are left to jsonrpc2
+	}
+	if len(message.Params) > r.limits.MaxParamsSize {
+		return &frameError{
+			status:  http.StatusRequestEntityTooLarge,
+			message: fmt.Sprintf("params of %d bytes exceed the limit of %d bytes", len(message.Params), r.limits.MaxParamsSize),
+			id:      message.ID,
+			notif:   message.ID == nil,
+		}
+	}
+	return nil
+}
+
+// reject replies to a rejected frame in the usual envelope, with an InvalidRequest message
+func (r *frameReader) reject(rejected *frameError) {
+	if r.stream == nil || rejected.notif {
+		return
+	}
+	response := NewResponse().WithError(rejected.status, gerror.WithMessage(gerror.CodeInvalidRequest, rejected.message).Error())
+	if rejected.close {
+		response.SetClose(1)
+	}
+	_ = r.stream.WriteObject(&rejection{JSONRPC: "2.0", ID: rejected.id, Result: response})
+}
+
+// frameCodec is the VSCodeObjectCodec reading frames through a frameReader
+type frameCodec struct {
+	jsonrpc2.VSCodeObjectCodec
+	frames *frameReader
+}
+
+// ReadObject implements jsonrpc2.ObjectCodec
+func (c *frameCodec) ReadObject(stream *bufio.Reader, v any) error {
+	return c.frames.readObject(stream, v, nil)
+}
@@ -0,0 +1,264 @@
+package gsock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Listener is a service served on a Unix socket as part of a ListenerGroup
+type Listener struct {
+	SocketPath string      // Path of the Unix socket, replaced if it exists
+	Service    IRpcService // Service handling the socket's connections
+}
+
+// ListenerGroup serves several services on their own Unix sockets under one lifecycle:
+// they start together, and an interrupt signal, Stop or a failing listener stops them all
+// Services may share one handler registry, e.g. through NewMethodFilter, while keeping their
+// own middlewares, limits and sessions
+type ListenerGroup struct {
+	listeners []Listener
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu    sync.Mutex
+	nets  []net.Listener              // Open sockets
+	conns map[*jsonrpc2.Conn]struct{} // Open connections, closed on shutdown so disconnect hooks run
+	err   error                       // First accept error
+	stop  sync.Once
+}
+
+// NewListenerGroup creates a group serving listeners once started
+func NewListenerGroup(listeners ...Listener) *ListenerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ListenerGroup{
+		listeners: listeners,
+		ctx:       ctx,
+		cancel:    cancel,
+		conns:     make(map[*jsonrpc2.Conn]struct{}),
+	}
+}
+
+// Start listens on every socket and serves connections until the group is stopped
+// If any socket cannot be opened, the ones already open are closed and the error is returned.
+// A group stopped before or while its sockets are opened returns right away.
+// Returns nil after a shutdown, or the error of the listener that failed.
+func (g *ListenerGroup) Start() error {
+	for _, l := range g.listeners {
+		if err := g.listen(l); err != nil {
+			g.Stop()
+			return err
+		}
+		if g.ctx.Err() != nil {
+			return nil
+		}
+	}
+	if g.ctx.Err() != nil {
+		return nil
+	}
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		select {
+		case <-sigChan:
+			log.Println("[*] Received shutdown signal, cleaning up...")
+			g.Stop()
+		case <-g.ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	g.mu.Lock()
+	for i, listener := range g.nets {
+		wg.Add(1)
+		go func(listener net.Listener, service IRpcService) {
+			defer wg.Done()
+			g.serve(listener, service)
+		}(listener, g.listeners[i].Service)
+	}
+	g.mu.Unlock()
+	wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Stop closes the sockets and open connections of every listener and removes the socket files
+// Safe to call more than once and from any goroutine
+func (g *ListenerGroup) Stop() {
+	g.stop.Do(func() {
+		g.cancel()
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for i, listener := range g.nets {
+			listener.Close()
+			os.Remove(g.listeners[i].SocketPath)
+		}
+		for conn := range g.conns {
+			conn.Close()
+		}
+	})
+}
+
+// listen opens the socket of l, replacing a stale socket file
+// Once the group is stopped the socket is closed again instead of being added
+func (g *ListenerGroup) listen(l Listener) error {
+	// Clean up any existing socket file
+	if err := os.Remove(l.SocketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove existing socket: %w", err)
+	}
+
+	// Create Unix domain socket listener
+	listener, err := net.Listen("unix", l.SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on Unix socket: %w", err)
+	}
+
+	// Stop cancels the context before closing the sockets under the lock, so a socket is
+	// either closed by Stop or never added
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx.Err() != nil {
+		listener.Close()
+		os.Remove(l.SocketPath)
+		return nil
+	}
+	g.nets = append(g.nets, listener)
+	log.Printf("JSON-RPC server listening on Unix socket: %s\n", l.SocketPath)
+	return nil
+}
+
+// serve accepts connections for service until the group stops, stopping it on accept errors
+func (g *ListenerGroup) serve(listener net.Listener, service IRpcService) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Check if error is due to shutdown
+			if g.ctx.Err() != nil {
+				return // Graceful shutdown
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue // Temporary error, keep listening
+			}
+			g.mu.Lock()
+			if g.err == nil {
+				g.err = fmt.Errorf("connection accept error: %w", err)
+			}
+			g.mu.Unlock()
+			g.Stop()
+			return
+		}
+
+		// Handle each connection in a separate goroutine
+		go g.handle(conn, service)
+	}
+}
+
+// handle serves one connection, tracking it so shutdown can close it
+func (g *ListenerGroup) handle(conn net.Conn, service IRpcService) {
+	jsonConn := service.NewConn(g.ctx, conn)
+	g.mu.Lock()
+	if g.ctx.Err() != nil {
+		// Accepted while shutting down
+		g.mu.Unlock()
+		jsonConn.Close()
+		return
+	}
+	g.conns[jsonConn] = struct{}{}
+	g.mu.Unlock()
+
+	<-jsonConn.DisconnectNotify()
+	g.mu.Lock()
+	delete(g.conns, jsonConn)
+	g.mu.Unlock()
+}
+
+// methodLister is implemented by handlers that can list their methods for rpc.methods
+type methodLister interface {
+	Methods() []string
+	methodsAllowed(req *Request) (bool, error)
+}
+
+// methodFilter exposes the methods of a shared handler that match its patterns
+type methodFilter struct {
+	IRpcServiceHandle
+	patterns []string
+}
+
+// NewMethodFilter exposes only the methods of handler matching one of patterns, in path.Match
+// syntax ("file.*"); other methods answer 404 as if they were not registered, and rpc.methods
+// lists the exposed ones, if handler lists its methods. Registration goes through to handler, so the registry stays shared:
+//
+//	filtered, err := gsock.NewMethodFilter(handler, "ping", "file.*")
+//	public := gsock.NewJsonRpcSimpleService(
+//		gsock.WithJsonRpcSimpleServiceHandler(filtered),
+//		gsock.WithJsonRpcSimpleServiceMiddlewares(auth),
+//	)
+//
+// An error is returned for malformed patterns
+func NewMethodFilter(handler IRpcServiceHandle, patterns ...string) (IRpcServiceHandle, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("method pattern %q: %w", pattern, err)
+		}
+	}
+	return &methodFilter{IRpcServiceHandle: handler, patterns: patterns}, nil
+}
+
+// allows reports whether method is exposed
+func (f *methodFilter) allows(method string) bool {
+	for _, pattern := range f.patterns {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Methods returns the exposed methods of the handler in sorted order
+func (f *methodFilter) Methods() []string {
+	lister, ok := LookupHandle[methodLister](f.IRpcServiceHandle)
+	if !ok {
+		return nil
+	}
+	methods := make([]string, 0)
+	for _, method := range lister.Methods() {
+		if f.allows(method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// Handle implements IRpcServiceHandle
+func (f *methodFilter) Handle(req *Request) (any, error) {
+	method := req.Method()
+	lister, lists := LookupHandle[methodLister](f.IRpcServiceHandle)
+	if f.allows(method) && !(lists && method == MethodMethods) {
+		return f.IRpcServiceHandle.Handle(req)
+	}
+
+	response := NewResponse()
+	response.SetEndpoint(method)
+	if lists && method == MethodMethods {
+		return answerMethods(req, response, lister, f.Methods), nil
+	}
+	return notFound(response), nil
+}
+
+// Unwrap returns the filtered handler, see IUnwrapHandle
+func (f *methodFilter) Unwrap() IRpcServiceHandle {
+	return f.IRpcServiceHandle
+}
@@ -0,0 +1,225 @@
+package gsock
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+// MaintenanceNotice describes why the app or a method is unavailable
+// It is sent back as the data of refused requests
+type MaintenanceNotice struct {
+	Method     string    `json:"method,omitempty"` // Disabled method, empty for the whole app
+	Reason     string    `json:"reason"`           // Shown to callers
+	RetryAfter int       `json:"retryAfter"`       // Seconds after which callers may retry, 0 if unknown
+	Since      time.Time `json:"since"`            // Time the method or app was turned off
+}
+
+// Exception returns the error sent to refused callers
+// The whole app and methods with a retry hint are only paused (CodeServerBusy);
+// methods disabled without one are CodeNotSupported
+func (n *MaintenanceNotice) Exception() gerror.Exception {
+	code := gerror.CodeServerBusy
+	if n.Method != "" && n.RetryAfter == 0 {
+		code = gerror.CodeNotSupported
+	}
+	if n.Reason == "" {
+		return gerror.WithMessage(code, code.Message())
+	}
+	return gerror.WithMessage(code, n.Reason)
+}
+
+// MaintenanceRule turns the app or a method off in MaintenanceConfig
+type MaintenanceRule struct {
+	Reason     string `json:"reason"`     // Shown to callers
+	RetryAfter int    `json:"retryAfter"` // Seconds after which callers may retry
+}
+
+// MaintenanceConfig is the "maintenance" config section
+//
+//	"maintenance": {
+//	  "enabled": false,
+//	  "reason": "data migration",
+//	  "retryAfter": 300,
+//	  "methods": {"orders.create": {"reason": "orders are being migrated", "retryAfter": 600}},
+//	  "exempt": ["status"]
+//	}
+type MaintenanceConfig struct {
+	Enabled    bool                       `json:"enabled"`    // Turns the whole app off
+	Reason     string                     `json:"reason"`     // Reason for the whole app
+	RetryAfter int                        `json:"retryAfter"` // Retry hint for the whole app, in seconds
+	Methods    map[string]MaintenanceRule `json:"methods"`    // Methods turned off individually
+	Exempt     []string                   `json:"exempt"`     // Methods kept up in addition to the health methods
+}
+
+// LoadMaintenanceConfig creates a MaintenanceConfig from a map of configuration data
+func LoadMaintenanceConfig(cData map[string]any) (*MaintenanceConfig, error) {
+	data, err := json.Marshal(cData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal maintenance config: %w", err)
+	}
+	var config MaintenanceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal maintenance config: %w", err)
+	}
+	return &config, nil
+}
+
+// MaintenanceStatus is a snapshot of the maintenance state
+type MaintenanceStatus struct {
+	App     *MaintenanceNotice           `json:"app"`     // Set while the whole app is off
+	Methods map[string]MaintenanceNotice `json:"methods"` // Methods turned off individually
+	Exempt  []string                     `json:"exempt"`  // Methods that stay up during app maintenance
+}
+
+// Maintenance turns the whole app or single methods off at runtime, safe for concurrent use
+// Exempt methods, by default the health methods "ping" and rpc.methods, stay up while the
+// whole app is off and cannot be turned off individually, so the health and admin methods
+// can never lock themselves out
+type Maintenance struct {
+	mu      sync.RWMutex
+	app     *MaintenanceNotice
+	methods map[string]*MaintenanceNotice
+	exempt  map[string]struct{}
+}
+
+// NewMaintenance creates a maintenance switch with everything turned on
+func NewMaintenance() *Maintenance {
+	return &Maintenance{
+		methods: make(map[string]*MaintenanceNotice),
+		exempt: map[string]struct{}{
+			"ping":        {},
+			MethodMethods: {},
+		},
+	}
+}
+
+// Exempt keeps methods up while the whole app is off, e.g. health checks or the admin methods
+// Exempt methods that were turned off individually are turned back on
+func (m *Maintenance) Exempt(methods ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, method := range methods {
+		m.exempt[method] = struct{}{}
+		delete(m.methods, method)
+	}
+}
+
+// Enable turns the whole app off; retryAfter is rounded to seconds
+func (m *Maintenance) Enable(reason string, retryAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.app = newMaintenanceNotice("", reason, retryAfter)
+}
+
+// Disable turns the whole app back on; individually disabled methods stay off
+func (m *Maintenance) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.app = nil
+}
+
+// DisableMethod turns a single method off
+// Exempt methods are refused with CodeInvalidOperation
+func (m *Maintenance) DisableMethod(method, reason string, retryAfter time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.exempt[method]; ok {
+		return exemptError(method)
+	}
+	m.methods[method] = newMaintenanceNotice(method, reason, retryAfter)
+	return nil
+}
+
+// EnableMethod turns a method disabled by DisableMethod back on
+func (m *Maintenance) EnableMethod(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.methods, method)
+}
+
+// Apply replaces the state with the one described by config
+// Exempt methods are added to the current ones. A config turning off an exempt method is
+// refused with CodeInvalidOperation and leaves the state unchanged
+func (m *Maintenance) Apply(config *MaintenanceConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for method := range config.Methods {
+		if _, ok := m.exempt[method]; ok || slices.Contains(config.Exempt, method) {
+			return exemptError(method)
+		}
+	}
+
+	m.app = nil
+	if config.Enabled {
+		m.app = newMaintenanceNotice("", config.Reason, time.Duration(config.RetryAfter)*time.Second)
+	}
+	m.methods = make(map[string]*MaintenanceNotice, len(config.Methods))
+	for method, rule := range config.Methods {
+		m.methods[method] = newMaintenanceNotice(method, rule.Reason, time.Duration(rule.RetryAfter)*time.Second)
+	}
+	for _, method := range config.Exempt {
+		m.exempt[method] = struct{}{}
+	}
+	return nil
+}
+
+// Check returns the notice refusing method, nil if it may be called
+func (m *Maintenance) Check(method string) *MaintenanceNotice {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.exempt[method]; ok {
+		return nil
+	}
+	if notice, ok := m.methods[method]; ok {
+		return notice
+	}
+	return m.app
+}
+
+// Status returns a snapshot of the maintenance state
+func (m *Maintenance) Status() *MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := &MaintenanceStatus{
+		Methods: make(map[string]MaintenanceNotice, len(m.methods)),
+		Exempt:  make([]string, 0, len(m.exempt)),
+	}
+	if m.app != nil {
+		app := *m.app
+		status.App = &app
+	}
+	for method, notice := range m.methods {
+		status.Methods[method] = *notice
+	}
+	for method := range m.exempt {
+		status.Exempt = append(status.Exempt, method)
+	}
+	sort.Strings(status.Exempt)
+	return status
+}
+
+// exemptError refuses turning off an exempt method
+func exemptError(method string) error {
+	return gerror.WithMessage(gerror.CodeInvalidOperation, fmt.Sprintf("%s is exempt from maintenance and cannot be turned off", method))
+}
+
+// newMaintenanceNotice creates a notice starting now
+func newMaintenanceNotice(method, reason string, retryAfter time.Duration) *MaintenanceNotice {
+	return &MaintenanceNotice{
+		Method:     method,
+		Reason:     reason,
+		RetryAfter: int((retryAfter + time.Second - 1) / time.Second),
+		Since:      time.Now(),
+	}
+}
@@ -2,8 +2,12 @@ package gsock
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
 )
 
 // RequestOptFunc defines functions for configuring Request objects
@@ -11,8 +15,10 @@ type RequestOptFunc func(*Request)
 
 // Request wraps a JSON-RPC 2.0 request with additional context and functionality
 type Request struct {
-	ctx context.Context   // Context for cancellation/timeout
-	req *jsonrpc2.Request // Underlying JSON-RPC request
+	ctx  context.Context   // Context for cancellation/timeout
+	req  *jsonrpc2.Request // Underlying JSON-RPC request
+	conn *jsonrpc2.Conn    // Connection the request arrived on (nil outside a connection)
+	sess *Session          // Session of the connection (nil outside a service connection)
 }
 
 // RawRequest returns the underlying JSON-RPC 2.0 request object
@@ -21,12 +27,84 @@ func (r *Request) RawRequest() *jsonrpc2.Request {
 	return r.req
 }
 
+// Conn returns the JSON-RPC connection the request arrived on
+// JSON-RPC 2.0 connections are symmetric, so handlers can use it to call back into the peer:
+//
+//	req.Conn().Notify(req.Context(), "job.progress", progress)
+//	req.Conn().Call(req.Context(), "ui.confirm", question, &answer)
+//
+// Returns nil when the request was not received over a connection (e.g. in unit tests)
+func (r *Request) Conn() *jsonrpc2.Conn {
+	return r.conn
+}
+
+// Session returns the session of the connection the request arrived on
+// Handlers keep per-connection state in Session().Values():
+//
+//	term, _ := req.Session().Values().Get("terminal").(*Terminal)
+//
+// Returns nil when the request was not received through JsonRpcSimpleService.NewConn
+func (r *Request) Session() *Session {
+	return r.sess
+}
+
 // Method returns the RPC method name being called
 // This is a convenience method that delegates to the underlying request
 func (r *Request) Method() string {
 	return r.req.Method
 }
 
+// Meta decodes the optional JSON-RPC "meta" member into a map
+// Clients use it to carry out-of-band values such as the caller identity or trace IDs
+// Returns an empty map when the request has no meta or it is not a JSON object
+func (r *Request) Meta() map[string]any {
+	meta := make(map[string]any)
+	if r.req == nil || r.req.Meta == nil {
+		return meta
+	}
+	if err := json.Unmarshal(*r.req.Meta, &meta); err != nil {
+		return make(map[string]any)
+	}
+	return meta
+}
+
+// MetaString returns a single meta value formatted as a string
+// Returns an empty string if the key is absent
+func (r *Request) MetaString(key string) string {
+	val, ok := r.Meta()[key]
+	if !ok || val == nil {
+		return ""
+	}
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return fmt.Sprint(val)
+}
+
+// DecodeParams unmarshals the request params into out
+// Missing or null params yield CodeMissingParameter, malformed ones CodeInvalidParameter
+func (r *Request) DecodeParams(out any) error {
+	if r.req == nil || r.req.Params == nil || string(*r.req.Params) == "null" {
+		return gerror.CodeMissingParameter
+	}
+	if err := json.Unmarshal(*r.req.Params, out); err != nil {
+		return gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+	}
+	return nil
+}
+
+// DecodeOptionalParams unmarshals the request params into out, leaving it untouched
+// when there are none; malformed params yield CodeInvalidParameter
+func (r *Request) DecodeOptionalParams(out any) error {
+	if r.req == nil || r.req.Params == nil || string(*r.req.Params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(*r.req.Params, out); err != nil {
+		return gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+	}
+	return nil
+}
+
 // Context returns the request's context
 // The context carries deadlines, cancellation signals, and other request-scoped values
 func (r *Request) Context() context.Context {
@@ -49,6 +127,20 @@ func WithRequestReqOption(req *jsonrpc2.Request) RequestOptFunc {
 	}
 }
 
+// WithRequestConnOption creates a RequestOptFunc that sets the connection the request arrived on
+func WithRequestConnOption(conn *jsonrpc2.Conn) RequestOptFunc {
+	return func(r *Request) {
+		r.conn = conn
+	}
+}
+
+// WithRequestSessionOption creates a RequestOptFunc that sets the session of the connection
+func WithRequestSessionOption(session *Session) RequestOptFunc {
+	return func(r *Request) {
+		r.sess = session
+	}
+}
+
 // MakeRequest constructs a new Request instance with the provided options
 // This follows the functional options pattern for flexible request creation
 //
@@ -1,11 +1,18 @@
 package gsock
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
 
 // Meta contains WebSocket metadata for message handling
 type Meta struct {
-	Endpoint string `json:"endpoint"` // The API endpoint/path this response corresponds to
-	Close    int    `json:"close"`    // Flag indicating if connection should close (0=keep open, 1=close)
+	Endpoint string `json:"endpoint"`          // The API endpoint/path this response corresponds to
+	Close    int    `json:"close"`             // Flag indicating if connection should close (0=keep open, 1=close)
+	Warning  string `json:"warning,omitempty"` // Set for calls of deprecated methods
 }
 
 // Response represents a standardized WebSocket response format
@@ -67,3 +74,30 @@ func (r *Response) WithData(data any, endpoint string) *Response {
 	r.SetEndpoint(endpoint)
 	return r
 }
+
+// WithResult fills the response from a handler's return values
+// The data is kept even on error; a non-nil error becomes a 400 response carrying its message
+func (r *Response) WithResult(data any, err error) *Response {
+	r.Data = data
+	if err != nil {
+		r.Code = http.StatusBadRequest
+		r.Message = err.Error()
+	}
+	return r
+}
+
+// Exception returns the error carried by a non-success response, nil for 200 responses
+// Messages formatted by gerror ("code:message") keep their code, others use the response code;
+// the data becomes the detail
+func (r *Response) Exception() gerror.Exception {
+	if r.Code == http.StatusOK {
+		return nil
+	}
+	code, message := r.Code, r.Message
+	if prefix, rest, ok := strings.Cut(r.Message, ":"); ok {
+		if n, err := strconv.Atoi(prefix); err == nil {
+			code, message = n, rest
+		}
+	}
+	return gerror.New(code, message, r.Data)
+}
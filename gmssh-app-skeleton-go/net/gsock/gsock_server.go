@@ -1,15 +1,5 @@
 package gsock
 
-import (
-	"context"
-	"fmt"
-	"log"
-	"net"
-	"os"
-	"os/signal"
-	"syscall"
-)
-
 // RpcServerOptFunc defines functions for configuring an RPC server
 type RpcServerOptFunc func(*rpcServer)
 
@@ -39,60 +29,40 @@ func (r *rpcServer) RegisterHandle(api string, hand func(req *Request) (any, err
 	r.service.RegisterHandle(api, hand, middlewares...)
 }
 
-// StartServer begins listening for RPC connections on a Unix domain socket
-// It handles graceful shutdown on interrupt signals and cleans up the socket file
-func (s *rpcServer) StartServer(socketPath string) error {
-	// Clean up any existing socket file
-	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove existing socket: %w", err)
+// OnConnect adds a connection hook to the service; ignored if the service does not track sessions
+func (r *rpcServer) OnConnect(hook SessionHook) {
+	if hooks, ok := r.service.(ISessionHooks); ok {
+		hooks.OnConnect(hook)
 	}
+}
 
-	// Create Unix domain socket listener
-	listener, err := net.Listen("unix", socketPath)
-	if err != nil {
-		return fmt.Errorf("failed to listen on Unix socket: %w", err)
+// OnDisconnect adds a disconnection hook to the service; ignored if the service does not track sessions
+func (r *rpcServer) OnDisconnect(hook SessionHook) {
+	if hooks, ok := r.service.(ISessionHooks); ok {
+		hooks.OnDisconnect(hook)
 	}
+}
 
-	// Set up signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	ctx, cancel := context.WithCancel(context.Background())
-
-	// Goroutine for handling shutdown signals
-	go func() {
-		<-sigChan
-		log.Println("[*] Received shutdown signal, cleaning up...")
-
-		// Clean up resources
-		os.Remove(socketPath)
-		listener.Close()
-		cancel()
-	}()
-
-	log.Printf("JSON-RPC server listening on Unix socket: %s\n", socketPath)
-
-	// Main connection acceptance loop
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			// Check if error is due to shutdown
-			select {
-			case <-ctx.Done():
-				return nil // Graceful shutdown
-			default:
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					continue // Temporary error, keep listening
-				}
-				return fmt.Errorf("connection accept error: %w", err)
-			}
-		}
+// Maintenance returns the maintenance switch of the service, nil if it has none
+func (r *rpcServer) Maintenance() *Maintenance {
+	if m, ok := r.service.(IMaintenance); ok {
+		return m.Maintenance()
+	}
+	return nil
+}
 
-		// Handle each connection in a separate goroutine
-		go func(conn net.Conn) {
-			// defer conn.Close()
-			s.service.NewConn(ctx, conn)
-		}(conn)
+// DeprecatedCalls returns the deprecated method counters of the service, nil if it has none
+func (r *rpcServer) DeprecatedCalls() []DeprecatedCall {
+	if d, ok := r.service.(IDeprecatedCalls); ok {
+		return d.DeprecatedCalls()
 	}
+	return nil
+}
+
+// StartServer begins listening for RPC connections on a Unix domain socket
+// It handles graceful shutdown on interrupt signals, closing open connections, and cleans up the socket file
+func (s *rpcServer) StartServer(socketPath string) error {
+	return NewListenerGroup(Listener{SocketPath: socketPath, Service: s.service}).Start()
 }
 
 // SetSocketPermissions sets file permissions for the Unix socket
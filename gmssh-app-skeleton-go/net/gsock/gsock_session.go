@@ -0,0 +1,198 @@
+package gsock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/container/gmap"
+)
+
+// SessionHook is called when a connection opens or closes
+type SessionHook func(s *Session)
+
+// PeerCred holds the credentials of the process on the other end of a Unix socket
+type PeerCred struct {
+	PID int32  // Process ID
+	UID uint32 // User ID
+	GID uint32 // Group ID
+}
+
+// Session is the server side state of one connection
+// Terminal-like apps keep per-connection state in Values; it is dropped with the session
+type Session struct {
+	id          string
+	netConn     net.Conn
+	conn        *jsonrpc2.Conn
+	connectedAt time.Time
+	values      *gmap.StrAnyMap
+	ready       chan struct{} // Closed once the connect hooks have run
+	inflight    atomic.Int64  // Calls being handled, which keep the connection from idling out
+}
+
+// newSession creates the session of a new connection
+func newSession(netConn net.Conn) *Session {
+	return &Session{
+		id:          newSessionID(),
+		netConn:     netConn,
+		connectedAt: time.Now(),
+		values:      gmap.NewStrAnyMap(),
+		ready:       make(chan struct{}),
+	}
+}
+
+// ID returns the random identifier of the session
+func (s *Session) ID() string {
+	return s.id
+}
+
+// RemoteAddr returns the address of the peer
+func (s *Session) RemoteAddr() net.Addr {
+	return s.netConn.RemoteAddr()
+}
+
+// LocalAddr returns the address the connection was accepted on
+func (s *Session) LocalAddr() net.Addr {
+	return s.netConn.LocalAddr()
+}
+
+// PeerCred returns the credentials of the peer process
+// It is only available for Unix sockets on Linux
+func (s *Session) PeerCred() (*PeerCred, error) {
+	return peerCred(s.netConn)
+}
+
+// ConnectedAt returns the time the connection was accepted
+func (s *Session) ConnectedAt() time.Time {
+	return s.connectedAt
+}
+
+// Values returns the key-value store of the session, safe for concurrent use
+func (s *Session) Values() *gmap.StrAnyMap {
+	return s.values
+}
+
+// Conn returns the JSON-RPC connection, for notifying or calling the peer
+func (s *Session) Conn() *jsonrpc2.Conn {
+	return s.conn
+}
+
+// NetConn returns the underlying network connection
+// Writes to it bypass the JSON-RPC framing; it is meant for fault injection and diagnostics
+func (s *Session) NetConn() net.Conn {
+	return s.netConn
+}
+
+// Done returns a channel closed when the connection is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.conn.DisconnectNotify()
+}
+
+// Close closes the connection from the server side; the disconnect hooks run as usual
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// sessionKey keys the session in the context of its connection
+type sessionKey struct{}
+
+// SessionFromContext returns the session stored in ctx by the service, nil if none
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// sessionRegistry tracks the open sessions of a service and runs its hooks
+type sessionRegistry struct {
+	mu           sync.RWMutex
+	open         map[string]*Session
+	onConnect    []SessionHook
+	onDisconnect []SessionHook
+}
+
+// OnConnect adds a connect hook
+func (r *sessionRegistry) OnConnect(hook SessionHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onConnect = append(r.onConnect, hook)
+}
+
+// OnDisconnect adds a disconnect hook
+func (r *sessionRegistry) OnDisconnect(hook SessionHook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onDisconnect = append(r.onDisconnect, hook)
+}
+
+// Sessions returns the open sessions, oldest first
+func (r *sessionRegistry) Sessions() []*Session {
+	r.mu.RLock()
+	list := make([]*Session, 0, len(r.open))
+	for _, s := range r.open {
+		list = append(list, s)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].connectedAt.Before(list[j].connectedAt)
+	})
+	return list
+}
+
+// Session returns the open session with the given ID
+func (r *sessionRegistry) Session(id string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.open[id]
+	return s, ok
+}
+
+// start registers the session of a new connection and runs the connect hooks
+// The disconnect hooks run once the connection closes
+func (r *sessionRegistry) start(s *Session, conn *jsonrpc2.Conn) {
+	s.conn = conn
+
+	r.mu.Lock()
+	if r.open == nil {
+		r.open = make(map[string]*Session)
+	}
+	r.open[s.id] = s
+	onConnect := append([]SessionHook(nil), r.onConnect...)
+	r.mu.Unlock()
+
+	for _, hook := range onConnect {
+		hook(s)
+	}
+	close(s.ready)
+
+	go func() {
+		<-conn.DisconnectNotify()
+
+		r.mu.Lock()
+		delete(r.open, s.id)
+		onDisconnect := append([]SessionHook(nil), r.onDisconnect...)
+		r.mu.Unlock()
+
+		for _, hook := range onDisconnect {
+			hook(s)
+		}
+	}()
+}
+
+// newSessionID returns a random session identifier
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the clock
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,33 @@
+package gsock
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerCred reads SO_PEERCRED of a Unix socket connection
+func peerCred(conn net.Conn) (*PeerCred, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("peer credentials need a Unix socket, got %T", conn)
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return &PeerCred{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package gsock
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCred is only implemented on Linux
+func peerCred(conn net.Conn) (*PeerCred, error) {
+	return nil, errors.New("peer credentials are not supported on this platform")
+}
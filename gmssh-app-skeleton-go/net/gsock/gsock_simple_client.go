@@ -2,7 +2,9 @@ package gsock
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"sync"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -36,37 +38,159 @@ func (c *JsonRpcSimpleClientHandler) Request(
 	return c.conn.Call(ctx, method, params, result, opts...)
 }
 
+// Notify sends a JSON-RPC 2.0 notification, which the server does not answer
+func (c *JsonRpcSimpleClientHandler) Notify(
+	ctx context.Context,
+	method string,
+	params any,
+	opts ...jsonrpc2.CallOption,
+) error {
+	return c.conn.Notify(ctx, method, params, opts...)
+}
+
+// Close provides clean connection shutdown
+func (c *JsonRpcSimpleClientHandler) Close() error {
+	return c.conn.Close()
+}
+
+// DisconnectNotify returns a channel that is closed when the connection goes away
+func (c *JsonRpcSimpleClientHandler) DisconnectNotify() <-chan struct{} {
+	return c.conn.DisconnectNotify()
+}
+
 // JsonRpcSimpleClient implements ClientAdapter for creating JSON-RPC 2.0 clients
-type JsonRpcSimpleClient struct{}
+// It also keeps a registry of handlers for calls and notifications initiated by the server
+// The zero value is ready to use
+type JsonRpcSimpleClient struct {
+	mu          sync.RWMutex         // Protects handlers
+	handlers    RpcServiceDispatcher // Handlers for server-initiated methods
+	fallback    HandlerFunc          // Handles server-initiated methods without a handler (nil = not found)
+	compression *Compression         // Payload compression requested from the server (nil = disabled)
+	formats     []string             // Payload formats offered to the server, preferred first (nil = JSON only)
+	async       bool                 // Handle server-initiated requests concurrently
+}
+
+// JsonRpcSimpleClientOptFunc defines functions for configuring a JsonRpcSimpleClient
+type JsonRpcSimpleClientOptFunc func(*JsonRpcSimpleClient)
+
+// WithJsonRpcSimpleClientCompression makes every new connection negotiate payload compression
+// with an rpc.handshake call; servers without support are used uncompressed
+func WithJsonRpcSimpleClientCompression(compression *Compression) JsonRpcSimpleClientOptFunc {
+	return func(c *JsonRpcSimpleClient) {
+		c.compression = compression
+	}
+}
+
+// WithJsonRpcSimpleClientFormats makes every new connection negotiate the payload format
+// with an rpc.handshake call, e.g. FormatMsgpack to receive []byte data as binary;
+// servers without support are used with JSON
+func WithJsonRpcSimpleClientFormats(formats ...string) JsonRpcSimpleClientOptFunc {
+	return func(c *JsonRpcSimpleClient) {
+		c.formats = formats
+	}
+}
+
+// WithJsonRpcSimpleClientFallback sets the handler for server-initiated calls and notifications
+// whose method has no registered handler, e.g. to log every notification
+func WithJsonRpcSimpleClientFallback(hand HandlerFunc) JsonRpcSimpleClientOptFunc {
+	return func(c *JsonRpcSimpleClient) {
+		c.fallback = hand
+	}
+}
+
+// WithJsonRpcSimpleClientAsync handles the calls and notifications initiated by the server
+// concurrently instead of one after the other, so a handler may itself call the server and wait
+// for the answer; they may then run in a different order than they were sent
+func WithJsonRpcSimpleClientAsync() JsonRpcSimpleClientOptFunc {
+	return func(c *JsonRpcSimpleClient) {
+		c.async = true
+	}
+}
+
+// NewJsonRpcSimpleClient creates a client adapter with an empty handler registry
+func NewJsonRpcSimpleClient(opts ...JsonRpcSimpleClientOptFunc) *JsonRpcSimpleClient {
+	client := &JsonRpcSimpleClient{
+		handlers: make(RpcServiceDispatcher),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
+}
+
+// RegisterHandle binds a handler for a method the server may call or notify on client connections
+// Route middlewares implementing RPCHandlerWrapper wrap the handler as on the server side
+// WithMethodVersionOption names the method as on the server side; deprecation is not tracked on clients
+// Implements the IRpcHandler interface
+func (r *JsonRpcSimpleClient) RegisterHandle(
+	api string,
+	hand func(req *Request) (any, error),
+	middlewares ...RPCMiddleware,
+) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.handlers == nil {
+		r.handlers = make(RpcServiceDispatcher)
+	}
+	reg := registration(api, middlewares)
+	r.handlers[reg.name] = wrapHandler(reg.name, hand, reg.middlewares)
+	if _, ok := r.handlers[reg.alias]; reg.alias != "" && !ok {
+		r.handlers[reg.alias] = r.handlers[reg.name]
+	}
+}
 
 // NewConn establishes a new JSON-RPC 2.0 client connection
 // Implements the ClientAdapter interface
 func (r *JsonRpcSimpleClient) NewConn(ctx context.Context, conn net.Conn) IRpcClient {
 	// Create buffered connection with VSCode-style message codec
-	jsonConn := jsonrpc2.NewConn(
-		ctx,
-		jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{}),
-		jsonrpc2.HandlerWithError(r.Handle), // Empty handler for client connections
-	)
+	// Server-initiated requests are handled in order unless async handling is enabled
+	var handler jsonrpc2.Handler = jsonrpc2.HandlerWithError(r.Handle)
+	if r.async {
+		handler = jsonrpc2.AsyncHandler(handler)
+	}
+	if r.compression == nil && len(r.formats) == 0 {
+		jsonConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{}), handler)
+		return NewJsonRpcSimpleClientHandler(jsonConn)
+	}
+
+	// The negotiated codec is VSCode-compatible until the handshake succeeds
+	threshold := DefaultCompressThreshold
+	if r.compression != nil {
+		threshold = r.compression.Threshold
+	}
+	codec := newNegotiatedCodec(threshold, &frameReader{limits: &Limits{}})
+	jsonConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(conn, codec), handler)
+	handshake(ctx, jsonConn, r.compression, r.formats, codec)
 	return NewJsonRpcSimpleClientHandler(jsonConn)
 }
 
-// Handle is a placeholder for client-side request handling
-// For pure clients, this typically won't be used as clients make requests rather than handle them
+// Handle dispatches a call or notification initiated by the server to the registered handler
+// Unknown methods go to the fallback handler, or are answered with a JSON-RPC "method not found" error
 func (r *JsonRpcSimpleClient) Handle(
 	ctx context.Context,
 	conn *jsonrpc2.Conn,
 	req *jsonrpc2.Request,
 ) (any, error) {
-	// Client connections don't typically handle incoming requests
-	// This would be used if implementing bidirectional RPC
-	return nil, nil
-}
+	r.mu.RLock()
+	handler, ok := r.handlers[req.Method]
+	r.mu.RUnlock()
+	if !ok && r.fallback != nil {
+		handler, ok = r.fallback, true
+	}
+	if !ok {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeMethodNotFound,
+			Message: fmt.Sprintf("method not found: %s", req.Method),
+		}
+	}
 
-// Close provides clean connection shutdown
-// func (c *JsonRpcSimpleClientHandler) Close() error {
-//     return c.conn.Close()
-// }
+	return handler(MakeRequest(
+		WithRequestCtxOption(ctx),
+		WithRequestReqOption(req),
+		WithRequestConnOption(conn),
+	))
+}
 
 // Notification sends a JSON-RPC notification (request without response)
 // func (c *JsonRpcSimpleClientHandler) Notification(
@@ -6,25 +6,55 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 
 	"github.com/sourcegraph/jsonrpc2"
 
 	"github.com/DemonZack/simplejrpc-go/container/garray"
 )
 
+// MethodMethods lists the registered methods; it is answered by handlers created with
+// WithJsonRpcSimpleServiceHandlerMethods, unless an application registers its own handler
+// under this name, and answers 404 otherwise
+const MethodMethods = "rpc.methods"
+
+// JsonRpcSimpleServiceHandlerOptionFunc defines the signature for handler configuration functions.
+type JsonRpcSimpleServiceHandlerOptionFunc func(*JsonRpcSimpleServiceHandler)
+
+// WithJsonRpcSimpleServiceHandlerMethods answers rpc.methods with the registered methods,
+// for peers passing authorize; a nil authorize lists them to every peer.
+// The listing is off by default, as it reveals admin and debug methods.
+func WithJsonRpcSimpleServiceHandlerMethods(authorize Authorizer) JsonRpcSimpleServiceHandlerOptionFunc {
+	return func(h *JsonRpcSimpleServiceHandler) {
+		h.listMethods = true
+		h.listAuthorize = authorize
+	}
+}
+
 // JsonRpcSimpleServiceHandler implements IRpcServiceHandle for processing JSON-RPC 2.0 requests.
 // It maintains a registry of method handlers and a middleware chain for request processing.
 type JsonRpcSimpleServiceHandler struct {
-	handlers    RpcServiceDispatcher // Map of API method names to their handler functions
-	middlewares []RPCMiddleware      // Chain of middleware processors for request/response handling
+	handlers      RpcServiceDispatcher // Map of API method names to their handler functions
+	middlewares   []RPCMiddleware      // Chain of middleware processors for request/response handling
+	maintenance   *Maintenance         // Methods turned off at runtime
+	deprecated    deprecatedMethods    // Deprecated methods and their call counters
+	listMethods   bool                 // Answer rpc.methods with the registered methods
+	listAuthorize Authorizer           // Peers allowed to list the methods, nil for all
 }
 
 // NewJsonRpcSimpleServiceHandler creates and initializes a new JsonRpcSimpleServiceHandler instance.
+// opts: Handler configuration options
 // Returns: Pointer to the newly created handler instance
-func NewJsonRpcSimpleServiceHandler() *JsonRpcSimpleServiceHandler {
-	return &JsonRpcSimpleServiceHandler{
-		handlers: make(RpcServiceDispatcher),
+func NewJsonRpcSimpleServiceHandler(opts ...JsonRpcSimpleServiceHandlerOptionFunc) *JsonRpcSimpleServiceHandler {
+	h := &JsonRpcSimpleServiceHandler{
+		handlers:    make(RpcServiceDispatcher),
+		maintenance: NewMaintenance(),
+		deprecated:  make(deprecatedMethods),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // multiply is an example handler method that demonstrates parameter parsing and processing.
@@ -51,16 +81,58 @@ func (h *JsonRpcSimpleServiceHandler) registerServer(req *Request) (any, error)
 // RegisterHandle adds a new method handler to the service's handler registry.
 // api: The method name to register
 // hand: The handler function to execute for this method
-// middlewares: Optional middleware specific to this handler
+// middlewares: Optional middleware specific to this handler, and MethodOptions versioning
+// or deprecating the method
 func (h *JsonRpcSimpleServiceHandler) RegisterHandle(
 	api string,
 	hand func(req *Request) (any, error),
 	middlewares ...RPCMiddleware,
 ) {
-	if len(middlewares) > 0 {
-		h.middlewares = append(h.middlewares, middlewares...)
+	reg := registration(api, middlewares)
+	if len(reg.middlewares) > 0 {
+		h.middlewares = append(h.middlewares, reg.middlewares...)
+	}
+	h.handlers[reg.name] = wrapHandler(reg.name, hand, reg.middlewares)
+	h.deprecated.add(reg.name, reg.deprecation)
+
+	// The first version also answers the unversioned name
+	if _, ok := h.handlers[reg.alias]; reg.alias != "" && !ok {
+		h.handlers[reg.alias] = h.handlers[reg.name]
+		h.deprecated.add(reg.alias, reg.deprecation)
 	}
-	h.handlers[api] = hand
+}
+
+// wrapHandler decorates a handler with every middleware implementing RPCHandlerWrapper.
+// The first middleware becomes the outermost wrapper, matching registration order.
+func wrapHandler(api string, hand HandlerFunc, middlewares []RPCMiddleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if wrapper, ok := middlewares[i].(RPCHandlerWrapper); ok {
+			hand = wrapper.WrapHandler(api, hand)
+		}
+	}
+	return hand
+}
+
+// Methods returns the registered method names in sorted order.
+func (h *JsonRpcSimpleServiceHandler) Methods() []string {
+	methods := make([]string, 0, len(h.handlers))
+	for method := range h.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Maintenance returns the switch turning methods, or the whole app, off at runtime.
+// Returns: The handler's maintenance switch
+func (h *JsonRpcSimpleServiceHandler) Maintenance() *Maintenance {
+	return h.maintenance
+}
+
+// DeprecatedCalls returns the call counters of the deprecated methods, sorted by method.
+// Returns: Snapshot of the counters, including deprecated methods never called
+func (h *JsonRpcSimpleServiceHandler) DeprecatedCalls() []DeprecatedCall {
+	return h.deprecated.snapshot()
 }
 
 // Ping implements a simple health check endpoint.
@@ -101,22 +173,57 @@ func (h *JsonRpcSimpleServiceHandler) Handle(req *Request) (any, error) {
 	method := req.Method()
 	response.SetEndpoint(method)
 
+	// Refused methods answer with the exception and the notice, keeping the retry hint machine readable
+	if notice := h.maintenance.Check(method); notice != nil {
+		return response.WithResult(notice, notice.Exception()), nil
+	}
+
 	handler, ok := h.handlers[method]
+	if !ok && method == MethodMethods {
+		return answerMethods(req, response, h, h.Methods), nil
+	}
 	if !ok {
-		response.Code = http.StatusNotFound
-		response.Message = http.StatusText(http.StatusNotFound)
-		return response, nil
+		return notFound(response), nil
 	}
 
-	body, err := handler(req)
-	response.Data = body
-	if err != nil {
-		response.Code = http.StatusBadRequest
-		response.Message = err.Error()
+	response.WithResult(handler(req))
+	if deprecated, ok := h.deprecated[method]; ok {
+		deprecated.called()
+		response.Meta.Warning = deprecated.warning
 	}
 	return response, nil
 }
 
+// methodsAllowed reports whether the rpc.methods listing is on, and if so whether req may see it
+func (h *JsonRpcSimpleServiceHandler) methodsAllowed(req *Request) (bool, error) {
+	if !h.listMethods {
+		return false, nil
+	}
+	if h.listAuthorize == nil {
+		return true, nil
+	}
+	return true, h.listAuthorize(req)
+}
+
+// answerMethods answers rpc.methods with list, if lister has the listing on and allows req
+func answerMethods(req *Request, response *Response, lister methodLister, list func() []string) *Response {
+	enabled, err := lister.methodsAllowed(req)
+	switch {
+	case !enabled:
+		return notFound(response)
+	case err != nil:
+		return response.WithResult(nil, err)
+	}
+	return response.WithSuccess(list())
+}
+
+// notFound answers a call of an unknown method
+func notFound(response *Response) *Response {
+	response.Code = http.StatusNotFound
+	response.Message = http.StatusText(http.StatusNotFound)
+	return response
+}
+
 // JsonRpcSimpleServiceOptionFunc defines the signature for service configuration functions.
 type JsonRpcSimpleServiceOptionFunc func(*JsonRpcSimpleService)
 
@@ -124,6 +231,12 @@ type JsonRpcSimpleServiceOptionFunc func(*JsonRpcSimpleService)
 type JsonRpcSimpleService struct {
 	handler     IRpcServiceHandle // Core request handler implementation
 	middlewares []RPCMiddleware   // Service-level middleware chain
+	compression *Compression      // Payload compression offered to clients (nil = disabled)
+	formats     []string          // Payload formats offered to clients, preferred first (nil = JSON only)
+	limits      *Limits           // Bounds on what peers may send (nil = NewLimits)
+	async       bool              // Handle the requests of a connection concurrently
+	sessions    sessionRegistry   // Open connections and their lifecycle hooks
+	malformed   malformedFrames   // Malformed frames received, by peer
 }
 
 // NewDefaultJsonRpcSimpleService creates a service instance with default configuration.
@@ -154,6 +267,53 @@ func WithJsonRpcSimpleServiceMiddlewares(middlewares ...RPCMiddleware) JsonRpcSi
 	}
 }
 
+// WithJsonRpcSimpleServiceCompression creates a configuration function that lets clients
+// negotiate payload compression through rpc.handshake.
+// Clients that skip the handshake keep receiving uncompressed messages.
+// compression: Accepted encodings and size threshold, see NewCompression
+// Returns: Configuration function
+func WithJsonRpcSimpleServiceCompression(compression *Compression) JsonRpcSimpleServiceOptionFunc {
+	return func(s *JsonRpcSimpleService) {
+		s.compression = compression
+	}
+}
+
+// WithJsonRpcSimpleServiceFormats creates a configuration function that lets clients
+// negotiate the payload format through rpc.handshake, e.g. FormatMsgpack so []byte
+// results are sent as binary rather than base64 strings.
+// Handlers keep receiving params and returning results as before; clients that skip
+// the handshake or offer no common format keep receiving JSON.
+// formats: Accepted formats, preferred first
+// Returns: Configuration function
+func WithJsonRpcSimpleServiceFormats(formats ...string) JsonRpcSimpleServiceOptionFunc {
+	return func(s *JsonRpcSimpleService) {
+		s.formats = formats
+	}
+}
+
+// WithJsonRpcSimpleServiceLimits creates a configuration function bounding the frame, params
+// and batch sizes peers may send and the time a connection may stay idle.
+// Without it only the frame size is bounded, to DefaultMaxFrameSize.
+// limits: Limits to enforce on every connection, see NewLimits and LoadLimitsConfig
+// Returns: Configuration function
+func WithJsonRpcSimpleServiceLimits(limits *Limits) JsonRpcSimpleServiceOptionFunc {
+	return func(s *JsonRpcSimpleService) {
+		s.limits = limits
+	}
+}
+
+// WithJsonRpcSimpleServiceAsync creates a configuration function that handles the requests of
+// a connection concurrently instead of one after the other.
+// Handlers calling back into the peer through Request.Conn() and waiting for the answer need
+// it, as the connection's reader is otherwise busy with their own request. Responses may then
+// arrive in a different order than the requests.
+// Returns: Configuration function
+func WithJsonRpcSimpleServiceAsync() JsonRpcSimpleServiceOptionFunc {
+	return func(s *JsonRpcSimpleService) {
+		s.async = true
+	}
+}
+
 // NewJsonRpcSimpleService creates a new service instance with custom configuration.
 // opts: Optional configuration functions
 // Returns: Configured service instance
@@ -166,15 +326,120 @@ func NewJsonRpcSimpleService(opts ...JsonRpcSimpleServiceOptionFunc) *JsonRpcSim
 }
 
 // NewConn creates a new JSON-RPC 2.0 connection with context and codec support.
+// Requests are handled one after the other, or concurrently with WithJsonRpcSimpleServiceAsync.
+// Each connection gets a Session; its requests are handled once the OnConnect hooks have run.
+// Incoming frames are read within the service's Limits.
+// With formats configured, results are encoded by the codec directly so binary data stays binary.
 // ctx: Context for the connection
 // conn: Underlying network connection
 // Returns: New JSON-RPC 2.0 connection
 func (r *JsonRpcSimpleService) NewConn(ctx context.Context, conn net.Conn) *jsonrpc2.Conn {
-	return jsonrpc2.NewConn(
-		ctx,
-		jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{}),
-		jsonrpc2.HandlerWithError(r.Handle),
+	session := newSession(conn)
+	ctx = context.WithValue(ctx, sessionKey{}, session)
+
+	limits := r.limits
+	if limits == nil {
+		limits = NewLimits()
+	}
+	frames := &frameReader{limits: limits, session: session, malformed: &r.malformed}
+
+	var (
+		codec      jsonrpc2.ObjectCodec = &frameCodec{frames: frames}
+		negotiated *negotiatedCodec
 	)
+	handle := r.Handle
+	if r.compression != nil || len(r.formats) > 0 {
+		// Each connection negotiates its own encoding and format, so the codec is per connection
+		threshold := DefaultCompressThreshold
+		if r.compression != nil {
+			threshold = r.compression.Threshold
+		}
+		negotiated = newNegotiatedCodec(threshold, frames)
+		codec = negotiated
+		handle = func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			if req.Method == MethodHandshake {
+				return acceptHandshake(r.compression, r.formats, negotiated, req)
+			}
+			return r.Handle(ctx, conn, req)
+		}
+	}
+
+	stream := jsonrpc2.NewBufferedStream(conn, codec)
+	frames.stream = stream
+	tracked := func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+		session.inflight.Add(1)
+		defer session.inflight.Add(-1)
+		<-session.ready
+		return handle(ctx, conn, req)
+	}
+	var handler jsonrpc2.Handler = jsonrpc2.HandlerWithError(tracked)
+	if len(r.formats) > 0 {
+		handler = &formatHandler{handle: tracked, codec: negotiated, stream: stream}
+	}
+	if r.async {
+		handler = jsonrpc2.AsyncHandler(handler)
+	}
+	jsonConn := jsonrpc2.NewConn(ctx, stream, handler)
+	r.sessions.start(session, jsonConn)
+	return jsonConn
+}
+
+// Handler returns the handler the service dispatches to, e.g. to share its registry with
+// services on other sockets.
+// Returns: The service's handler
+func (r *JsonRpcSimpleService) Handler() IRpcServiceHandle {
+	return r.handler
+}
+
+// OnConnect adds a hook run for every new connection, before its first request is handled.
+// Hooks run in the order they were added and may store state in Session.Values().
+// hook: Function receiving the new session
+func (r *JsonRpcSimpleService) OnConnect(hook SessionHook) {
+	r.sessions.OnConnect(hook)
+}
+
+// OnDisconnect adds a hook run once a connection is closed, by the peer or through Session.Close.
+// hook: Function receiving the closed session
+func (r *JsonRpcSimpleService) OnDisconnect(hook SessionHook) {
+	r.sessions.OnDisconnect(hook)
+}
+
+// Sessions returns the open sessions, oldest first.
+// Returns: Snapshot of the open sessions
+func (r *JsonRpcSimpleService) Sessions() []*Session {
+	return r.sessions.Sessions()
+}
+
+// Session looks up an open session by ID, e.g. to close it from the server side.
+// id: Session ID
+// Returns: The session and whether it is open
+func (r *JsonRpcSimpleService) Session(id string) (*Session, bool) {
+	return r.sessions.Session(id)
+}
+
+// Maintenance returns the maintenance switch of the handler, nil if it has none.
+// Returns: The handler's maintenance switch
+func (r *JsonRpcSimpleService) Maintenance() *Maintenance {
+	if m, ok := LookupHandle[IMaintenance](r.handler); ok {
+		return m.Maintenance()
+	}
+	return nil
+}
+
+// DeprecatedCalls returns the call counters of the handler's deprecated methods, nil if it has none.
+// Returns: Snapshot of the counters
+func (r *JsonRpcSimpleService) DeprecatedCalls() []DeprecatedCall {
+	if d, ok := LookupHandle[IDeprecatedCalls](r.handler); ok {
+		return d.DeprecatedCalls()
+	}
+	return nil
+}
+
+// MalformedFrames returns the number of malformed or oversized frames received, by peer.
+// Peers are identified by process ID and user ID where the socket carries credentials.
+// Returns: Snapshot of the counters
+func (r *JsonRpcSimpleService) MalformedFrames() map[string]uint64 {
+	return r.malformed.snapshot()
 }
 
 // ProcessRequest executes the service-level request middleware chain.
@@ -226,6 +491,8 @@ func (r *JsonRpcSimpleService) Handle(
 	request := MakeRequest(
 		WithRequestCtxOption(ctx),
 		WithRequestReqOption(req),
+		WithRequestConnOption(conn),
+		WithRequestSessionOption(SessionFromContext(ctx)),
 	)
 	r.ProcessRequest(request)
 
@@ -0,0 +1,678 @@
+package gsock
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+func TestBidirectionalCallback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The handler waits for the client's answer, so the connection's reader must stay free
+	service := NewJsonRpcSimpleService(
+		WithJsonRpcSimpleServiceHandler(NewJsonRpcSimpleServiceHandler()),
+		WithJsonRpcSimpleServiceAsync(),
+	)
+	service.RegisterHandle("file.delete", func(req *Request) (any, error) {
+		if err := req.Conn().Notify(req.Context(), "job.progress", 50); err != nil {
+			return nil, err
+		}
+		var confirmed bool
+		if err := req.Conn().Call(req.Context(), "ui.confirm", "delete /tmp/x?", &confirmed); err != nil {
+			return nil, err
+		}
+		return confirmed, nil
+	})
+
+	serverSide, clientSide := net.Pipe()
+	serverConn := service.NewConn(ctx, serverSide)
+	defer serverConn.Close()
+
+	progress := make(chan any, 1)
+	adapter := NewJsonRpcSimpleClient()
+	adapter.RegisterHandle("job.progress", func(req *Request) (any, error) {
+		progress <- string(*req.RawRequest().Params)
+		return nil, nil
+	})
+	adapter.RegisterHandle("ui.confirm", func(req *Request) (any, error) {
+		return true, nil
+	})
+
+	var resp Response
+	if err := adapter.NewConn(ctx, clientSide).Request(ctx, "file.delete", nil, &resp); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.Data != true {
+		t.Fatalf("expected confirmation to be returned, got %#v", resp)
+	}
+
+	select {
+	case p := <-progress:
+		if p != "50" {
+			t.Fatalf("unexpected progress %v", p)
+		}
+	case <-ctx.Done():
+		t.Fatal("progress notification not received")
+	}
+}
+
+func TestNegotiatedCompression(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	listing := strings.Repeat("/var/log/app/entry.log\n", 4096)
+	newService := func(compression *Compression) *JsonRpcSimpleService {
+		handler := NewJsonRpcSimpleServiceHandler()
+		handler.RegisterHandle("file.list", func(req *Request) (any, error) {
+			return listing, nil
+		})
+		opts := []JsonRpcSimpleServiceOptionFunc{WithJsonRpcSimpleServiceHandler(handler)}
+		if compression != nil {
+			opts = append(opts, WithJsonRpcSimpleServiceCompression(compression))
+		}
+		return NewJsonRpcSimpleService(opts...)
+	}
+
+	cases := []struct {
+		name       string
+		server     *Compression
+		client     *Compression
+		compressed bool
+	}{
+		{"zstd", NewCompression(1024), NewCompression(1024), true},
+		{"gzip", NewCompression(1024, EncodingGzip), NewCompression(1024, EncodingZstd, EncodingGzip), true},
+		{"plain client", NewCompression(1024), nil, false},
+		{"plain server", nil, NewCompression(1024), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			serverSide, clientSide := net.Pipe()
+			counter := &countingConn{Conn: serverSide}
+			serverConn := newService(c.server).NewConn(ctx, counter)
+			defer serverConn.Close()
+
+			var resp Response
+			client := NewJsonRpcSimpleClient(WithJsonRpcSimpleClientCompression(c.client))
+			if err := client.NewConn(ctx, clientSide).Request(ctx, "file.list", nil, &resp); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.Data != listing {
+				t.Fatal("listing corrupted in transit")
+			}
+			written := atomic.LoadInt64(&counter.written)
+			if compressed := written < int64(len(listing)); compressed != c.compressed {
+				t.Fatalf("server wrote %d bytes for a %d byte listing, compressed = %v, want %v",
+					written, len(listing), compressed, c.compressed)
+			}
+		})
+	}
+}
+
+func TestNegotiatedFormat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chunk := make([]byte, 64<<10)
+	for i := range chunk {
+		chunk[i] = byte(i * 7)
+	}
+	newService := func(formats []string) *JsonRpcSimpleService {
+		handler := NewJsonRpcSimpleServiceHandler()
+		handler.RegisterHandle("file.read", func(req *Request) (any, error) {
+			return chunk, nil
+		})
+		return NewJsonRpcSimpleService(WithJsonRpcSimpleServiceHandler(handler), WithJsonRpcSimpleServiceFormats(formats...))
+	}
+
+	cases := []struct {
+		name   string
+		server []string
+		client []string
+		binary bool
+	}{
+		{"msgpack", []string{FormatMsgpack, FormatJSON}, []string{FormatMsgpack}, true},
+		{"json preferred", []string{FormatJSON, FormatMsgpack}, []string{FormatMsgpack, FormatJSON}, false},
+		{"plain client", []string{FormatMsgpack}, nil, false},
+		{"plain server", nil, []string{FormatMsgpack}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			serverSide, clientSide := net.Pipe()
+			counter := &countingConn{Conn: serverSide}
+			serverConn := newService(c.server).NewConn(ctx, counter)
+			defer serverConn.Close()
+
+			var resp Response
+			client := NewJsonRpcSimpleClient(WithJsonRpcSimpleClientFormats(c.client...))
+			if err := client.NewConn(ctx, clientSide).Request(ctx, "file.read", nil, &resp); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			// Data is decoded through JSON on the client, so it arrives as base64 either way
+			if resp.Data != base64.StdEncoding.EncodeToString(chunk) {
+				t.Fatal("chunk corrupted in transit")
+			}
+			written := atomic.LoadInt64(&counter.written)
+			if binary := written < int64(len(chunk))*4/3; binary != c.binary {
+				t.Fatalf("server wrote %d bytes for a %d byte chunk, binary = %v, want %v",
+					written, len(chunk), binary, c.binary)
+			}
+		})
+	}
+}
+
+// countingConn counts the bytes written to a connection
+type countingConn struct {
+	net.Conn
+	written int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	// Count before writing: the peer may finish reading before Write returns
+	atomic.AddInt64(&c.written, int64(len(p)))
+	return c.Conn.Write(p)
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	service := NewDefaultJsonRpcSimpleService(NewJsonRpcSimpleServiceHandler())
+	connected := make(chan *Session, 1)
+	disconnected := make(chan *Session, 1)
+	service.OnConnect(func(s *Session) {
+		s.Values().Set("cwd", "/root")
+		connected <- s
+	})
+	service.OnDisconnect(func(s *Session) {
+		disconnected <- s
+	})
+	service.RegisterHandle("session.cwd", func(req *Request) (any, error) {
+		return req.Session().ID() + ":" + req.Session().Values().GetString("cwd"), nil
+	})
+
+	dir, err := os.MkdirTemp("", "gsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listener, err := net.Listen("unix", filepath.Join(dir, "rpc.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			service.NewConn(ctx, conn)
+		}
+	}()
+
+	conn, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewJsonRpcSimpleClient().NewConn(ctx, conn)
+	var resp Response
+	if err := client.Request(ctx, "session.cwd", nil, &resp); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	session := <-connected
+	if resp.Data != session.ID()+":/root" {
+		t.Fatalf("unexpected response %#v for session %s", resp.Data, session.ID())
+	}
+	if got, ok := service.Session(session.ID()); !ok || got != session || len(service.Sessions()) != 1 {
+		t.Fatalf("session %s not listed", session.ID())
+	}
+	if runtime.GOOS == "linux" {
+		cred, err := session.PeerCred()
+		if err != nil || cred.PID != int32(os.Getpid()) {
+			t.Fatalf("peer credentials %+v, %v", cred, err)
+		}
+	}
+
+	// Closing from the server side runs the disconnect hooks and drops the session
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-disconnected:
+		if s != session {
+			t.Fatalf("disconnect hook got session %s", s.ID())
+		}
+	case <-ctx.Done():
+		t.Fatal("disconnect hook not called")
+	}
+	if len(service.Sessions()) != 0 {
+		t.Fatal("closed session still listed")
+	}
+	if err := client.Request(ctx, "session.cwd", nil, &resp); err == nil {
+		t.Fatal("request on a closed session succeeded")
+	}
+}
+
+// rawPeer writes and reads raw frames on a connection to a service
+type rawPeer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// send writes body in a frame
+func (p *rawPeer) send(body string) {
+	p.t.Helper()
+	if _, err := fmt.Fprintf(p.conn, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// receive reads a reply frame
+func (p *rawPeer) receive() (id json.RawMessage, resp Response) {
+	p.t.Helper()
+	header, err := textproto.NewReader(p.reader).ReadMIMEHeader()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(p.reader, data); err != nil {
+		p.t.Fatal(err)
+	}
+	var reply struct {
+		ID     json.RawMessage `json:"id"`
+		Result Response        `json:"result"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		p.t.Fatal(err)
+	}
+	return reply.ID, reply.Result
+}
+
+// newRawPeer serves service over a pipe
+func newRawPeer(t *testing.T, service *JsonRpcSimpleService) *rawPeer {
+	serverSide, clientSide := net.Pipe()
+	serverConn := service.NewConn(context.Background(), serverSide)
+	t.Cleanup(func() {
+		clientSide.Close()
+		serverConn.Close()
+	})
+	clientSide.SetDeadline(time.Now().Add(5 * time.Second))
+	return &rawPeer{t: t, conn: clientSide, reader: bufio.NewReader(clientSide)}
+}
+
+func TestFrameLimits(t *testing.T) {
+	handler := NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	service := NewDefaultJsonRpcSimpleService(handler)
+	WithJsonRpcSimpleServiceLimits(&Limits{MaxFrameSize: 1 << 10, MaxParamsSize: 64, MaxBatchLength: 2})(service)
+	peer := newRawPeer(t, service)
+
+	// Oversized params and batches fail alone; the connection stays usable
+	peer.send(`{"jsonrpc":"2.0","id":1,"method":"ping","params":"` + strings.Repeat("x", 100) + `"}`)
+	if id, resp := peer.receive(); string(id) != "1" || resp.Code != http.StatusRequestEntityTooLarge || resp.Meta.Close != 0 {
+		t.Fatalf("unexpected params rejection %s %+v", id, resp)
+	}
+	peer.send(`[{"jsonrpc":"2.0","id":2,"method":"ping"},{"jsonrpc":"2.0","id":3,"method":"ping"},{"jsonrpc":"2.0","id":4,"method":"ping"}]`)
+	if id, resp := peer.receive(); string(id) != "null" || resp.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected batch rejection %s %+v", id, resp)
+	}
+	peer.send(`{"jsonrpc":"2.0","id":5,"method":"ping"}`)
+	if id, resp := peer.receive(); string(id) != "5" || resp.Data != "pong" {
+		t.Fatalf("unexpected reply %s %+v", id, resp)
+	}
+
+	// An oversized frame is answered without reading its body, then the connection is closed
+	fmt.Fprintf(peer.conn, "Content-Length: %d\r\n\r\n", 1<<30)
+	id, resp := peer.receive()
+	if string(id) != "null" || resp.Code != http.StatusRequestEntityTooLarge || resp.Meta.Close != 1 {
+		t.Fatalf("unexpected frame rejection %s %+v", id, resp)
+	}
+	if exc := resp.Exception(); exc.Code() != gerror.CodeInvalidRequest.Code() || !strings.Contains(exc.Message(), "exceeds the limit of 1024 bytes") {
+		t.Fatalf("unexpected exception %v", exc)
+	}
+	if _, err := peer.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("connection not closed: %v", err)
+	}
+
+	// Malformed frames are counted by peer
+	peer = newRawPeer(t, service)
+	peer.send(`{"jsonrpc":`)
+	if _, resp := peer.receive(); resp.Code != http.StatusBadRequest || resp.Meta.Close != 1 {
+		t.Fatalf("unexpected malformed frame reply %+v", resp)
+	}
+	if counts := service.MalformedFrames(); counts["pipe"] != 2 {
+		t.Fatalf("unexpected malformed frame counts %v", counts)
+	}
+}
+
+// sendEncoded writes body compressed with encoding in a frame
+func (p *rawPeer) sendEncoded(encoding, body string) {
+	p.t.Helper()
+	data, err := compress(encoding, []byte(body))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	fmt.Fprintf(p.conn, "Content-Length: %d\r\nContent-Encoding: %s\r\n\r\n", len(data), encoding)
+	if _, err := p.conn.Write(data); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func TestCompressedFrameLimits(t *testing.T) {
+	handler := NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+	service := NewJsonRpcSimpleService(
+		WithJsonRpcSimpleServiceHandler(handler),
+		WithJsonRpcSimpleServiceCompression(NewCompression(0)),
+		WithJsonRpcSimpleServiceLimits(&Limits{MaxFrameSize: 1 << 10}),
+	)
+	request := `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+	bomb := `{"jsonrpc":"2.0","id":3,"method":"ping","params":"` + strings.Repeat("x", 200<<10) + `"}`
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		t.Run(encoding, func(t *testing.T) {
+			// Compressed frames are refused until the handshake picked the encoding
+			peer := newRawPeer(t, service)
+			peer.sendEncoded(encoding, request)
+			if _, resp := peer.receive(); resp.Code != http.StatusBadRequest || resp.Meta.Close != 1 ||
+				!strings.Contains(resp.Message, "was not negotiated") {
+				t.Fatalf("unexpected reply to an unnegotiated frame %+v", resp)
+			}
+
+			peer = newRawPeer(t, service)
+			peer.send(`{"jsonrpc":"2.0","id":1,"method":"rpc.handshake","params":{"compression":["` + encoding + `"]}}`)
+			peer.receive()
+			peer.sendEncoded(encoding, request)
+			if _, resp := peer.receive(); resp.Data != "pong" {
+				t.Fatalf("unexpected reply %+v", resp)
+			}
+
+			// The frame size limit applies to the decompressed payload as well
+			peer.sendEncoded(encoding, bomb)
+			if _, resp := peer.receive(); resp.Code != http.StatusBadRequest || resp.Meta.Close != 1 ||
+				!strings.Contains(resp.Message, "exceeds 1024 bytes") {
+				t.Fatalf("unexpected reply to a compression bomb %+v", resp)
+			}
+		})
+	}
+}
+
+func TestIdleReadTimeout(t *testing.T) {
+	handler := NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("slow", func(req *Request) (any, error) {
+		time.Sleep(150 * time.Millisecond)
+		return "done", nil
+	})
+	service := NewDefaultJsonRpcSimpleService(handler)
+	WithJsonRpcSimpleServiceLimits(&Limits{ReadTimeout: 50 * time.Millisecond})(service)
+	peer := newRawPeer(t, service)
+
+	// A call in flight keeps the connection open past the timeout
+	peer.send(`{"jsonrpc":"2.0","id":1,"method":"slow"}`)
+	if _, resp := peer.receive(); resp.Data != "done" {
+		t.Fatalf("unexpected reply %+v", resp)
+	}
+	start := time.Now()
+	if _, err := peer.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("idle connection not closed: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("idle connection closed after %v", time.Since(start))
+	}
+}
+
+func TestMethodVersions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type listV1 struct {
+		Dir string `json:"dir"`
+	}
+	type listV2 struct {
+		Paths []string `json:"paths"`
+	}
+	listV2Handler := func(req *Request) (any, error) {
+		var params listV2
+		if err := req.DecodeParams(&params); err != nil {
+			return nil, err
+		}
+		return strings.Join(params.Paths, ","), nil
+	}
+
+	handler := NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("file.list", AdaptParams(listV2Handler, func(old listV1) (listV2, error) {
+		return listV2{Paths: []string{old.Dir}}, nil
+	}),
+		WithMethodVersionOption("v1"),
+		WithMethodDeprecatedOption(Deprecation{Replacement: "file.list@v2", Removal: "2.0"}),
+	)
+	handler.RegisterHandle("file.list", listV2Handler, WithMethodVersionOption("v2"))
+	if methods := strings.Join(handler.Methods(), " "); methods != "file.list file.list@v1 file.list@v2" {
+		t.Fatalf("unexpected methods %q", methods)
+	}
+
+	serverSide, clientSide := net.Pipe()
+	serverConn := NewDefaultJsonRpcSimpleService(handler).NewConn(ctx, serverSide)
+	defer serverConn.Close()
+	client := NewJsonRpcSimpleClient().NewConn(ctx, clientSide)
+
+	call := func(method string, params any) Response {
+		t.Helper()
+		var resp Response
+		if err := client.Request(ctx, method, params, &resp); err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return resp
+	}
+
+	// Old front-ends keep calling the unversioned name and reach v1 through the adapter
+	resp := call("file.list", listV1{Dir: "/tmp"})
+	if resp.Data != "/tmp" || resp.Meta.Warning != "file.list is deprecated and will be removed in 2.0, use file.list@v2 instead" {
+		t.Fatalf("unexpected v1 response %+v %+v", resp, resp.Meta)
+	}
+	call("file.list@v1", listV1{Dir: "/var"})
+
+	resp = call("file.list@v2", listV2{Paths: []string{"/a", "/b"}})
+	if resp.Data != "/a,/b" || resp.Meta.Warning != "" {
+		t.Fatalf("unexpected v2 response %+v %+v", resp, resp.Meta)
+	}
+
+	calls := handler.DeprecatedCalls()
+	if len(calls) != 2 || calls[0].Method != "file.list" || calls[0].Calls != 1 ||
+		calls[1].Method != "file.list@v1" || calls[1].Calls != 1 || calls[1].LastCall.IsZero() {
+		t.Fatalf("unexpected counters %+v", calls)
+	}
+
+	// Registering the unversioned name takes it over from v1, without the deprecation
+	handler.RegisterHandle("file.list", listV2Handler)
+	if calls := handler.DeprecatedCalls(); len(calls) != 1 || calls[0].Method != "file.list@v1" {
+		t.Fatalf("unexpected counters %+v", calls)
+	}
+}
+
+func TestMethodListing(t *testing.T) {
+	list := func(handler IRpcServiceHandle, uid string) *Response {
+		req := &jsonrpc2.Request{Method: MethodMethods}
+		req.SetMeta(map[string]string{"uid": uid})
+		resp, _ := handler.Handle(MakeRequest(WithRequestReqOption(req)))
+		return resp.(*Response)
+	}
+
+	// Off by default
+	if resp := list(NewJsonRpcSimpleServiceHandler(), ""); resp.Code != http.StatusNotFound {
+		t.Fatalf("methods listed by default: %+v", resp)
+	}
+
+	root := func(req *Request) error {
+		if req.MetaString("uid") != "0" {
+			return errUnauthorized
+		}
+		return nil
+	}
+	handler := NewJsonRpcSimpleServiceHandler(WithJsonRpcSimpleServiceHandlerMethods(root))
+	handler.RegisterHandle("ping", handler.Ping)
+	if resp := list(handler, "1000"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("methods listed to a refused peer: %+v", resp)
+	}
+	if resp := list(handler, "0"); fmt.Sprint(resp.Data) != "[ping]" {
+		t.Fatalf("unexpected methods %+v", resp)
+	}
+}
+
+func TestListenerGroupStoppedBeforeStart(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.sock")
+	group := NewListenerGroup(Listener{SocketPath: path, Service: NewDefaultJsonRpcSimpleService(NewJsonRpcSimpleServiceHandler())})
+	group.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- group.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("start blocked after stop")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket left behind: %v", err)
+	}
+}
+
+func TestListenerGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir may exceed
+	dir, err := os.MkdirTemp("", "gsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	handler := NewJsonRpcSimpleServiceHandler(WithJsonRpcSimpleServiceHandlerMethods(nil))
+	handler.RegisterHandle("ping", handler.Ping)
+	handler.RegisterHandle("admin.reload", func(req *Request) (any, error) {
+		return "reloaded", nil
+	})
+	filtered, err := NewMethodFilter(handler, "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicCalls atomic.Int64
+	public := NewJsonRpcSimpleService(
+		WithJsonRpcSimpleServiceHandler(filtered),
+		WithJsonRpcSimpleServiceMiddlewares(&countingMiddleware{calls: &publicCalls}),
+	)
+	admin := NewDefaultJsonRpcSimpleService(handler)
+
+	publicPath, adminPath := filepath.Join(dir, "public.sock"), filepath.Join(dir, "admin.sock")
+	group := NewListenerGroup(Listener{SocketPath: publicPath, Service: public}, Listener{SocketPath: adminPath, Service: admin})
+	done := make(chan error, 1)
+	go func() { done <- group.Start() }()
+
+	dial := func(path string) IRpcClient {
+		t.Helper()
+		for {
+			conn, err := net.Dial("unix", path)
+			if err == nil {
+				return NewJsonRpcSimpleClient().NewConn(ctx, conn)
+			}
+			if ctx.Err() != nil {
+				t.Fatalf("dial %s: %v", path, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	call := func(client IRpcClient, method string) Response {
+		t.Helper()
+		var resp Response
+		if err := client.Request(ctx, method, nil, &resp); err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return resp
+	}
+
+	publicClient, adminClient := dial(publicPath), dial(adminPath)
+	if resp := call(publicClient, "admin.reload"); resp.Code != http.StatusNotFound {
+		t.Fatalf("filtered method answered %+v", resp)
+	}
+	if resp := call(publicClient, MethodMethods); fmt.Sprint(resp.Data) != "[ping]" {
+		t.Fatalf("unexpected public methods %v", resp.Data)
+	}
+	if resp := call(publicClient, "ping"); resp.Data != "pong" {
+		t.Fatalf("unexpected ping response %+v", resp)
+	}
+	if resp := call(adminClient, "admin.reload"); resp.Data != "reloaded" {
+		t.Fatalf("unexpected admin response %+v", resp)
+	}
+	if calls := publicCalls.Load(); calls != 3 {
+		t.Fatalf("public middleware saw %d calls, want 3", calls)
+	}
+
+	// The registry is shared: methods registered later show up on every socket they are exposed on
+	handler.RegisterHandle("admin.stats", func(req *Request) (any, error) {
+		return 1, nil
+	})
+	if resp := call(adminClient, "admin.stats"); resp.Code != http.StatusOK {
+		t.Fatalf("late method not served: %+v", resp)
+	}
+
+	group.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("group stopped with %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("group did not stop")
+	}
+	for _, path := range []string{publicPath, adminPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("socket %s left behind", path)
+		}
+	}
+	var resp Response
+	if err := adminClient.Request(ctx, "ping", nil, &resp); err == nil {
+		t.Fatal("connection survived the shutdown")
+	}
+}
+
+// countingMiddleware counts the requests it sees
+type countingMiddleware struct {
+	calls *atomic.Int64
+}
+
+func (m *countingMiddleware) ProcessRequest(req *Request) {
+	m.calls.Add(1)
+}
+
+func (m *countingMiddleware) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
@@ -0,0 +1,190 @@
+package gsock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// VersionSeparator separates a method name from its version, as in "file.list@v2"
+const VersionSeparator = "@"
+
+// Deprecation describes why and until when a method is kept around
+type Deprecation struct {
+	Message     string `json:"message"`               // Warning sent with every call; built from the other fields when empty
+	Replacement string `json:"replacement,omitempty"` // Method to call instead, e.g. "file.list@v2"
+	Removal     string `json:"removal,omitempty"`     // Release or date from which the method may be gone
+}
+
+// warning returns the message sent in Meta.Warning for calls of method
+func (d *Deprecation) warning(method string) string {
+	if d.Message != "" {
+		return d.Message
+	}
+	warning := method + " is deprecated"
+	if d.Removal != "" {
+		warning += " and will be removed in " + d.Removal
+	}
+	if d.Replacement != "" {
+		warning += ", use " + d.Replacement + " instead"
+	}
+	return warning
+}
+
+// MethodOption configures how RegisterHandle registers a method
+// It is passed among the route middlewares and does nothing as a middleware:
+//
+//	ds.RegisterHandle("file.list", hand.ListV2, gsock.WithMethodVersionOption("v2"))
+//	ds.RegisterHandle("file.list", gsock.AdaptParams(hand.ListV2, listV1ToV2),
+//		gsock.WithMethodVersionOption("v1"),
+//		gsock.WithMethodDeprecatedOption(gsock.Deprecation{Replacement: "file.list@v2", Removal: "2.0"}))
+type MethodOption struct {
+	version     string       // Version suffix of the method name, empty for none
+	deprecation *Deprecation // Set for deprecated methods
+}
+
+// WithMethodVersionOption registers the method as "api@version"
+// The first version registered for api also answers calls without a version, so existing
+// callers of api keep reaching it; registering api without a version takes that name over
+func WithMethodVersionOption(version string) *MethodOption {
+	return &MethodOption{version: version}
+}
+
+// WithMethodDeprecatedOption marks the method deprecated: calls succeed as before, with the
+// deprecation warning in Meta.Warning, and are counted in DeprecatedCalls
+func WithMethodDeprecatedOption(deprecation Deprecation) *MethodOption {
+	return &MethodOption{deprecation: &deprecation}
+}
+
+// ProcessRequest implements RPCMiddleware; options only apply at registration
+func (o *MethodOption) ProcessRequest(req *Request) {}
+
+// ProcessResponse implements RPCMiddleware; options only apply at registration
+func (o *MethodOption) ProcessResponse(resp any) (any, error) {
+	return resp, nil
+}
+
+// methodRegistration is the outcome of applying the MethodOptions of a RegisterHandle call
+type methodRegistration struct {
+	name        string          // Registered method name, versioned if a version is set
+	alias       string          // Unversioned name that may also be claimed, empty without a version
+	deprecation *Deprecation    // Set for deprecated methods
+	middlewares []RPCMiddleware // Route middlewares without the options
+}
+
+// registration separates the MethodOptions from the route middlewares of api
+func registration(api string, middlewares []RPCMiddleware) methodRegistration {
+	reg := methodRegistration{name: api}
+	for _, middleware := range middlewares {
+		option, ok := middleware.(*MethodOption)
+		if !ok {
+			reg.middlewares = append(reg.middlewares, middleware)
+			continue
+		}
+		if option.version != "" {
+			reg.name = api + VersionSeparator + option.version
+			reg.alias = api
+		}
+		if option.deprecation != nil {
+			reg.deprecation = option.deprecation
+		}
+	}
+	return reg
+}
+
+// SplitMethodVersion splits "file.list@v2" into "file.list" and "v2"; the version is empty without one
+func SplitMethodVersion(method string) (name, version string) {
+	name, version, _ = strings.Cut(method, VersionSeparator)
+	return name, version
+}
+
+// DeprecatedCall counts the calls of a deprecated method
+// A method with no calls over a long enough uptime is a candidate for removal
+type DeprecatedCall struct {
+	Method      string       `json:"method"`
+	Deprecation *Deprecation `json:"deprecation"`
+	Calls       uint64       `json:"calls"`    // Calls since the handler was created
+	LastCall    time.Time    `json:"lastCall"` // Zero without calls
+}
+
+// deprecatedMethod is a deprecated method and its call counter
+type deprecatedMethod struct {
+	deprecation *Deprecation
+	warning     string
+	calls       atomic.Uint64
+	lastCall    atomic.Int64 // Unix nanoseconds, 0 without calls
+}
+
+// called counts a call
+func (d *deprecatedMethod) called() {
+	d.calls.Add(1)
+	d.lastCall.Store(time.Now().UnixNano())
+}
+
+// deprecatedMethods tracks the deprecated methods of a handler
+// Methods are added at registration, before requests are served
+type deprecatedMethods map[string]*deprecatedMethod
+
+// add marks method deprecated, or undeprecates it when deprecation is nil
+func (d deprecatedMethods) add(method string, deprecation *Deprecation) {
+	if deprecation == nil {
+		delete(d, method)
+		return
+	}
+	d[method] = &deprecatedMethod{deprecation: deprecation, warning: deprecation.warning(method)}
+}
+
+// snapshot returns the counters sorted by method
+func (d deprecatedMethods) snapshot() []DeprecatedCall {
+	calls := make([]DeprecatedCall, 0, len(d))
+	for method, deprecated := range d {
+		call := DeprecatedCall{Method: method, Deprecation: deprecated.deprecation, Calls: deprecated.calls.Load()}
+		if last := deprecated.lastCall.Load(); last != 0 {
+			call.LastCall = time.Unix(0, last)
+		}
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Method < calls[j].Method })
+	return calls
+}
+
+// AdaptParams serves an older version of a method through the current handler
+// The old params are decoded into From and converted to the params next expects;
+// missing params convert from the zero From
+func AdaptParams[From, To any](next HandlerFunc, convert func(From) (To, error)) HandlerFunc {
+	return func(req *Request) (any, error) {
+		var old From
+		if raw := req.RawRequest(); raw != nil && raw.Params != nil && string(*raw.Params) != "null" {
+			if err := req.DecodeParams(&old); err != nil {
+				return nil, err
+			}
+		}
+		params, err := convert(old)
+		if err != nil {
+			return nil, err
+		}
+		adapted, err := req.withParams(params)
+		if err != nil {
+			return nil, err
+		}
+		return next(adapted)
+	}
+}
+
+// withParams returns a copy of the request carrying params instead of its own
+func (r *Request) withParams(params any) (*Request, error) {
+	raw := &jsonrpc2.Request{}
+	if r.req != nil {
+		*raw = *r.req
+	}
+	if err := raw.SetParams(params); err != nil {
+		return nil, fmt.Errorf("failed to marshal adapted params: %w", err)
+	}
+	adapted := *r
+	adapted.req = raw
+	return &adapted, nil
+}
@@ -0,0 +1,174 @@
+// Package gsocktest starts gsock services in memory or on throwaway sockets,
+// so handler tests need neither a fixed socket path nor a separately started server
+//
+//	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+//	service.RegisterHandle("hello", hand.Hello)
+//
+//	client, cleanup := gsocktest.NewPipeServer(service)
+//	defer cleanup()
+//
+//	resp := client.Call(t, "hello", nil)
+//	gsocktest.AssertCode(t, resp, http.StatusOK)
+//	gsocktest.AssertData(t, resp, "Hello World")
+package gsocktest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// OptFunc defines functions for configuring a test server
+type OptFunc func(*options)
+
+// WithClientOption sets the client adapter, e.g. one with callback handlers or compression
+func WithClientOption(adapter *gsock.JsonRpcSimpleClient) OptFunc {
+	return func(o *options) {
+		o.adapter = adapter
+	}
+}
+
+// options holds test server options
+type options struct {
+	adapter *gsock.JsonRpcSimpleClient // Client adapter
+}
+
+// newOptions applies opts over the defaults
+func newOptions(opts []OptFunc) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.adapter == nil {
+		o.adapter = gsock.NewJsonRpcSimpleClient()
+	}
+	return o
+}
+
+// Client is a client connected to a test server
+type Client struct {
+	gsock.IRpcClient
+	SocketPath string // Socket the server listens on, empty for pipe servers
+}
+
+// Call sends a request and decodes the response envelope
+// Transport and protocol errors fail the test immediately
+func (c *Client) Call(t testing.TB, method string, params any, opts ...jsonrpc2.CallOption) *gsock.Response {
+	t.Helper()
+
+	var resp gsock.Response
+	if err := c.Request(context.Background(), method, params, &resp, opts...); err != nil {
+		t.Fatalf("call %s failed: %v", method, err)
+	}
+	return &resp
+}
+
+// NewPipeServer serves service over an in-memory net.Pipe
+// It returns a connected client and a cleanup function closing both ends
+func NewPipeServer(service gsock.IRpcService, opts ...OptFunc) (*Client, func()) {
+	o := newOptions(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	serverSide, clientSide := net.Pipe()
+	conn := service.NewConn(ctx, serverSide)
+	client := &Client{IRpcClient: o.adapter.NewConn(ctx, clientSide)}
+
+	return client, func() {
+		clientSide.Close()
+		conn.Close()
+		cancel()
+	}
+}
+
+// NewSocketServer serves service on a Unix socket in a fresh temp directory
+// The returned client holds one connection; Client.SocketPath lets code under test dial its own.
+// Cleanup stops the listener, closes every accepted connection, removes the directory and
+// reports accept errors; it is also registered with t.Cleanup, so calling it is optional
+func NewSocketServer(t testing.TB, service gsock.IRpcService, opts ...OptFunc) (*Client, func()) {
+	t.Helper()
+	o := newOptions(opts)
+
+	// os.MkdirTemp keeps the path short; t.TempDir can exceed the Unix socket path limit
+	dir, err := os.MkdirTemp("", "gsocktest")
+	if err != nil {
+		t.Fatalf("create socket dir failed: %v", err)
+	}
+	socketPath := filepath.Join(dir, "rpc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("listen on %s failed: %v", socketPath, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu    sync.Mutex
+		conns []*jsonrpc2.Conn
+		wg    sync.WaitGroup
+	)
+	// The accept loop may outlive the test, so it never reports through t itself
+	acceptErr := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					acceptErr <- err
+				}
+				return
+			}
+			mu.Lock()
+			conns = append(conns, service.NewConn(ctx, conn))
+			mu.Unlock()
+		}
+	}()
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		listener.Close()
+		wg.Wait()
+		cancel()
+		os.RemoveAll(dir)
+		t.Fatalf("dial %s failed: %v", socketPath, err)
+	}
+	client := &Client{
+		IRpcClient: o.adapter.NewConn(ctx, conn),
+		SocketPath: socketPath,
+	}
+
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() {
+			conn.Close()
+			listener.Close()
+			wg.Wait()
+
+			mu.Lock()
+			for _, c := range conns {
+				c.Close()
+			}
+			mu.Unlock()
+
+			cancel()
+			os.RemoveAll(dir)
+
+			select {
+			case err := <-acceptErr:
+				t.Errorf("accept failed: %v", err)
+			default:
+			}
+		})
+	}
+	t.Cleanup(cleanup)
+	return client, cleanup
+}
@@ -0,0 +1,80 @@
+package gsocktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// AssertCode fails the test unless the response has the given code
+func AssertCode(t testing.TB, resp *gsock.Response, code int) {
+	t.Helper()
+
+	if resp == nil {
+		t.Fatalf("expected code %d, got no response", code)
+	}
+	if resp.Code != code {
+		t.Fatalf("expected code %d, got %d (%s)", code, resp.Code, resp.Message)
+	}
+}
+
+// AssertData fails the test unless the response data equals want
+// Both sides are compared by their JSON encoding, so want may be a struct, a map or a scalar
+func AssertData(t testing.TB, resp *gsock.Response, want any) {
+	t.Helper()
+
+	got, err := canonicalJSON(resp.Data)
+	if err != nil {
+		t.Fatalf("encode response data failed: %v", err)
+	}
+	expected, err := canonicalJSON(want)
+	if err != nil {
+		t.Fatalf("encode expected data failed: %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Fatalf("unexpected data\n  got:  %s\n  want: %s", got, expected)
+	}
+}
+
+// AssertMeta fails the test unless the response meta equals want
+func AssertMeta(t testing.TB, resp *gsock.Response, want gsock.Meta) {
+	t.Helper()
+
+	if resp.Meta == nil {
+		t.Fatalf("expected meta %+v, got none", want)
+	}
+	if *resp.Meta != want {
+		t.Fatalf("expected meta %+v, got %+v", want, *resp.Meta)
+	}
+}
+
+// DecodeData decodes the response data into out
+func DecodeData(t testing.TB, resp *gsock.Response, out any) {
+	t.Helper()
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("encode response data failed: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("decode response data failed: %v", err)
+	}
+}
+
+// canonicalJSON encodes a value with sorted object keys and verbatim numbers
+func canonicalJSON(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
@@ -0,0 +1,37 @@
+package gsocktest
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/DemonZack/simplejrpc-go/core"
+)
+
+// NewContainer creates a container for tests without reading config files
+// Its logger records every entry at debug level and above in the returned ObservedLogs.
+// The validator is the default one; no config is set unless passed with core.WithContainerConfigOption
+func NewContainer(opts ...core.WithContainerFunc) (core.IContainer, *observer.ObservedLogs) {
+	observed, logs := observer.New(zapcore.DebugLevel)
+	base := []core.WithContainerFunc{
+		core.WithContainerLoggerOption(zap.New(observed)),
+		core.WithContainerValidOption(core.NewDefaultStructWalker()),
+	}
+	return core.NewContainer(append(base, opts...)...), logs
+}
+
+// UseContainer installs c as core.Container and its logger as the zap global logger
+// for the duration of the test; both are restored on cleanup
+func UseContainer(t testing.TB, c core.IContainer) {
+	t.Helper()
+
+	previous := core.Container
+	core.Container = c
+	restore := zap.ReplaceGlobals(c.Log())
+	t.Cleanup(func() {
+		restore()
+		core.Container = previous
+	})
+}
@@ -0,0 +1,21 @@
+package gsocktest
+
+import (
+	"context"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// MockInterceptor answers calls to method without contacting the server, for code under test
+// that owns its client: pass it with gsock.WithRpcClientInterceptorOption
+// The reply is the envelope a handler returning data and err would produce
+func MockInterceptor(method string, data any, err error) gsock.ClientInterceptor {
+	return func(ctx context.Context, call *gsock.ClientCall, next gsock.ClientInvoker) error {
+		if call.Method != method {
+			return next(ctx, call)
+		}
+		resp := gsock.NewResponse().WithResult(data, err)
+		resp.SetEndpoint(method)
+		return call.SetResult(resp)
+	}
+}
@@ -0,0 +1,87 @@
+package gsocktest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/DemonZack/simplejrpc-go/core"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func TestPipeServerWithObservedContainer(t *testing.T) {
+	container, logs := NewContainer()
+	UseContainer(t, container)
+
+	service := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	service.RegisterHandle("disk.usage", func(req *gsock.Request) (any, error) {
+		core.Container.Log().Info("disk usage requested", zap.String("method", req.Method()))
+		return map[string]any{"used": 42, "mount": "/"}, nil
+	})
+	service.RegisterHandle("disk.fail", func(req *gsock.Request) (any, error) {
+		zap.L().Warn("disk unavailable")
+		return nil, errors.New("disk unavailable")
+	})
+
+	client, cleanup := NewPipeServer(service)
+	defer cleanup()
+
+	resp := client.Call(t, "disk.usage", nil)
+	AssertCode(t, resp, http.StatusOK)
+	AssertData(t, resp, struct {
+		Mount string `json:"mount"`
+		Used  int    `json:"used"`
+	}{"/", 42})
+	AssertMeta(t, resp, gsock.Meta{Endpoint: "disk.usage"})
+
+	var usage struct{ Used int }
+	DecodeData(t, resp, &usage)
+	if usage.Used != 42 {
+		t.Fatalf("decoded %+v", usage)
+	}
+
+	AssertCode(t, client.Call(t, "disk.fail", nil), http.StatusBadRequest)
+	if logs.FilterMessage("disk usage requested").Len() != 1 || logs.FilterMessage("disk unavailable").Len() != 1 {
+		t.Fatalf("unexpected observed logs: %v", logs.All())
+	}
+}
+
+func TestSocketServer(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+
+	client, cleanup := NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+	AssertData(t, client.Call(t, "ping", nil), "pong")
+
+	// Code under test may dial the socket itself
+	var resp gsock.Response
+	if err := gsock.NewRpcSimpleClient(client.SocketPath).Request(context.Background(), "ping", nil, &resp); err != nil {
+		t.Fatalf("dial test socket failed: %v", err)
+	}
+	AssertData(t, &resp, "pong")
+
+	cleanup()
+	if err := gsock.NewRpcSimpleClient(client.SocketPath).Request(context.Background(), "ping", nil, &resp); err == nil {
+		t.Fatal("socket still served after cleanup")
+	}
+}
+
+func TestSocketServerCleansUpWithTest(t *testing.T) {
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	handler.RegisterHandle("ping", handler.Ping)
+
+	var socketPath string
+	t.Run("without cleanup", func(t *testing.T) {
+		client, _ := NewSocketServer(t, gsock.NewDefaultJsonRpcSimpleService(handler))
+		AssertData(t, client.Call(t, "ping", nil), "pong")
+		socketPath = client.SocketPath
+	})
+	if _, err := os.Stat(filepath.Dir(socketPath)); !os.IsNotExist(err) {
+		t.Fatalf("socket dir left behind after the test: %v", err)
+	}
+}
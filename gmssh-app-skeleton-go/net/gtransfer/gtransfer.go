@@ -0,0 +1,216 @@
+package gtransfer
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	MethodUploadBegin  = "file.upload.begin"  // Starts or resumes an upload
+	MethodUploadChunk  = "file.upload.chunk"  // Writes one chunk at the current offset
+	MethodUploadCommit = "file.upload.commit" // Verifies and atomically moves the upload into place
+	MethodUploadAbort  = "file.upload.abort"  // Discards an upload and its temp file
+	MethodDownload     = "file.download"      // Reads one chunk, or streams the file as notifications
+
+	// MethodDownloadChunk is the notification method used by streaming downloads
+	MethodDownloadChunk = "file.download.chunk"
+
+	// DefaultChunkSize is the maximum number of bytes per chunk
+	DefaultChunkSize = 512 << 10 // 512KB
+
+	// DefaultSessionTTL is how long an idle upload can be resumed before it is cleaned up
+	DefaultSessionTTL = 30 * time.Minute
+)
+
+// ServiceOptFunc defines functions for configuring a transfer Service
+type ServiceOptFunc func(*Service)
+
+// WithChunkSizeOption sets the maximum chunk size in bytes
+func WithChunkSizeOption(size int) ServiceOptFunc {
+	return func(s *Service) {
+		s.chunkSize = size
+	}
+}
+
+// WithRootOption confines all transfer paths to dir
+// Relative paths are resolved against it and paths escaping it, lexically or through
+// symbolic links, are rejected
+func WithRootOption(dir string) ServiceOptFunc {
+	return func(s *Service) {
+		s.root = filepath.Clean(dir)
+	}
+}
+
+// WithUnrestrictedPathsOption lets clients read and write any path the process can reach
+// Without it a Service with no root refuses every path
+func WithUnrestrictedPathsOption() ServiceOptFunc {
+	return func(s *Service) {
+		s.unrestricted = true
+	}
+}
+
+// WithSessionTTLOption sets how long an idle upload is kept for resuming
+func WithSessionTTLOption(ttl time.Duration) ServiceOptFunc {
+	return func(s *Service) {
+		s.sessionTTL = ttl
+	}
+}
+
+// Service implements chunked, resumable file transfer over RPC
+// Uploads are written to a temp file next to the target and renamed on commit,
+// so the target never contains a partial file.
+// Paths are confined to the directory set with WithRootOption; a Service without a root
+// refuses every path unless WithUnrestrictedPathsOption opens the whole filesystem to clients:
+//
+//	transfer := gtransfer.NewService(gtransfer.WithRootOption("/data"))
+//	transfer.Register(ds)
+type Service struct {
+	mu           sync.Mutex         // Protects uploads
+	uploads      map[string]*upload // Active uploads by ID
+	chunkSize    int                // Maximum chunk size
+	root         string             // Directory all paths are confined to
+	unrestricted bool               // Allow any path when there is no root
+	sessionTTL   time.Duration      // Idle upload lifetime
+	janitorOnce  sync.Once          // Starts the janitor with the first upload
+	closed       chan struct{}      // Closed by Close to stop the janitor
+	closeOnce    sync.Once
+}
+
+// NewService creates a transfer service
+func NewService(opts ...ServiceOptFunc) *Service {
+	s := &Service{
+		uploads:    make(map[string]*upload),
+		chunkSize:  DefaultChunkSize,
+		sessionTTL: DefaultSessionTTL,
+		closed:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.chunkSize <= 0 {
+		s.chunkSize = DefaultChunkSize
+	}
+	return s
+}
+
+// Register binds the file.upload.* and file.download methods on the given handler registry
+func (s *Service) Register(handler gsock.IRpcHandler) {
+	handler.RegisterHandle(MethodUploadBegin, s.UploadBegin)
+	handler.RegisterHandle(MethodUploadChunk, s.UploadChunk)
+	handler.RegisterHandle(MethodUploadCommit, s.UploadCommit)
+	handler.RegisterHandle(MethodUploadAbort, s.UploadAbort)
+	handler.RegisterHandle(MethodDownload, s.Download)
+}
+
+// resolve maps a requested path to a local path, enforcing the root directory
+// Symbolic links in the path, including the target itself, are resolved and the result must
+// still be inside the root, so a link inside the root cannot reach files outside of it
+func (s *Service) resolve(path string) (string, error) {
+	if path == "" {
+		return "", gerror.WithMessage(gerror.CodeMissingParameter, "path is required")
+	}
+	if s.root == "" {
+		if !s.unrestricted {
+			return "", gerror.WithMessage(gerror.CodeSecurityReason, "no transfer root configured")
+		}
+		return filepath.Clean(path), nil
+	}
+
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", gerror.WithMessageErr(gerror.CodeFileNotExistsError, err, "transfer root unavailable")
+	}
+	local, err := evalExisting(filepath.Join(root, filepath.Clean("/"+path)))
+	if err != nil {
+		return "", gerror.WithMessageErr(gerror.CodeSecurityReason, err, "")
+	}
+	if local != root && !strings.HasPrefix(local, root+string(filepath.Separator)) {
+		return "", gerror.WithMessage(gerror.CodeSecurityReason, "path escapes the transfer root")
+	}
+	return local, nil
+}
+
+// evalExisting resolves the symbolic links of the longest existing prefix of path and
+// appends the missing rest, which cannot contain links yet
+func evalExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// A dangling link exists but points nowhere; following it later could escape
+		if _, lerr := os.Lstat(path); lerr == nil {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// Close stops the background cleanup and discards every unfinished upload with its temp file
+func (s *Service) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, up := range s.uploads {
+		up.mu.Lock()
+		s.discard(up)
+		up.mu.Unlock()
+		delete(s.uploads, id)
+	}
+	return nil
+}
+
+// janitor sweeps idle uploads so their temp files do not outlive the session TTL
+// when no further upload starts
+func (s *Service) janitor() {
+	interval := s.sessionTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.sweep()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// decodeParams decodes request params into out
+func decodeParams(req *gsock.Request, out any) error {
+	raw := req.RawRequest()
+	if raw == nil || raw.Params == nil {
+		return gerror.CodeMissingParameter
+	}
+	if err := json.Unmarshal(*raw.Params, out); err != nil {
+		return gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+	}
+	return nil
+}
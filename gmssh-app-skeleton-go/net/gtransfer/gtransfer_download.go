@@ -0,0 +1,154 @@
+package gtransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// DownloadParams are the params of file.download
+type DownloadParams struct {
+	Path   string `json:"path"`   // Source path
+	Offset int64  `json:"offset"` // Offset to start reading at
+	Length int    `json:"length"` // Bytes to read, capped at the chunk size (0 = chunk size)
+	Stream bool   `json:"stream"` // Push the file from Offset to EOF as file.download.chunk notifications
+}
+
+// Chunk is one piece of a downloaded file
+// It is the result of a non-streaming file.download and the params of file.download.chunk
+type Chunk struct {
+	Path   string `json:"path"`   // Source path
+	Offset int64  `json:"offset"` // Offset of Data in the file
+	Data   []byte `json:"data"`   // Chunk bytes (base64 in JSON)
+	Sha256 string `json:"sha256"` // Hex SHA-256 of Data
+	Size   int64  `json:"size"`   // Total file size
+	EOF    bool   `json:"eof"`    // Data ends at the end of the file
+}
+
+// StreamResult is returned by a streaming file.download once all chunks were sent
+type StreamResult struct {
+	FileResult
+	Chunks int `json:"chunks"` // Number of file.download.chunk notifications sent
+}
+
+// Download handles file.download
+// Without stream it returns a single Chunk, letting the client pull the file at its own pace
+// and resume from any offset. With stream the chunks are pushed as notifications on the
+// connection before the call returns the whole-file hash; clients place them by Offset
+// since notifications may be handled concurrently
+func (s *Service) Download(req *gsock.Request) (any, error) {
+	var params DownloadParams
+	if err := decodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	local, err := s.resolve(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	if params.Offset < 0 || params.Length < 0 {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "offset and length must not be negative")
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, gerror.WithMessage(gerror.CodeFileNotExistsError, params.Path)
+		}
+		return nil, gerror.WithMessageErr(gerror.CodeResponseReadError, err, "")
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeGetFileSizeError, err, "")
+	}
+	if info.IsDir() {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "path is a directory")
+	}
+	if params.Offset > info.Size() {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "offset beyond end of file")
+	}
+
+	if params.Stream {
+		return s.stream(req, file, params.Path, params.Offset, info.Size())
+	}
+
+	length := params.Length
+	if length == 0 || length > s.chunkSize {
+		length = s.chunkSize
+	}
+	return readChunk(file, params.Path, params.Offset, length, info.Size())
+}
+
+// stream pushes the file from offset to EOF as file.download.chunk notifications
+// The returned hash covers the whole file so a resumed download can be verified end to end
+func (s *Service) stream(req *gsock.Request, file *os.File, path string, offset, size int64) (any, error) {
+	conn := req.Conn()
+	if conn == nil {
+		return nil, gerror.WithMessage(gerror.CodeNotSupported, "streaming requires a persistent connection")
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, file, offset); err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeResponseReadError, err, "")
+	}
+
+	chunks := 0
+	for {
+		chunk, err := readChunk(file, path, offset, s.chunkSize, size)
+		if err != nil {
+			return nil, err
+		}
+		if chunk.EOF && offset+int64(len(chunk.Data)) < size {
+			// The file shrank since it was opened; the whole-file hash would not match
+			return nil, gerror.WithMessage(gerror.CodeResponseReadError, "file changed during download")
+		}
+		hash.Write(chunk.Data)
+		if err := conn.Notify(context.Background(), MethodDownloadChunk, chunk); err != nil {
+			return nil, gerror.WithMessageErr(gerror.CodeOperationFailed, err, "")
+		}
+		chunks++
+		offset += int64(len(chunk.Data))
+		if chunk.EOF {
+			break
+		}
+	}
+
+	return StreamResult{
+		FileResult: FileResult{Path: path, Size: size, Sha256: hex.EncodeToString(hash.Sum(nil))},
+		Chunks:     chunks,
+	}, nil
+}
+
+// readChunk reads up to length bytes at offset
+// The chunk ends the file when it reaches size or the actual end of the file, which is
+// earlier than size if the file shrank
+func readChunk(file *os.File, path string, offset int64, length int, size int64) (*Chunk, error) {
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, offset)
+	reachedEOF := errors.Is(err, io.EOF)
+	if err != nil && !reachedEOF {
+		return nil, gerror.WithMessageErr(gerror.CodeResponseReadError, err, "")
+	}
+	if remaining := size - offset; int64(n) > remaining {
+		// The file grew since it was opened; stop at the size reported to the client
+		n = int(max(remaining, 0))
+	}
+	buf = buf[:n]
+
+	sum := sha256.Sum256(buf)
+	return &Chunk{
+		Path:   path,
+		Offset: offset,
+		Data:   buf,
+		Sha256: hex.EncodeToString(sum[:]),
+		Size:   size,
+		EOF:    reachedEOF || offset+int64(n) >= size,
+	}, nil
+}
@@ -0,0 +1,265 @@
+package gtransfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func TestUploadResumeAndCommit(t *testing.T) {
+	root := t.TempDir()
+	service := NewService(WithRootOption(root), WithChunkSizeOption(4))
+	content := []byte("hello, chunked world")
+
+	begin := BeginParams{Path: "/out/file.txt", Size: int64(len(content)), Sha256: hexSum(content)}
+	os.MkdirAll(filepath.Join(root, "out"), 0755)
+	first := call[BeginResult](t, service.UploadBegin, begin)
+	if first.Offset != 0 || first.ChunkSize != 4 {
+		t.Fatalf("unexpected begin result %#v", first)
+	}
+
+	// Send two chunks, then "reconnect" and resume from the reported offset
+	for offset := 0; offset < 8; offset += 4 {
+		sendChunk(t, service, first.UploadID, content, int64(offset))
+	}
+	resumed := call[BeginResult](t, service.UploadBegin, begin)
+	if resumed.UploadID != first.UploadID || resumed.Offset != 8 {
+		t.Fatalf("upload not resumed: %#v", resumed)
+	}
+
+	// Out of order and corrupted chunks are rejected
+	if _, err := invoke(t, service.UploadChunk, ChunkParams{UploadID: first.UploadID, Offset: 0, Data: content[:4], Sha256: hexSum(content[:4])}); err == nil {
+		t.Fatal("expected offset mismatch")
+	}
+	if _, err := invoke(t, service.UploadChunk, ChunkParams{UploadID: first.UploadID, Offset: 8, Data: content[8:12], Sha256: hexSum(content[:4])}); err == nil {
+		t.Fatal("expected chunk hash mismatch")
+	}
+
+	for offset := resumed.Offset; offset < int64(len(content)); offset += 4 {
+		sendChunk(t, service, first.UploadID, content, offset)
+	}
+	result := call[FileResult](t, service.UploadCommit, UploadParams{UploadID: first.UploadID})
+	if result.Path != begin.Path || result.Size != int64(len(content)) || result.Sha256 != begin.Sha256 {
+		t.Fatalf("unexpected commit result %#v", result)
+	}
+
+	written, err := os.ReadFile(filepath.Join(root, "out", "file.txt"))
+	if err != nil || !bytes.Equal(written, content) {
+		t.Fatalf("committed file mismatch: %q, %v", written, err)
+	}
+	if parts, _ := filepath.Glob(filepath.Join(root, "out", ".*.part")); len(parts) != 0 {
+		t.Fatalf("temp files left behind: %v", parts)
+	}
+	if _, err := invoke(t, service.UploadChunk, ChunkParams{UploadID: first.UploadID}); err == nil {
+		t.Fatal("expected committed session to be gone")
+	}
+}
+
+func TestUploadAbortAndRoot(t *testing.T) {
+	root := t.TempDir()
+	service := NewService(WithRootOption(root))
+	content := []byte("partial")
+
+	begin := call[BeginResult](t, service.UploadBegin, BeginParams{Path: "a.bin", Size: 100, Sha256: hexSum(content)})
+	sendChunk(t, service, begin.UploadID, content, 0)
+	call[bool](t, service.UploadAbort, UploadParams{UploadID: begin.UploadID})
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 0 {
+		t.Fatalf("abort left files behind: %v", entries)
+	}
+
+	// Paths are confined to the root, however they are written
+	for _, path := range []string{"../../etc/passwd", "/etc/passwd", "a/../../etc/passwd"} {
+		local, err := service.resolve(path)
+		if err != nil || local != filepath.Join(root, "etc", "passwd") {
+			t.Fatalf("resolve(%q) = %q, %v", path, local, err)
+		}
+	}
+}
+
+func TestSymlinksCannotEscapeRoot(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600)
+	os.Symlink(outside, filepath.Join(root, "dir"))
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "file"))
+	os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+	service := NewService(WithRootOption(root))
+	defer service.Close()
+
+	for _, path := range []string{"dir/secret", "file", "dir/new.txt", "dangling"} {
+		if _, err := invoke(t, service.Download, DownloadParams{Path: path}); err == nil {
+			t.Errorf("download of %s escaped the root", path)
+		}
+		if _, err := invoke(t, service.UploadBegin, BeginParams{Path: path, Size: 1, Sha256: hexSum([]byte("x")), Overwrite: true}); err == nil {
+			t.Errorf("upload to %s escaped the root", path)
+		}
+	}
+
+	// A directory swapped for a link between begin and commit is caught at commit
+	os.Mkdir(filepath.Join(root, "swap"), 0755)
+	content := []byte("data")
+	begin := call[BeginResult](t, service.UploadBegin, BeginParams{Path: "swap/f", Size: 4, Sha256: hexSum(content)})
+	sendChunk(t, service, begin.UploadID, content, 0)
+	os.Rename(filepath.Join(root, "swap"), filepath.Join(root, "swapped"))
+	os.Symlink(outside, filepath.Join(root, "swap"))
+	if _, err := invoke(t, service.UploadCommit, UploadParams{UploadID: begin.UploadID}); err == nil {
+		t.Fatal("commit followed a swapped directory")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "f")); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the root: %v", err)
+	}
+}
+
+func TestCloseDiscardsUploads(t *testing.T) {
+	root := t.TempDir()
+	service := NewService(WithRootOption(root))
+	content := []byte("partial")
+	begin := call[BeginResult](t, service.UploadBegin, BeginParams{Path: "a.bin", Size: 100, Sha256: hexSum(content)})
+	sendChunk(t, service, begin.UploadID, content, 0)
+
+	service.Close()
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Fatalf("close left files behind: %v", entries)
+	}
+}
+
+func TestResolveWithoutRoot(t *testing.T) {
+	if _, err := NewService().resolve("/etc/passwd"); err == nil {
+		t.Fatal("expected paths to be refused without a root")
+	}
+	local, err := NewService(WithUnrestrictedPathsOption()).resolve("/etc/../etc/passwd")
+	if err != nil || local != "/etc/passwd" {
+		t.Fatalf("resolve = %q, %v", local, err)
+	}
+}
+
+func TestReadChunkStopsAtActualEOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shrunk.bin")
+	os.WriteFile(path, []byte("0123456789"), 0644)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// Stat reported 20 bytes, but the file has shrunk to 10
+	chunk, err := readChunk(file, "shrunk.bin", 8, 5, 20)
+	if err != nil || string(chunk.Data) != "89" || !chunk.EOF {
+		t.Fatalf("unexpected chunk %#v, %v", chunk, err)
+	}
+	chunk, err = readChunk(file, "shrunk.bin", 10, 5, 20)
+	if err != nil || len(chunk.Data) != 0 || !chunk.EOF {
+		t.Fatalf("unexpected chunk %#v, %v", chunk, err)
+	}
+
+	// A file that grew is read up to the size at stat time
+	chunk, err = readChunk(file, "shrunk.bin", 4, 5, 6)
+	if err != nil || string(chunk.Data) != "45" || !chunk.EOF {
+		t.Fatalf("unexpected chunk %#v, %v", chunk, err)
+	}
+}
+
+func TestDownloadChunkAndStream(t *testing.T) {
+	root := t.TempDir()
+	content := []byte("0123456789abcdef!")
+	os.WriteFile(filepath.Join(root, "data.bin"), content, 0644)
+	service := NewService(WithRootOption(root), WithChunkSizeOption(5))
+
+	chunk := call[*Chunk](t, service.Download, DownloadParams{Path: "data.bin", Offset: 15})
+	if string(chunk.Data) != "f!" || !chunk.EOF || chunk.Size != int64(len(content)) || chunk.Sha256 != hexSum(chunk.Data) {
+		t.Fatalf("unexpected chunk %#v", chunk)
+	}
+	if _, err := invoke(t, service.Download, DownloadParams{Path: "missing.bin"}); err == nil {
+		t.Fatal("expected missing file error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := gsock.NewDefaultJsonRpcSimpleService(gsock.NewJsonRpcSimpleServiceHandler())
+	service.Register(server)
+	serverSide, clientSide := net.Pipe()
+	server.NewConn(ctx, serverSide)
+
+	received := make(chan Chunk, 8)
+	adapter := gsock.NewJsonRpcSimpleClient()
+	adapter.RegisterHandle(MethodDownloadChunk, func(req *gsock.Request) (any, error) {
+		var c Chunk
+		json.Unmarshal(*req.RawRequest().Params, &c)
+		received <- c
+		return nil, nil
+	})
+	client := adapter.NewConn(ctx, clientSide)
+	defer clientSide.Close()
+
+	var resp struct {
+		Code int          `json:"code"`
+		Data StreamResult `json:"data"`
+	}
+	if err := client.Request(ctx, MethodDownload, DownloadParams{Path: "data.bin", Offset: 5, Stream: true}, &resp); err != nil {
+		t.Fatalf("stream download failed: %v", err)
+	}
+	if resp.Code != 200 || resp.Data.Chunks != 3 || resp.Data.Sha256 != hexSum(content) {
+		t.Fatalf("unexpected stream result %#v", resp)
+	}
+
+	// Chunks are placed by offset, whatever order they are handled in
+	streamed := make([]byte, len(content))
+	for n := 0; n < resp.Data.Chunks; n++ {
+		select {
+		case c := <-received:
+			copy(streamed[c.Offset:], c.Data)
+		case <-ctx.Done():
+			t.Fatal("chunk notification not received")
+		}
+	}
+	if !bytes.Equal(streamed[5:], content[5:]) {
+		t.Fatalf("streamed %q", streamed)
+	}
+}
+
+// sendChunk uploads content[offset:offset+4]
+func sendChunk(t *testing.T, service *Service, id string, content []byte, offset int64) {
+	end := offset + 4
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	data := content[offset:end]
+	call[ChunkResult](t, service.UploadChunk, ChunkParams{UploadID: id, Offset: offset, Data: data, Sha256: hexSum(data)})
+}
+
+// call invokes a handler and converts its result, failing the test on error
+func call[T any](t *testing.T, handler gsock.HandlerFunc, params any) T {
+	t.Helper()
+	result, err := invoke(t, handler, params)
+	if err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+	return result.(T)
+}
+
+// invoke runs a handler with JSON encoded params
+func invoke(t *testing.T, handler gsock.HandlerFunc, params any) (any, error) {
+	req := &jsonrpc2.Request{}
+	if err := req.SetParams(params); err != nil {
+		t.Fatalf("set params failed: %v", err)
+	}
+	return handler(gsock.MakeRequest(gsock.WithRequestReqOption(req)))
+}
+
+func hexSum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
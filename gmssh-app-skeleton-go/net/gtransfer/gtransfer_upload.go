@@ -0,0 +1,323 @@
+package gtransfer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+// BeginParams are the params of file.upload.begin
+type BeginParams struct {
+	Path      string `json:"path"`      // Target path
+	Size      int64  `json:"size"`      // Total file size in bytes
+	Sha256    string `json:"sha256"`    // Hex SHA-256 of the whole file
+	Overwrite bool   `json:"overwrite"` // Replace an existing target on commit
+}
+
+// BeginResult is returned by file.upload.begin
+// Offset is non-zero when an interrupted upload of the same file is resumed
+type BeginResult struct {
+	UploadID  string `json:"uploadId"`  // Upload session identifier
+	ChunkSize int    `json:"chunkSize"` // Maximum accepted chunk size
+	Offset    int64  `json:"offset"`    // Offset the next chunk must start at
+}
+
+// ChunkParams are the params of file.upload.chunk
+type ChunkParams struct {
+	UploadID string `json:"uploadId"` // Upload session identifier
+	Offset   int64  `json:"offset"`   // Offset of this chunk, must equal the current offset
+	Data     []byte `json:"data"`     // Chunk bytes (base64 in JSON)
+	Sha256   string `json:"sha256"`   // Hex SHA-256 of Data
+}
+
+// ChunkResult is returned by file.upload.chunk
+type ChunkResult struct {
+	Offset int64 `json:"offset"` // Offset the next chunk must start at
+}
+
+// UploadParams identify an upload in file.upload.commit and file.upload.abort
+type UploadParams struct {
+	UploadID string `json:"uploadId"` // Upload session identifier
+}
+
+// FileResult describes a complete file
+type FileResult struct {
+	Path   string `json:"path"`   // File path
+	Size   int64  `json:"size"`   // File size in bytes
+	Sha256 string `json:"sha256"` // Hex SHA-256 of the file
+}
+
+// upload is an in-progress upload session
+type upload struct {
+	mu        sync.Mutex // Serializes chunk writes
+	id        string     // Session identifier
+	path      string     // Target path as sent by the client
+	target    string     // Final path
+	temp      string     // Temp file path next to the target
+	size      int64      // Expected total size
+	sha256    string     // Expected whole-file hash (lower-case hex)
+	overwrite bool       // Replace existing target on commit
+	file      *os.File   // Open temp file
+	offset    int64      // Bytes written so far
+	hash      hash.Hash  // Running hash of written bytes
+	touched   time.Time  // Last activity
+	done      bool       // Committed or discarded; the session must not be used anymore
+}
+
+// UploadBegin handles file.upload.begin
+// An unfinished upload of the same path, size and hash is resumed instead of restarted
+func (s *Service) UploadBegin(req *gsock.Request) (any, error) {
+	var params BeginParams
+	if err := decodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	target, err := s.resolve(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	if params.Size < 0 || len(params.Sha256) != sha256.Size*2 {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "size and sha256 are required")
+	}
+	expected := strings.ToLower(params.Sha256)
+
+	s.janitorOnce.Do(func() {
+		go s.janitor()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+
+	for _, up := range s.uploads {
+		if up.target == target && up.size == params.Size && up.sha256 == expected {
+			up.mu.Lock()
+			if up.done {
+				up.mu.Unlock()
+				continue
+			}
+			up.touched = time.Now()
+			up.overwrite = params.Overwrite
+			offset := up.offset
+			up.mu.Unlock()
+			return BeginResult{UploadID: up.id, ChunkSize: s.chunkSize, Offset: offset}, nil
+		}
+	}
+
+	if !params.Overwrite {
+		if _, err := os.Stat(target); err == nil {
+			return nil, gerror.WithMessage(gerror.CodeFileCreateError, fmt.Sprintf("%s already exists", params.Path))
+		}
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return nil, gerror.RaiseInternalError(err, "")
+	}
+	temp := filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.%s.part", filepath.Base(target), id))
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeFileCreateError, err, "")
+	}
+
+	s.uploads[id] = &upload{
+		id:        id,
+		path:      params.Path,
+		target:    target,
+		temp:      temp,
+		size:      params.Size,
+		sha256:    expected,
+		overwrite: params.Overwrite,
+		file:      file,
+		hash:      sha256.New(),
+		touched:   time.Now(),
+	}
+	return BeginResult{UploadID: id, ChunkSize: s.chunkSize}, nil
+}
+
+// UploadChunk handles file.upload.chunk
+// Chunks must arrive in order; a chunk at the wrong offset is rejected with the expected offset
+func (s *Service) UploadChunk(req *gsock.Request) (any, error) {
+	var params ChunkParams
+	if err := decodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	up, err := s.upload(params.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.done {
+		return nil, gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("upload %s not found", up.id))
+	}
+	up.touched = time.Now()
+
+	if params.Offset != up.offset {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter,
+			fmt.Sprintf("chunk offset %d does not match expected offset %d", params.Offset, up.offset))
+	}
+	if len(params.Data) > s.chunkSize {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter,
+			fmt.Sprintf("chunk of %d bytes exceeds chunk size %d", len(params.Data), s.chunkSize))
+	}
+	if up.offset+int64(len(params.Data)) > up.size {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "chunk exceeds the declared file size")
+	}
+	if sum := sha256.Sum256(params.Data); hex.EncodeToString(sum[:]) != strings.ToLower(params.Sha256) {
+		return nil, gerror.WithMessage(gerror.CodeInvalidParameter, "chunk sha256 mismatch")
+	}
+
+	if _, err := up.file.WriteAt(params.Data, up.offset); err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeFileWriteError, err, "")
+	}
+	up.hash.Write(params.Data)
+	up.offset += int64(len(params.Data))
+	return ChunkResult{Offset: up.offset}, nil
+}
+
+// UploadCommit handles file.upload.commit
+// The whole-file hash is verified before the temp file is renamed onto the target
+func (s *Service) UploadCommit(req *gsock.Request) (any, error) {
+	var params UploadParams
+	if err := decodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	up, err := s.upload(params.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	up.mu.Lock()
+	result, err := s.commit(up)
+	done := up.done
+	up.mu.Unlock()
+
+	// The registry is updated after up.mu is released to keep the s.mu -> up.mu lock order
+	if done {
+		s.forget(up.id)
+	}
+	return result, err
+}
+
+// commit verifies a complete upload and renames it onto the target; the caller must hold up.mu
+func (s *Service) commit(up *upload) (any, error) {
+	if up.done {
+		return nil, gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("upload %s not found", up.id))
+	}
+	if up.offset != up.size {
+		return nil, gerror.WithMessage(gerror.CodeInvalidOperation,
+			fmt.Sprintf("upload incomplete: %d of %d bytes received", up.offset, up.size))
+	}
+	if sum := hex.EncodeToString(up.hash.Sum(nil)); sum != up.sha256 {
+		s.discard(up)
+		return nil, gerror.WithMessage(gerror.CodeFileWriteError, "file sha256 mismatch, upload discarded")
+	}
+	if err := up.file.Sync(); err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeFileWriteError, err, "")
+	}
+	if err := up.file.Close(); err != nil {
+		return nil, gerror.WithMessageErr(gerror.CodeFileWriteError, err, "")
+	}
+	up.file = nil
+
+	// Re-check the target: a directory on its path may have been replaced by a link meanwhile
+	if target, err := s.resolve(up.path); err != nil || target != up.target {
+		s.discard(up)
+		return nil, gerror.WithMessage(gerror.CodeSecurityReason, "target path changed, upload discarded")
+	}
+	if !up.overwrite {
+		if _, err := os.Lstat(up.target); err == nil {
+			s.discard(up)
+			return nil, gerror.WithMessage(gerror.CodeFileCreateError, "target already exists, upload discarded")
+		}
+	}
+	if err := os.Rename(up.temp, up.target); err != nil {
+		s.discard(up)
+		return nil, gerror.WithMessageErr(gerror.CodeFileCreateError, err, "")
+	}
+	up.done = true
+	return FileResult{Path: up.path, Size: up.size, Sha256: up.sha256}, nil
+}
+
+// UploadAbort handles file.upload.abort and removes the temp file
+func (s *Service) UploadAbort(req *gsock.Request) (any, error) {
+	var params UploadParams
+	if err := decodeParams(req, &params); err != nil {
+		return nil, err
+	}
+	up, err := s.upload(params.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	up.mu.Lock()
+	s.discard(up)
+	up.mu.Unlock()
+
+	s.forget(up.id)
+	return true, nil
+}
+
+// upload looks up an active session
+func (s *Service) upload(id string) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up, ok := s.uploads[id]
+	if !ok {
+		return nil, gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("upload %s not found", id))
+	}
+	return up, nil
+}
+
+// forget removes a finished session from the registry
+func (s *Service) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uploads, id)
+}
+
+// discard closes and deletes an upload's temp file and marks the session done
+// The caller must hold up.mu
+func (s *Service) discard(up *upload) {
+	if up.file != nil {
+		up.file.Close()
+		up.file = nil
+	}
+	os.Remove(up.temp)
+	up.done = true
+}
+
+// sweep discards uploads idle for longer than the session TTL; the caller must hold s.mu
+// Lock order is always s.mu before up.mu
+func (s *Service) sweep() {
+	for id, up := range s.uploads {
+		up.mu.Lock()
+		if up.done || time.Since(up.touched) > s.sessionTTL {
+			s.discard(up)
+			delete(s.uploads, id)
+		}
+		up.mu.Unlock()
+	}
+}
+
+// newUploadID returns a random upload identifier
+func newUploadID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,148 @@
+package gcache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is the number of entries kept when no capacity is given
+const DefaultCapacity = 1024
+
+// item is a single cached value with its expiration time
+type item struct {
+	key      string    // Cache key
+	value    any       // Cached value
+	expireAt time.Time // Zero means the item never expires
+}
+
+// Cache is a concurrent-safe, size bounded LRU cache with per-item TTL
+// When the capacity is reached the least recently used item is evicted
+type Cache struct {
+	mu       sync.Mutex               // Protects items and lru
+	capacity int                      // Maximum number of items
+	items    map[string]*list.Element // Key index into lru
+	lru      *list.List               // Front is the most recently used item
+}
+
+// New creates a cache holding at most capacity items
+// A capacity <= 0 falls back to DefaultCapacity
+func New(capacity int) *Cache {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Cache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Set stores value under key for ttl (ttl <= 0 means no expiration)
+func (c *Cache) Set(key string, value any, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		it := elem.Value.(*item)
+		it.value = value
+		it.expireAt = expireAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&item{key: key, value: value, expireAt: expireAt})
+	for c.lru.Len() > c.capacity {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// Get returns the value stored under key
+// Expired items are removed and reported as missing
+func (c *Cache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	it := elem.Value.(*item)
+	if it.expired(time.Now()) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return it.value, true
+}
+
+// Contains reports whether an unexpired value is stored under key
+// Unlike Get it does not change the LRU order
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	return ok && !elem.Value.(*item).expired(time.Now())
+}
+
+// Remove deletes key from the cache and returns its value if it existed
+func (c *Cache) Remove(key string) (value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		value = elem.Value.(*item).value
+		c.removeElement(elem)
+	}
+	return
+}
+
+// RemovePrefix deletes every key starting with prefix and returns how many were removed
+func (c *Cache) RemovePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(elem)
+			count++
+		}
+	}
+	return count
+}
+
+// Clear removes all items
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns the number of stored items, including expired ones not yet evicted
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// removeElement unlinks an element; the caller must hold the lock
+func (c *Cache) removeElement(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.items, elem.Value.(*item).key)
+}
+
+// expired reports whether the item is past its expiration time
+func (it *item) expired(now time.Time) bool {
+	return !it.expireAt.IsZero() && now.After(it.expireAt)
+}
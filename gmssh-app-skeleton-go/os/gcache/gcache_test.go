@@ -0,0 +1,41 @@
+package gcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheLRUAndTTL(t *testing.T) {
+	c := New(2)
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+	c.Get("a") // "b" becomes the least recently used item
+	c.Set("c", 3, 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("unexpected value for a: %v %v", v, ok)
+	}
+
+	c.Set("ttl", "x", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if c.Contains("ttl") {
+		t.Fatal("expected ttl item to expire")
+	}
+}
+
+func TestCacheRemovePrefix(t *testing.T) {
+	c := New(10)
+	c.Set("file.list /a", 1, 0)
+	c.Set("file.list /b", 2, 0)
+	c.Set("file.read /a", 3, 0)
+
+	if n := c.RemovePrefix("file.list "); n != 2 {
+		t.Fatalf("removed %d items, want 2", n)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("unexpected length %d", c.Len())
+	}
+}
@@ -0,0 +1,82 @@
+package gjob
+
+import (
+	"context"
+	"time"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // Submitted, not started yet
+	StatusRunning   Status = "running"   // Task is executing
+	StatusSucceeded Status = "succeeded" // Task returned without error
+	StatusFailed    Status = "failed"    // Task returned an error or was interrupted by a restart
+	StatusCanceled  Status = "canceled"  // Task was canceled through Cancel
+)
+
+// Finished reports whether the status is terminal
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// Task is the unit of work run by a job
+// It must return promptly once ctx is canceled, and may report progress through p
+type Task func(ctx context.Context, p *Progress) (any, error)
+
+// ErrorInfo is the persisted form of a gerror.Exception
+type ErrorInfo struct {
+	Code    int    `json:"code"`             // Exception code
+	Message string `json:"message"`          // Exception message
+	Detail  any    `json:"detail,omitempty"` // Exception detail
+}
+
+// Job is a snapshot of a job's state as stored on disk and returned to clients
+type Job struct {
+	ID         string     `json:"id"`                   // Unique job identifier
+	Name       string     `json:"name"`                 // Human readable job name (e.g. "archive.extract")
+	Owner      string     `json:"owner,omitempty"`      // Caller that submitted the job, see Owner; empty for app jobs
+	Status     Status     `json:"status"`               // Current state
+	Progress   float64    `json:"progress"`             // Completion percentage 0-100
+	Message    string     `json:"message,omitempty"`    // Last progress message
+	Result     any        `json:"result,omitempty"`     // Task result when succeeded
+	Error      *ErrorInfo `json:"error,omitempty"`      // Failure when failed
+	CreatedAt  time.Time  `json:"createdAt"`            // Submission time
+	UpdatedAt  time.Time  `json:"updatedAt"`            // Last state change
+	FinishedAt *time.Time `json:"finishedAt,omitempty"` // Completion time
+}
+
+// Exception returns the job failure as a gerror.Exception, or nil if the job did not fail
+func (j Job) Exception() gerror.Exception {
+	if j.Error == nil {
+		return nil
+	}
+	return gerror.New(j.Error.Code, j.Error.Message, j.Error.Detail)
+}
+
+// newErrorInfo converts any error into its persisted form
+// Errors that are not gerror.Exception values are stored as CodeOperationFailed
+func newErrorInfo(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+	if ex, ok := err.(gerror.Exception); ok {
+		return &ErrorInfo{Code: ex.Code(), Message: ex.Message(), Detail: ex.Detail()}
+	}
+	return &ErrorInfo{Code: gerror.CodeOperationFailed.Code(), Message: err.Error()}
+}
+
+// Progress lets a running task report how far it got
+type Progress struct {
+	manager *Manager // Owning manager
+	id      string   // Job being reported on
+}
+
+// Update records the completion percentage (0-100) and an optional message
+// Subscribers of the job topic are notified
+func (p *Progress) Update(percent float64, message string) {
+	p.manager.progress(p.id, percent, message)
+}
@@ -0,0 +1,104 @@
+package gjob
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	MethodStatus = "job.status" // Returns one job: {"id": "..."}
+	MethodCancel = "job.cancel" // Cancels one job: {"id": "..."}
+	MethodList   = "job.list"   // Returns all jobs visible to the caller
+
+	// OwnerUserMetaKey is the request meta key identifying the calling user
+	OwnerUserMetaKey = "user"
+)
+
+// Owner identifies the caller of req: on Unix sockets the user ID of the peer process, and
+// the user in the request meta. The meta is set by the client, so it only tells apart
+// callers running as the same user ID
+func Owner(req *gsock.Request) string {
+	owner := "user:" + req.MetaString(OwnerUserMetaKey)
+	if session := req.Session(); session != nil {
+		if cred, err := session.PeerCred(); err == nil {
+			owner = fmt.Sprintf("uid:%d %s", cred.UID, owner)
+		}
+	}
+	return owner
+}
+
+// visible reports whether the caller of req may see job: jobs without owner are visible to all
+func visible(job Job, req *gsock.Request) bool {
+	return job.Owner == "" || job.Owner == Owner(req)
+}
+
+// jobParams are the params of job.status and job.cancel
+type jobParams struct {
+	ID string `json:"id"` // Job identifier returned by Submit
+}
+
+// Register binds job.status, job.cancel and job.list on the given handler registry
+func (m *Manager) Register(handler gsock.IRpcHandler) {
+	handler.RegisterHandle(MethodStatus, m.handleStatus)
+	handler.RegisterHandle(MethodCancel, m.handleCancel)
+	handler.RegisterHandle(MethodList, m.handleList)
+}
+
+// handleStatus returns the snapshot of a job
+func (m *Manager) handleStatus(req *gsock.Request) (any, error) {
+	id, err := parseJobID(req)
+	if err != nil {
+		return nil, err
+	}
+	job, ok := m.Get(id)
+	if !ok || !visible(job, req) {
+		return nil, gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	return job, nil
+}
+
+// handleCancel cancels a job and returns its current snapshot
+func (m *Manager) handleCancel(req *gsock.Request) (any, error) {
+	id, err := parseJobID(req)
+	if err != nil {
+		return nil, err
+	}
+	if job, ok := m.Get(id); ok && !visible(job, req) {
+		return nil, gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	if err := m.Cancel(id); err != nil {
+		return nil, err
+	}
+	job, _ := m.Get(id)
+	return job, nil
+}
+
+// handleList returns the jobs visible to the caller
+func (m *Manager) handleList(req *gsock.Request) (any, error) {
+	jobs := make([]Job, 0)
+	for _, job := range m.List() {
+		if visible(job, req) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// parseJobID decodes and validates the id param
+func parseJobID(req *gsock.Request) (string, error) {
+	raw := req.RawRequest()
+	if raw == nil || raw.Params == nil {
+		return "", gerror.WithMessage(gerror.CodeMissingParameter, "id is required")
+	}
+	var params jobParams
+	if err := json.Unmarshal(*raw.Params, &params); err != nil {
+		return "", gerror.WithMessageErr(gerror.CodeInvalidParameter, err, "")
+	}
+	if params.ID == "" {
+		return "", gerror.WithMessage(gerror.CodeMissingParameter, "id is required")
+	}
+	return params.ID, nil
+}
@@ -0,0 +1,469 @@
+package gjob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gevent"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+const (
+	// DefaultWorkers is the number of jobs allowed to run at the same time
+	DefaultWorkers = 4
+
+	// TopicPrefix prefixes the event topic of every job ("job.<id>")
+	TopicPrefix = "job."
+
+	// DefaultRetentionAge is how long finished jobs are kept
+	DefaultRetentionAge = 7 * 24 * time.Hour
+
+	// DefaultRetentionCount is how many finished jobs are kept
+	DefaultRetentionCount = 1000
+
+	// progressSaveInterval throttles how often progress updates are written to disk
+	progressSaveInterval = time.Second
+)
+
+// ManagerOptFunc defines functions for configuring a job Manager
+type ManagerOptFunc func(*Manager)
+
+// WithManagerDirOption sets the directory job state is persisted in
+// Without a directory jobs are kept in memory only
+func WithManagerDirOption(dir string) ManagerOptFunc {
+	return func(m *Manager) {
+		m.dir = dir
+	}
+}
+
+// WithManagerHubOption publishes job updates on the hub under the topic "job.<id>"
+func WithManagerHubOption(hub *gevent.Hub) ManagerOptFunc {
+	return func(m *Manager) {
+		m.hub = hub
+	}
+}
+
+// WithManagerWorkersOption sets how many jobs may run concurrently
+func WithManagerWorkersOption(workers int) ManagerOptFunc {
+	return func(m *Manager) {
+		m.workers = workers
+	}
+}
+
+// WithManagerRetentionOption sets how long and how many finished jobs are kept, in memory and
+// on disk; older jobs are removed when a job finishes and at startup. Zero disables a limit
+func WithManagerRetentionOption(age time.Duration, count int) ManagerOptFunc {
+	return func(m *Manager) {
+		m.retentionAge = age
+		m.retentionCount = count
+	}
+}
+
+// entry is the in-memory state of a job
+type entry struct {
+	job     Job                // Current snapshot
+	cancel  context.CancelFunc // Cancels the task context (nil once finished)
+	savedAt time.Time          // Last time the job was written to disk
+}
+
+// Manager runs background jobs and keeps their state
+// Handlers submit work and return the job ID immediately; clients then poll
+// job.status or subscribe to "job.<id>" on the event hub:
+//
+//	jobs, _ := gjob.NewManager(gjob.WithManagerDirOption("data/jobs"), gjob.WithManagerHubOption(hub))
+//	jobs.Register(ds)
+//	ds.RegisterHandle("archive.extract", func(req *gsock.Request) (any, error) {
+//	    return jobs.SubmitFor(req, "archive.extract", func(ctx context.Context, p *gjob.Progress) (any, error) {
+//	        ...
+//	    })
+//	})
+type Manager struct {
+	mu             sync.RWMutex      // Protects jobs
+	jobs           map[string]*entry // Jobs by ID
+	dir            string            // Persistence directory (empty = memory only)
+	hub            *gevent.Hub       // Optional progress publisher
+	workers        int               // Concurrency limit
+	slots          chan struct{}     // Worker semaphore
+	wg             sync.WaitGroup    // Running tasks
+	retentionAge   time.Duration     // Finished jobs older than this are removed (0 = keep)
+	retentionCount int               // Finished jobs beyond this many are removed (0 = keep)
+}
+
+// NewManager creates a job manager and restores jobs persisted by a previous run
+// Jobs that were still pending or running when the app stopped are marked failed
+func NewManager(opts ...ManagerOptFunc) (*Manager, error) {
+	m := &Manager{
+		jobs:           make(map[string]*entry),
+		workers:        DefaultWorkers,
+		retentionAge:   DefaultRetentionAge,
+		retentionCount: DefaultRetentionCount,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.workers <= 0 {
+		m.workers = DefaultWorkers
+	}
+	m.slots = make(chan struct{}, m.workers)
+
+	if m.dir != "" {
+		if err := os.MkdirAll(m.dir, 0755); err != nil {
+			return nil, gerror.WithMessageErr(gerror.CodeCreateDirectoryError, err, "")
+		}
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Submit starts task in the background and returns the new job ID
+// The job has no owner and is visible to every caller of the job methods
+func (m *Manager) Submit(name string, task Task) (string, error) {
+	return m.submit("", name, task)
+}
+
+// SubmitFor starts task in the background on behalf of the caller of req and returns the new
+// job ID; only the same caller (see Owner) sees the job through the job methods
+func (m *Manager) SubmitFor(req *gsock.Request, name string, task Task) (string, error) {
+	return m.submit(Owner(req), name, task)
+}
+
+// submit starts a job owned by owner
+func (m *Manager) submit(owner, name string, task Task) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", gerror.RaiseInternalError(err, "")
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Name:      name,
+			Owner:     owner,
+			Status:    StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = e
+	m.save(e)
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(ctx, id, task)
+	return id, nil
+}
+
+// Get returns a snapshot of the job
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job, true
+}
+
+// List returns snapshots of all jobs, oldest first
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, e := range m.jobs {
+		jobs = append(jobs, e.job)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel requests cancellation of a pending or running job
+// The job becomes canceled once its task returns
+func (m *Manager) Cancel(id string) error {
+	m.mu.RLock()
+	e, ok := m.jobs[id]
+	var cancel context.CancelFunc
+	var finished bool
+	if ok {
+		cancel = e.cancel
+		finished = e.job.Status.Finished()
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	if finished || cancel == nil {
+		return gerror.WithMessage(gerror.CodeInvalidOperation, fmt.Sprintf("job %s already finished", id))
+	}
+	cancel()
+	return nil
+}
+
+// Remove forgets a finished job and deletes its persisted state
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return gerror.WithMessage(gerror.CodeNotFound, fmt.Sprintf("job %s not found", id))
+	}
+	if !e.job.Status.Finished() {
+		return gerror.WithMessage(gerror.CodeInvalidOperation, fmt.Sprintf("job %s is still running", id))
+	}
+	delete(m.jobs, id)
+	if m.dir != "" {
+		if err := os.Remove(m.path(id)); err != nil && !os.IsNotExist(err) {
+			return gerror.WithMessageErr(gerror.CodeFileDeleteError, err, "")
+		}
+	}
+	return nil
+}
+
+// Shutdown cancels all running jobs and waits for their tasks to return or ctx to end
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.RLock()
+	for _, e := range m.jobs {
+		if e.cancel != nil {
+			e.cancel()
+		}
+	}
+	m.mu.RUnlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run waits for a worker slot, executes the task and records its outcome
+func (m *Manager) run(ctx context.Context, id string, task Task) {
+	defer m.wg.Done()
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		m.finish(id, nil, ctx.Err())
+		return
+	}
+
+	m.update(id, func(job *Job) {
+		job.Status = StatusRunning
+	}, true)
+
+	var (
+		result any
+		err    error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = gerror.WithCode(gerror.CodeInternalPanic, fmt.Sprint(r))
+			}
+		}()
+		result, err = task(ctx, &Progress{manager: m, id: id})
+	}()
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	m.finish(id, result, err)
+}
+
+// finish records the terminal state of a job
+func (m *Manager) finish(id string, result any, err error) {
+	m.update(id, func(job *Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		switch {
+		case err == nil:
+			job.Status = StatusSucceeded
+			job.Progress = 100
+			job.Result = result
+		case errors.Is(err, context.Canceled):
+			job.Status = StatusCanceled
+		default:
+			job.Status = StatusFailed
+			job.Error = newErrorInfo(err)
+		}
+	}, true)
+
+	m.mu.Lock()
+	if e, ok := m.jobs[id]; ok && e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	m.prune()
+	m.mu.Unlock()
+}
+
+// prune removes the finished jobs beyond the retention limits; the caller must hold the lock
+func (m *Manager) prune() {
+	if m.retentionAge <= 0 && m.retentionCount <= 0 {
+		return
+	}
+
+	finished := make([]*entry, 0)
+	for _, e := range m.jobs {
+		if e.job.Status.Finished() && e.job.FinishedAt != nil {
+			finished = append(finished, e)
+		}
+	}
+	// Newest first, so the jobs kept by count are the most recent ones
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].job.FinishedAt.After(*finished[j].job.FinishedAt)
+	})
+
+	cutoff := time.Now().Add(-m.retentionAge)
+	for i, e := range finished {
+		expired := m.retentionAge > 0 && e.job.FinishedAt.Before(cutoff)
+		if !expired && (m.retentionCount <= 0 || i < m.retentionCount) {
+			continue
+		}
+		delete(m.jobs, e.job.ID)
+		if m.dir == "" {
+			continue
+		}
+		if err := os.Remove(m.path(e.job.ID)); err != nil && !os.IsNotExist(err) {
+			zap.L().Warn("remove expired job failed", zap.String("job", e.job.ID), zap.Error(err))
+		}
+	}
+}
+
+// progress records a progress update from a running task
+func (m *Manager) progress(id string, percent float64, message string) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	m.update(id, func(job *Job) {
+		job.Progress = percent
+		job.Message = message
+	}, false)
+}
+
+// update mutates a job, persists it and publishes the new snapshot
+// Non-forced updates are written to disk at most once per progressSaveInterval
+func (m *Manager) update(id string, mutate func(job *Job), force bool) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok || (e.job.Status.Finished() && !force) {
+		m.mu.Unlock()
+		return
+	}
+	mutate(&e.job)
+	e.job.UpdatedAt = time.Now()
+	if force || time.Since(e.savedAt) >= progressSaveInterval {
+		m.save(e)
+	}
+	snapshot := e.job
+	m.mu.Unlock()
+
+	if m.hub != nil {
+		m.hub.Publish(TopicPrefix+id, snapshot)
+	}
+}
+
+// save writes a job to disk atomically; the caller must hold the lock
+// Persistence failures are logged rather than failing the job
+func (m *Manager) save(e *entry) {
+	if m.dir == "" {
+		return
+	}
+	e.savedAt = time.Now()
+
+	data, err := json.Marshal(e.job)
+	if err == nil {
+		tmp := m.path(e.job.ID) + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, m.path(e.job.ID))
+		}
+	}
+	if err != nil {
+		zap.L().Error("persist job failed", zap.String("job", e.job.ID), zap.Error(err))
+	}
+}
+
+// load restores persisted jobs
+func (m *Manager) load() error {
+	files, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			zap.L().Warn("skip unreadable job file", zap.String("file", file),
+				zap.Error(gerror.WithMessageErr(gerror.CodeFileReadError, err, "")))
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			zap.L().Warn("skip corrupted job file", zap.String("file", file), zap.Error(err))
+			continue
+		}
+
+		e := &entry{job: job}
+		if !job.Status.Finished() {
+			// The process stopped while the job was active; its task is gone
+			now := time.Now()
+			e.job.Status = StatusFailed
+			e.job.FinishedAt = &now
+			e.job.UpdatedAt = now
+			e.job.Error = newErrorInfo(gerror.WithMessage(gerror.CodeOperationFailed, "interrupted by restart"))
+			m.save(e)
+		}
+		m.jobs[job.ID] = e
+	}
+	m.prune()
+	return nil
+}
+
+// path returns the state file of a job
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+// newID returns a random job identifier
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToLower(hex.EncodeToString(buf)), nil
+}
@@ -0,0 +1,163 @@
+package gjob
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/DemonZack/simplejrpc-go/core/gerror"
+	"github.com/DemonZack/simplejrpc-go/net/gsock"
+)
+
+func waitJob(t *testing.T, m *Manager, id string) Job {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := m.Get(id); ok && job.Status.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	m, err := NewManager(WithManagerDirOption(t.TempDir()))
+	if err != nil {
+		t.Fatalf("create manager failed: %v", err)
+	}
+
+	ok, _ := m.Submit("copy", func(ctx context.Context, p *Progress) (any, error) {
+		p.Update(50, "half way")
+		return "done", nil
+	})
+	failed, _ := m.Submit("extract", func(ctx context.Context, p *Progress) (any, error) {
+		return nil, gerror.WithCode(gerror.CodeFileWriteError, "/tmp/x")
+	})
+	canceled, _ := m.Submit("sleep", func(ctx context.Context, p *Progress) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err := m.Cancel(canceled); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+
+	if job := waitJob(t, m, ok); job.Status != StatusSucceeded || job.Result != "done" || job.Progress != 100 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	job := waitJob(t, m, failed)
+	if job.Status != StatusFailed || job.Exception().Code() != gerror.CodeFileWriteError.Code() {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job := waitJob(t, m, canceled); job.Status != StatusCanceled {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if len(m.List()) != 3 {
+		t.Fatalf("unexpected job count %d", len(m.List()))
+	}
+}
+
+func TestJobRestoredAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(WithManagerDirOption(dir))
+
+	done, _ := m.Submit("copy", func(ctx context.Context, p *Progress) (any, error) {
+		return 42, nil
+	})
+	waitJob(t, m, done)
+	running, _ := m.Submit("copy", func(ctx context.Context, p *Progress) (any, error) {
+		<-ctx.Done()
+		return nil, nil
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	// A second manager on the same directory simulates the app restarting
+	restarted, err := NewManager(WithManagerDirOption(dir))
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if job, ok := restarted.Get(done); !ok || job.Status != StatusSucceeded || job.Result != float64(42) {
+		t.Fatalf("unexpected restored job %+v", job)
+	}
+	if job, ok := restarted.Get(running); !ok || job.Status != StatusFailed || job.Exception() == nil {
+		t.Fatalf("interrupted job not marked failed: %+v", job)
+	}
+	m.Shutdown(context.Background())
+}
+
+func TestRetentionAndUnreadableFiles(t *testing.T) {
+	dir := t.TempDir()
+	// A state file that cannot be read is skipped instead of failing every job
+	os.Mkdir(filepath.Join(dir, "broken.json"), 0755)
+
+	m, err := NewManager(WithManagerDirOption(dir), WithManagerRetentionOption(0, 2))
+	if err != nil {
+		t.Fatalf("create manager failed: %v", err)
+	}
+	ids := make([]string, 3)
+	for i := range ids {
+		ids[i], _ = m.Submit("copy", func(ctx context.Context, p *Progress) (any, error) {
+			return nil, nil
+		})
+		waitJob(t, m, ids[i])
+	}
+	m.Shutdown(context.Background())
+	if _, ok := m.Get(ids[0]); ok || len(m.List()) != 2 {
+		t.Fatalf("oldest job kept, %d jobs", len(m.List()))
+	}
+	if _, err := os.Stat(m.path(ids[0])); !os.IsNotExist(err) {
+		t.Fatalf("state file of a removed job kept: %v", err)
+	}
+
+	// Expired jobs are removed at startup
+	restarted, err := NewManager(WithManagerDirOption(dir), WithManagerRetentionOption(time.Nanosecond, 0))
+	if err != nil || len(restarted.List()) != 0 {
+		t.Fatalf("expired jobs restored: %v, %v", restarted.List(), err)
+	}
+}
+
+func TestJobMethodsAreScopedToTheOwner(t *testing.T) {
+	m, _ := NewManager()
+	handler := gsock.NewJsonRpcSimpleServiceHandler()
+	m.Register(handler)
+
+	call := func(user, method string, params any) *gsock.Response {
+		req := &jsonrpc2.Request{Method: method}
+		req.SetParams(params)
+		req.SetMeta(map[string]string{"user": user})
+		resp, _ := handler.Handle(gsock.MakeRequest(gsock.WithRequestReqOption(req)))
+		return resp.(*gsock.Response)
+	}
+	owner := &jsonrpc2.Request{}
+	owner.SetMeta(map[string]string{"user": "alice"})
+	id, _ := m.SubmitFor(gsock.MakeRequest(gsock.WithRequestReqOption(owner)), "copy", func(ctx context.Context, p *Progress) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	shared, _ := m.Submit("cleanup", func(ctx context.Context, p *Progress) (any, error) {
+		return nil, nil
+	})
+	waitJob(t, m, shared)
+
+	if resp := call("bob", MethodStatus, jobParams{ID: id}); resp.Code == http.StatusOK {
+		t.Fatalf("job visible to another user: %+v", resp)
+	}
+	if resp := call("bob", MethodCancel, jobParams{ID: id}); resp.Code == http.StatusOK {
+		t.Fatalf("job canceled by another user: %+v", resp)
+	}
+	if jobs := call("bob", MethodList, nil).Data.([]Job); len(jobs) != 1 || jobs[0].ID != shared {
+		t.Fatalf("unexpected jobs of another user %+v", jobs)
+	}
+	if jobs := call("alice", MethodList, nil).Data.([]Job); len(jobs) != 2 {
+		t.Fatalf("unexpected jobs of the owner %+v", jobs)
+	}
+	if resp := call("alice", MethodCancel, jobParams{ID: id}); resp.Code != http.StatusOK {
+		t.Fatalf("owner could not cancel: %+v", resp)
+	}
+	waitJob(t, m, id)
+}
@@ -1,14 +1,50 @@
 package simplejrpc
 
 import (
+	"errors"
+	"sync"
+
 	"github.com/DemonZack/simplejrpc-go/net/gsock"
 )
 
 // Server represents a JSON-RPC server with middleware support.
 // It wraps the underlying IRpcServer implementation and provides additional functionality.
+// Besides the StartServer socket it can serve more sockets sharing its handler registry, see AddListener.
 type Server struct {
-	middlewares []gsock.RPCMiddleware // Global middleware that applies to all registered handlers
-	service     gsock.IRpcServer      // Underlying JSON-RPC server implementation
+	middlewares []gsock.RPCMiddleware       // Global middleware that applies to all registered handlers
+	service     gsock.IRpcServer            // Underlying JSON-RPC server implementation
+	primary     *gsock.JsonRpcSimpleService // Service behind service, whose handler listeners share
+	listeners   []gsock.Listener            // Extra sockets added with AddListener
+	onConnect   []gsock.SessionHook         // Connection hooks, also added to later listeners
+	onClose     []gsock.SessionHook         // Disconnection hooks, also added to later listeners
+	mu          sync.Mutex                  // Protects group
+	group       *gsock.ListenerGroup        // Running sockets, nil until started
+}
+
+// ListenerOptFunc configures a socket added with AddListener
+type ListenerOptFunc func(*listenerConfig)
+
+// listenerConfig holds the options of an added socket
+type listenerConfig struct {
+	methods []string                               // Exposed method patterns (nil = all)
+	options []gsock.JsonRpcSimpleServiceOptionFunc // Options of the socket's service
+}
+
+// WithListenerMethodsOption exposes only the methods matching patterns in path.Match syntax
+// ("file.*") on the socket; other methods answer 404, and rpc.methods lists the exposed ones
+// if the handler lists its methods
+func WithListenerMethodsOption(patterns ...string) ListenerOptFunc {
+	return func(c *listenerConfig) {
+		c.methods = append(c.methods, patterns...)
+	}
+}
+
+// WithListenerServiceOption configures the socket's own service, e.g. its middlewares,
+// limits or compression; nothing is inherited from the options of NewDefaultServer
+func WithListenerServiceOption(opts ...gsock.JsonRpcSimpleServiceOptionFunc) ListenerOptFunc {
+	return func(c *listenerConfig) {
+		c.options = append(c.options, opts...)
+	}
 }
 
 // NewDefaultServer creates a new Server instance with default configuration.
@@ -17,13 +53,13 @@ type Server struct {
 // Returns a pointer to the newly created Server instance
 func NewDefaultServer(opts ...gsock.JsonRpcSimpleServiceOptionFunc) *Server {
 	// Create a new RPC server with a JSON-RPC simple service as the underlying implementation
+	primary := gsock.NewJsonRpcSimpleService(opts...)
 	service := gsock.NewRpcServer(
-		gsock.WithServiceOptFunc(
-			gsock.NewJsonRpcSimpleService(opts...),
-		),
+		gsock.WithServiceOptFunc(primary),
 	)
 	return &Server{
 		service: service, // Initialize the server with the created RPC service
+		primary: primary,
 	}
 }
 
@@ -37,6 +73,56 @@ func (s *Server) RegisterHandle(api string, hand func(req *gsock.Request) (any,
 	s.service.RegisterHandle(api, hand, middlewares...)
 }
 
+// OnConnect adds a hook run for every new connection before its first request is handled.
+// Terminal-like apps use it to set up per-connection state in Session.Values().
+// hook: Function receiving the session of the new connection
+// Hooks apply to the sockets added with AddListener as well.
+func (s *Server) OnConnect(hook gsock.SessionHook) {
+	if hooks, ok := s.service.(gsock.ISessionHooks); ok {
+		hooks.OnConnect(hook)
+	}
+	for _, listener := range s.listeners {
+		if hooks, ok := listener.Service.(gsock.ISessionHooks); ok {
+			hooks.OnConnect(hook)
+		}
+	}
+	s.onConnect = append(s.onConnect, hook)
+}
+
+// OnDisconnect adds a hook run once a connection is closed, by the peer,
+// through Session.Close or on shutdown; use it to release per-connection resources.
+// hook: Function receiving the session of the closed connection
+// Hooks apply to the sockets added with AddListener as well.
+func (s *Server) OnDisconnect(hook gsock.SessionHook) {
+	if hooks, ok := s.service.(gsock.ISessionHooks); ok {
+		hooks.OnDisconnect(hook)
+	}
+	for _, listener := range s.listeners {
+		if hooks, ok := listener.Service.(gsock.ISessionHooks); ok {
+			hooks.OnDisconnect(hook)
+		}
+	}
+	s.onClose = append(s.onClose, hook)
+}
+
+// Maintenance returns the switch turning methods, or the whole app, off at runtime.
+// Returns: The maintenance switch, nil if the service's handler has none
+func (s *Server) Maintenance() *gsock.Maintenance {
+	if m, ok := s.service.(gsock.IMaintenance); ok {
+		return m.Maintenance()
+	}
+	return nil
+}
+
+// DeprecatedCalls returns how often each deprecated method was called, to tell when it can be removed.
+// Returns: The counters sorted by method, nil if the service's handler has none
+func (s *Server) DeprecatedCalls() []gsock.DeprecatedCall {
+	if d, ok := s.service.(gsock.IDeprecatedCalls); ok {
+		return d.DeprecatedCalls()
+	}
+	return nil
+}
+
 // Middlewares returns the server's global middlewares.
 // Returns: A slice of RPCMiddleware currently registered as global middlewares
 func (s *Server) Middlewares() []gsock.RPCMiddleware {
@@ -50,9 +136,70 @@ func (s *Server) Server() gsock.IRpcServer {
 	return s.service
 }
 
-// StartServer starts the JSON-RPC server listening on the specified Unix domain socket path.
+// AddListener adds a socket served alongside the StartServer one, sharing its handler registry:
+// methods registered on the server are available on every socket, while each socket has its
+// own middlewares, limits and sessions. Typically the StartServer socket is the admin socket
+// with every method and added ones are public with a limited method set:
+//
+//	ds.AddListener("/run/app/public.sock",
+//		simplejrpc.WithListenerMethodsOption("ping", "file.*"),
+//		simplejrpc.WithListenerServiceOption(gsock.WithJsonRpcSimpleServiceMiddlewares(auth)))
+//	err := ds.StartServer("/run/app/admin.sock")
+//
+// socketPath: The filesystem path of the added Unix domain socket
+// opts: Exposed methods and service options of the socket
+// Returns: An error if the server has no handler to share or a method pattern is malformed
+func (s *Server) AddListener(socketPath string, opts ...ListenerOptFunc) error {
+	if s.primary == nil || s.primary.Handler() == nil {
+		return errors.New("server has no handler to share")
+	}
+	cfg := &listenerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	handler := s.primary.Handler()
+	if cfg.methods != nil {
+		var err error
+		if handler, err = gsock.NewMethodFilter(handler, cfg.methods...); err != nil {
+			return err
+		}
+	}
+	service := gsock.NewJsonRpcSimpleService(append(cfg.options, gsock.WithJsonRpcSimpleServiceHandler(handler))...)
+	for _, hook := range s.onConnect {
+		service.OnConnect(hook)
+	}
+	for _, hook := range s.onClose {
+		service.OnDisconnect(hook)
+	}
+	s.listeners = append(s.listeners, gsock.Listener{SocketPath: socketPath, Service: service})
+	return nil
+}
+
+// StartServer starts the JSON-RPC server listening on the specified Unix domain socket path,
+// together with the sockets added with AddListener. All sockets stop together, on an interrupt
+// signal, through Stop or when one of them fails.
 // socketPath: The filesystem path where the Unix domain socket will be created
 // Returns: An error if the server fails to start, nil otherwise
 func (s *Server) StartServer(socketPath string) error {
-	return s.service.StartServer(socketPath)
+	if s.primary == nil {
+		return s.service.StartServer(socketPath)
+	}
+	listeners := append([]gsock.Listener{{SocketPath: socketPath, Service: s.primary}}, s.listeners...)
+	group := gsock.NewListenerGroup(listeners...)
+	s.mu.Lock()
+	s.group = group
+	s.mu.Unlock()
+	return group.Start()
+}
+
+// Stop shuts down every socket started by StartServer, closing open connections.
+// StartServer returns once they are closed; Stop does nothing before StartServer.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	group := s.group
+	s.mu.Unlock()
+	if group != nil {
+		group.Stop()
+	}
 }